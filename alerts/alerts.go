@@ -1,6 +1,10 @@
 package alerts
 
 import (
+	"fmt"
+	"net"
+	"strings"
+
 	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/groups"
 )
@@ -28,6 +32,21 @@ type Event struct {
 
 	EventType string `json:"eventType"`
 
+	// Suppressed is the number of similar alerts suppressed, if it's a summary alert.
+	Suppressed int `json:"suppressed,omitempty"`
+
+	// Asset of the source, from the asset inventory.
+	Asset *Asset `json:"asset,omitempty"`
+
+	// DestGeo is location of the destination ip, from GeoIP databases.
+	DestGeo *Geo `json:"destGeo,omitempty"`
+	// ResolvedGeo are locations of addresses the queried name resolved to,
+	// from passive dns and GeoIP databases.
+	ResolvedGeo []Geo `json:"resolvedGeo,omitempty"`
+
+	// PcapFile with packets of the source around the event time, from the packet capture ring.
+	PcapFile string `json:"pcapFile,omitempty"`
+
 	client.EventUnified
 }
 
@@ -38,6 +57,79 @@ type Threat struct {
 	Policy      bool   `json:"policy,omitempty"`
 }
 
+// Asset describes source of the event.
+type Asset struct {
+	Owner       string `json:"owner,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+	Criticality string `json:"criticality,omitempty"`
+}
+
+// Enricher fills additional fields of the event, e.g. source hostname.
+// Events are enriched concurrently.
+type Enricher interface {
+	Enrich(*Event)
+}
+
+// Geo is location and autonomous system of an ip address.
+type Geo struct {
+	IP          net.IP `json:"ip,omitempty"`
+	Country     string `json:"country,omitempty"`
+	CountryName string `json:"countryName,omitempty"`
+	City        string `json:"city,omitempty"`
+	ASN         uint   `json:"asn,omitempty"`
+	ASOrg       string `json:"asOrg,omitempty"`
+}
+
+// AS returns autonomous system number and organization, e.g. AS15169 Google LLC.
+func (g *Geo) AS() string {
+	switch {
+	case g.ASN == 0:
+		return g.ASOrg
+	case g.ASOrg == "":
+		return fmt.Sprintf("AS%d", g.ASN)
+	}
+	return fmt.Sprintf("AS%d %s", g.ASN, g.ASOrg)
+}
+
+// geoSummary returns distinct countries, cities and autonomous systems of
+// destination, or of resolved addresses of the event, joined by comma.
+func geoSummary(event *Event) (countries, cities, as string) {
+	geos := event.ResolvedGeo
+	if event.DestGeo != nil {
+		geos = []Geo{*event.DestGeo}
+	}
+
+	var cs, cis, ass []string
+	appendDistinct := func(values []string, value string) []string {
+		if value == "" {
+			return values
+		}
+		for _, v := range values {
+			if v == value {
+				return values
+			}
+		}
+		return append(values, value)
+	}
+	for n := range geos {
+		cs = appendDistinct(cs, geos[n].Country)
+		cis = appendDistinct(cis, geos[n].City)
+		ass = appendDistinct(ass, geos[n].AS())
+	}
+	return strings.Join(cs, ","), strings.Join(cis, ","), strings.Join(ass, ",")
+}
+
+// Capture writes packets of the event to a pcap file, and returns its path,
+// or empty string if there are no packets of the event.
+type Capture interface {
+	Capture(*Event) string
+}
+
+// Recorder keeps history of alerts, e.g. in local database.
+type Recorder interface {
+	Record([]Event) error
+}
+
 // Group describe group event belongs to.
 type Group struct {
 	Label       string `json:"label"`
@@ -49,6 +141,18 @@ func NewAlertMapper(groups *groups.Groups) *AlertMapper {
 	return &AlertMapper{groups: groups}
 }
 
+// srcGroups returns groups of the source ip.
+func (m *AlertMapper) srcGroups(ip net.IP) []Group {
+	var groups []Group
+	for _, group := range m.groups.FindGroupsBySrcIP(ip) {
+		groups = append(groups, Group{
+			Label:       group.Name,
+			Description: group.Label,
+		})
+	}
+	return groups
+}
+
 // Map maps client response to alert.
 func (m *AlertMapper) Map(resp *client.AlertsResponse) *Alert {
 	var alert = &Alert{
@@ -78,12 +182,7 @@ func (m *AlertMapper) Map(resp *client.AlertsResponse) *Alert {
 			}
 		}
 
-		for _, group := range m.groups.FindGroupsBySrcIP(resp.Alerts[i].Event.SrcIP) {
-			ev.Groups = append(alert.Events[i].Groups, Group{
-				Label:       group.Name,
-				Description: group.Label,
-			})
-		}
+		ev.Groups = m.srcGroups(resp.Alerts[i].Event.SrcIP)
 
 		alert.Events[i] = ev
 	}
@@ -0,0 +1,309 @@
+package alerts
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alphasoc/nfr/elastic"
+)
+
+// DefaultElasticBatchSize is the default maximum number of alerts indexed in one request.
+const DefaultElasticBatchSize = 100
+
+// ecsDocument is an alert mapped to Elastic Common Schema.
+type ecsDocument struct {
+	Timestamp time.Time         `json:"@timestamp"`
+	Tags      []string          `json:"tags,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+
+	Event    ecsEvent    `json:"event"`
+	Observer ecsObserver `json:"observer"`
+	Threat   ecsThreat   `json:"threat"`
+
+	Source      ecsEndpoint   `json:"source"`
+	Destination *ecsEndpoint  `json:"destination,omitempty"`
+	Network     *ecsNetwork   `json:"network,omitempty"`
+	User        *ecsUser      `json:"user,omitempty"`
+	DNS         *ecsDNS       `json:"dns,omitempty"`
+	URL         *ecsURL       `json:"url,omitempty"`
+	HTTP        *ecsHTTP      `json:"http,omitempty"`
+	UserAgent   *ecsUserAgent `json:"user_agent,omitempty"`
+	TLS         *ecsTLS       `json:"tls,omitempty"`
+}
+
+type ecsEvent struct {
+	Kind     string   `json:"kind"`
+	Category []string `json:"category"`
+	Module   string   `json:"module"`
+	Dataset  string   `json:"dataset"`
+	Severity int      `json:"severity"`
+	Created  string   `json:"created"`
+}
+
+type ecsObserver struct {
+	Vendor   string `json:"vendor"`
+	Product  string `json:"product"`
+	Version  string `json:"version"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+type ecsThreat struct {
+	Framework string `json:"framework"`
+	Technique struct {
+		ID   []string `json:"id"`
+		Name []string `json:"name"`
+	} `json:"technique"`
+}
+
+type ecsEndpoint struct {
+	IP     net.IP  `json:"ip,omitempty"`
+	Port   uint16  `json:"port,omitempty"`
+	MAC    string  `json:"mac,omitempty"`
+	Domain string  `json:"domain,omitempty"`
+	Bytes  int64   `json:"bytes,omitempty"`
+	Geo    *ecsGeo `json:"geo,omitempty"`
+	AS     *ecsAS  `json:"as,omitempty"`
+}
+
+type ecsGeo struct {
+	CountryISOCode string `json:"country_iso_code,omitempty"`
+	CountryName    string `json:"country_name,omitempty"`
+	CityName       string `json:"city_name,omitempty"`
+}
+
+type ecsAS struct {
+	Number       uint `json:"number,omitempty"`
+	Organization struct {
+		Name string `json:"name,omitempty"`
+	} `json:"organization"`
+}
+
+type ecsNetwork struct {
+	Transport string `json:"transport,omitempty"`
+	Direction string `json:"direction,omitempty"`
+}
+
+type ecsUser struct {
+	Name string `json:"name"`
+}
+
+type ecsDNS struct {
+	Question struct {
+		Name string `json:"name"`
+		Type string `json:"type,omitempty"`
+	} `json:"question"`
+}
+
+type ecsURL struct {
+	Original string `json:"original"`
+}
+
+type ecsHTTP struct {
+	Request struct {
+		Method   string `json:"method,omitempty"`
+		Referrer string `json:"referrer,omitempty"`
+	} `json:"request"`
+	Response struct {
+		StatusCode int32  `json:"status_code,omitempty"`
+		MimeType   string `json:"mime_type,omitempty"`
+	} `json:"response"`
+}
+
+type ecsUserAgent struct {
+	Original string `json:"original"`
+}
+
+type ecsTLS struct {
+	Client struct {
+		JA3 string `json:"ja3"`
+	} `json:"client"`
+}
+
+// newECSDocument maps event to ECS document.
+func newECSDocument(event *Event, hostname string) *ecsDocument {
+	doc := &ecsDocument{
+		Timestamp: event.Timestamp,
+		Tags:      event.Flags,
+		Event: ecsEvent{
+			Kind:     "alert",
+			Category: []string{"network", "threat"},
+			Module:   "nfr",
+			Dataset:  "nfr.alert",
+			Severity: event.Severity,
+			Created:  time.Now().UTC().Format(time.RFC3339Nano),
+		},
+		Observer: ecsObserver{
+			Vendor:   DefaultLogVendor,
+			Product:  DefaultLogProduct,
+			Version:  strings.TrimPrefix(DefaultLogVersion, "v"),
+			Hostname: hostname,
+		},
+		Source: ecsEndpoint{
+			IP:     event.SrcIP,
+			Port:   event.SrcPort,
+			MAC:    event.SrcMac,
+			Domain: event.SrcHost,
+			Bytes:  event.BytesOut,
+		},
+	}
+
+	if len(event.Groups) > 0 {
+		groups := make([]string, len(event.Groups))
+		for n := range event.Groups {
+			groups[n] = event.Groups[n].Label
+		}
+		doc.Labels = map[string]string{"groups": strings.Join(groups, ",")}
+	}
+	if event.Asset != nil {
+		if doc.Labels == nil {
+			doc.Labels = make(map[string]string)
+		}
+		for key, value := range map[string]string{
+			"asset_owner":       event.Asset.Owner,
+			"asset_tag":         event.Asset.Tag,
+			"asset_criticality": event.Asset.Criticality,
+		} {
+			if value != "" {
+				doc.Labels[key] = value
+			}
+		}
+	}
+
+	// sort threats, so documents are stable
+	tids := make([]string, 0, len(event.Threats))
+	for tid := range event.Threats {
+		tids = append(tids, tid)
+	}
+	sort.Strings(tids)
+	doc.Threat.Framework = "AlphaSOC"
+	for _, tid := range tids {
+		doc.Threat.Technique.ID = append(doc.Threat.Technique.ID, tid)
+		doc.Threat.Technique.Name = append(doc.Threat.Technique.Name, event.Threats[tid].Description)
+	}
+
+	if event.SrcUser != "" {
+		doc.User = &ecsUser{Name: event.SrcUser}
+	}
+	if event.DestIP != nil || event.DestPort != 0 || event.BytesIn != 0 {
+		doc.Destination = &ecsEndpoint{IP: event.DestIP, Port: event.DestPort, Domain: event.DestHost, Bytes: event.BytesIn}
+		if geo := event.DestGeo; geo != nil {
+			if geo.Country != "" || geo.City != "" {
+				doc.Destination.Geo = &ecsGeo{CountryISOCode: geo.Country, CountryName: geo.CountryName, CityName: geo.City}
+			}
+			if geo.ASN != 0 || geo.ASOrg != "" {
+				doc.Destination.AS = &ecsAS{Number: geo.ASN}
+				doc.Destination.AS.Organization.Name = geo.ASOrg
+			}
+		}
+	}
+	if event.Proto != "" || event.Internal {
+		doc.Network = &ecsNetwork{Transport: strings.ToLower(event.Proto)}
+		if event.Internal {
+			doc.Network.Direction = "internal"
+		}
+	}
+	if event.Ja3 != "" {
+		doc.TLS = &ecsTLS{}
+		doc.TLS.Client.JA3 = event.Ja3
+	}
+
+	switch event.EventType {
+	case "dns":
+		doc.DNS = &ecsDNS{}
+		doc.DNS.Question.Name = event.Query
+		doc.DNS.Question.Type = event.QueryType
+	case "http":
+		doc.URL = &ecsURL{Original: event.URL}
+		doc.HTTP = &ecsHTTP{}
+		doc.HTTP.Request.Method = event.Method
+		doc.HTTP.Request.Referrer = event.Referrer
+		doc.HTTP.Response.StatusCode = event.Status
+		doc.HTTP.Response.MimeType = event.ContentType
+		if event.UserAgent != "" {
+			doc.UserAgent = &ecsUserAgent{Original: event.UserAgent}
+		}
+	}
+	return doc
+}
+
+// ecsDocumentID returns id of the event document, a hash of its time, endpoints
+// and threats. The same event indexed again gets the same id, so retries of
+// failed batches don't create duplicates.
+func ecsDocumentID(event *Event) string {
+	tids := make([]string, 0, len(event.Threats))
+	for tid := range event.Threats {
+		tids = append(tids, tid)
+	}
+	sort.Strings(tids)
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%s\x00%d\x00%s\x00%d\x00%s\x00%s\x00%s",
+		event.EventType, event.Timestamp.UnixNano(),
+		event.SrcIP, event.SrcPort, event.DestIP, event.DestPort,
+		event.Query, event.URL, strings.Join(tids, ","))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ElasticWriter implements Writer interface and indexes
+// api alerts in elasticsearch in batches, mapped to ECS.
+type ElasticWriter struct {
+	c         *elastic.Client
+	index     string
+	batchSize int
+	hostname  string
+	docs      []elastic.Document
+}
+
+// NewElasticWriter creates new elasticsearch writer.
+func NewElasticWriter(cfg *elastic.Config, index string, batchSize int) (*ElasticWriter, error) {
+	c, err := elastic.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultElasticBatchSize
+	}
+
+	hostname, _ := os.Hostname()
+	return &ElasticWriter{
+		c:         c,
+		index:     index,
+		batchSize: batchSize,
+		hostname:  hostname,
+	}, nil
+}
+
+// Write adds alert to the batch, and indexes it if the batch is full.
+func (w *ElasticWriter) Write(event *Event) error {
+	w.docs = append(w.docs, elastic.Document{ID: ecsDocumentID(event), Source: newECSDocument(event, w.hostname)})
+	if len(w.docs) >= w.batchSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush indexes all buffered alerts.
+func (w *ElasticWriter) Flush() error {
+	if len(w.docs) == 0 {
+		return nil
+	}
+	docs := w.docs
+	w.docs = nil
+
+	if err := w.c.Index(context.Background(), w.index, docs); err != nil {
+		return fmt.Errorf("index %d alerts in elasticsearch failed: %s", len(docs), err)
+	}
+	return nil
+}
+
+// Close indexes buffered alerts.
+func (w *ElasticWriter) Close() error {
+	return w.Flush()
+}
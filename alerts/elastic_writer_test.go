@@ -0,0 +1,223 @@
+package alerts
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/elastic"
+)
+
+func TestNewECSDocument(t *testing.T) {
+	doc := newECSDocument(&Event{
+		EventType: "ip",
+		Severity:  4,
+		Flags:     []string{"c2"},
+		DestGeo:   &Geo{Country: "US", City: "Ashburn", ASN: 14618, ASOrg: "AMAZON-AES"},
+		Threats: map[string]Threat{
+			"c2_comm": Threat{Severity: 4, Description: "C2 communication"},
+		},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 0).UTC(),
+			SrcIP:     net.IPv4(1, 2, 3, 4),
+			SrcPort:   16830,
+			DestIP:    net.IPv4(4, 3, 2, 1),
+			DestPort:  443,
+			DestHost:  "alphasoc.com",
+			Proto:     "TCP",
+			BytesIn:   744,
+			BytesOut:  1376,
+			Ja3:       "e7d705a3286e19ea42f587b344ee6865",
+		},
+	}, "sensor")
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		Event struct {
+			Kind     string `json:"kind"`
+			Severity int    `json:"severity"`
+		} `json:"event"`
+		Threat struct {
+			Technique struct {
+				ID []string `json:"id"`
+			} `json:"technique"`
+		} `json:"threat"`
+		Source struct {
+			IP    string `json:"ip"`
+			Bytes int    `json:"bytes"`
+		} `json:"source"`
+		Destination struct {
+			Port   int    `json:"port"`
+			Domain string `json:"domain"`
+			Bytes  int    `json:"bytes"`
+			Geo    struct {
+				CountryISOCode string `json:"country_iso_code"`
+				CityName       string `json:"city_name"`
+			} `json:"geo"`
+			AS struct {
+				Number       int `json:"number"`
+				Organization struct {
+					Name string `json:"name"`
+				} `json:"organization"`
+			} `json:"as"`
+		} `json:"destination"`
+		Network struct {
+			Transport string `json:"transport"`
+		} `json:"network"`
+		TLS struct {
+			Client struct {
+				JA3 string `json:"ja3"`
+			} `json:"client"`
+		} `json:"tls"`
+		DNS *struct{} `json:"dns"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Event.Kind != "alert" || m.Event.Severity != 4 {
+		t.Fatalf("invalid event fields %s", b)
+	}
+	if len(m.Threat.Technique.ID) != 1 || m.Threat.Technique.ID[0] != "c2_comm" {
+		t.Fatalf("invalid threat fields %s", b)
+	}
+	if m.Source.IP != "1.2.3.4" || m.Source.Bytes != 1376 || m.Destination.Port != 443 || m.Destination.Bytes != 744 ||
+		m.Destination.Domain != "alphasoc.com" {
+		t.Fatalf("invalid source or destination fields %s", b)
+	}
+	if m.Destination.Geo.CountryISOCode != "US" || m.Destination.Geo.CityName != "Ashburn" ||
+		m.Destination.AS.Number != 14618 || m.Destination.AS.Organization.Name != "AMAZON-AES" {
+		t.Fatalf("invalid destination geo fields %s", b)
+	}
+	if m.Network.Transport != "tcp" || m.TLS.Client.JA3 != "e7d705a3286e19ea42f587b344ee6865" {
+		t.Fatalf("invalid network or tls fields %s", b)
+	}
+	if m.DNS != nil {
+		t.Fatalf("dns fields set for ip event %s", b)
+	}
+}
+
+func TestElasticWriter(t *testing.T) {
+	var docs []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nfr-alerts/_bulk" {
+			t.Errorf("invalid path - got %s", r.URL.Path)
+		}
+		s := bufio.NewScanner(r.Body)
+		for s.Scan() {
+			var action struct {
+				Create struct {
+					ID string `json:"_id"`
+				} `json:"create"`
+			}
+			if err := json.Unmarshal(s.Bytes(), &action); err != nil || action.Create.ID == "" {
+				t.Errorf("invalid bulk action - got %s", s.Text())
+			}
+			s.Scan()
+			var doc map[string]interface{}
+			if err := json.Unmarshal(s.Bytes(), &doc); err != nil {
+				t.Error(err)
+			}
+			docs = append(docs, doc)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+	}))
+	defer srv.Close()
+
+	w, err := NewElasticWriter(&elastic.Config{Hosts: []string{srv.URL}}, "nfr-alerts", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(newTestEvent("c2_comm")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(docs) != 1 {
+		t.Fatalf("invalid number of indexed documents - got %d; expected %d", len(docs), 1)
+	}
+	if dns := docs[0]["dns"].(map[string]interface{}); dns["question"].(map[string]interface{})["name"] != "virus.com" {
+		t.Fatalf("invalid dns fields - got %v", dns)
+	}
+}
+
+func TestElasticWriterRetry(t *testing.T) {
+	var (
+		requests int
+		indexed  = make(map[string]bool)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var items []string
+		s := bufio.NewScanner(r.Body)
+		for n := 0; s.Scan(); n++ {
+			var action struct {
+				Create struct {
+					ID string `json:"_id"`
+				} `json:"create"`
+			}
+			if err := json.Unmarshal(s.Bytes(), &action); err != nil {
+				t.Error(err)
+			}
+			s.Scan()
+
+			id := action.Create.ID
+			switch {
+			case indexed[id]:
+				items = append(items, `{"create":{"status":409,"error":{"type":"version_conflict_engine_exception"}}}`)
+			case requests == 1 && n > 0:
+				// first request fails partially
+				items = append(items, `{"create":{"status":429,"error":{"type":"es_rejected_execution_exception"}}}`)
+			default:
+				indexed[id] = true
+				items = append(items, `{"create":{"status":201}}`)
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"took":1,"errors":true,"items":[%s]}`, strings.Join(items, ","))
+	}))
+	defer srv.Close()
+
+	w, err := NewElasticWriter(&elastic.Config{Hosts: []string{srv.URL}}, "nfr-alerts", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []*Event{newTestEvent("c2_comm"), newTestEvent("young_domain")}
+	for _, ev := range events {
+		if err := w.Write(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err == nil {
+		t.Fatal("expected error of partially indexed batch")
+	}
+	if len(indexed) != 1 {
+		t.Fatalf("got %d indexed documents, expected 1", len(indexed))
+	}
+
+	// queue writes all alerts of the failed batch again
+	for _, ev := range events {
+		if err := w.Write(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(indexed) != 2 {
+		t.Fatalf("got %d indexed documents, expected 2", len(indexed))
+	}
+}
@@ -1,24 +1,32 @@
 package alerts
 
 import (
+	"io"
 	"os"
+
+	"github.com/alphasoc/nfr/rotate"
 )
 
 // JSONFileWriter implements Writer interface and writes alerts in json format.
 type FileWriter struct {
-	f      *os.File
+	f      io.WriteCloser
 	format Formatter
 }
 
 // NewJSONFileWriter creates new json file writer.
 func NewFileWriter(file string, format Formatter) (*FileWriter, error) {
+	return NewRotatedFileWriter(file, format, rotate.Config{})
+}
+
+// NewRotatedFileWriter creates new file writer, with file rotated according to rcfg.
+func NewRotatedFileWriter(file string, format Formatter, rcfg rotate.Config) (*FileWriter, error) {
 	switch file {
 	case "stdout":
 		return &FileWriter{os.Stdout, format}, nil
 	case "stderr":
 		return &FileWriter{os.Stderr, format}, nil
 	default:
-		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		f, err := rotate.Open(file, rcfg)
 		if err != nil {
 			return nil, err
 		}
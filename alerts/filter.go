@@ -0,0 +1,102 @@
+package alerts
+
+import "github.com/alphasoc/nfr/utils"
+
+// Filter selects alerts written to an output. Event type, groups and flags
+// are matched against the event, while severity, threat ids and policy
+// against each of its threats. Empty fields match everything.
+type Filter struct {
+	// MinSeverity of a threat.
+	MinSeverity int
+	// Threats ids to include and to exclude.
+	Threats        []string
+	ExcludeThreats []string
+	// Policy if set, then only policy (true) or non-policy (false) threats match.
+	Policy *bool
+	// EventTypes, e.g. dns, ip, http.
+	EventTypes []string
+	// Groups labels, event must belong to at least one of them.
+	Groups []string
+	// Flags, event must have at least one of them.
+	Flags []string
+}
+
+// matchThreat checks if threat matches the filter.
+func (f *Filter) matchThreat(tid string, threat Threat) bool {
+	if threat.Severity < f.MinSeverity {
+		return false
+	}
+	if len(f.Threats) > 0 && !utils.StringsContains(f.Threats, tid) {
+		return false
+	}
+	if utils.StringsContains(f.ExcludeThreats, tid) {
+		return false
+	}
+	return f.Policy == nil || *f.Policy == threat.Policy
+}
+
+// matchEvent checks if event type, groups and flags match the filter.
+func (f *Filter) matchEvent(event *Event) bool {
+	if len(f.EventTypes) > 0 && !utils.StringsContains(f.EventTypes, event.EventType) {
+		return false
+	}
+	if len(f.Groups) > 0 {
+		var found bool
+		for _, group := range event.Groups {
+			if utils.StringsContains(f.Groups, group.Label) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Flags) > 0 {
+		var found bool
+		for _, flag := range event.Flags {
+			if utils.StringsContains(f.Flags, flag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Apply returns the event with only matching threats, and false if none
+// of them matches. If some threats are filtered out, then a copy of the
+// event is returned, with the severity of remaining threats.
+func (f *Filter) Apply(event *Event) (*Event, bool) {
+	if f == nil {
+		return event, true
+	}
+	if !f.matchEvent(event) {
+		return nil, false
+	}
+
+	threats := make(map[string]Threat, len(event.Threats))
+	severity := 0
+	for tid, threat := range event.Threats {
+		if f.matchThreat(tid, threat) {
+			threats[tid] = threat
+			if threat.Severity > severity {
+				severity = threat.Severity
+			}
+		}
+	}
+	if len(threats) == 0 {
+		return nil, false
+	}
+	if len(threats) == len(event.Threats) {
+		return event, true
+	}
+
+	ev := *event
+	ev.Threats = threats
+	ev.Severity = severity
+	return &ev, true
+}
@@ -0,0 +1,62 @@
+package alerts
+
+import (
+	"testing"
+)
+
+func TestFilterApply(t *testing.T) {
+	event := &Event{
+		Severity:  4,
+		EventType: "dns",
+		Flags:     []string{"young_domain"},
+		Groups:    []Group{{Label: "servers"}},
+		Threats: map[string]Threat{
+			"c2_comm":       {Severity: 4},
+			"unusual_query": {Severity: 2},
+			"tor_usage":     {Severity: 3, Policy: true},
+		},
+	}
+	policy, nonPolicy := true, false
+
+	for _, tt := range []struct {
+		name     string
+		filter   *Filter
+		threats  []string
+		severity int
+	}{
+		{"nil", nil, []string{"c2_comm", "unusual_query", "tor_usage"}, 4},
+		{"min severity", &Filter{MinSeverity: 3}, []string{"c2_comm", "tor_usage"}, 4},
+		{"threats", &Filter{Threats: []string{"unusual_query"}}, []string{"unusual_query"}, 2},
+		{"exclude threats", &Filter{ExcludeThreats: []string{"c2_comm"}}, []string{"unusual_query", "tor_usage"}, 3},
+		{"policy", &Filter{Policy: &policy}, []string{"tor_usage"}, 3},
+		{"non-policy", &Filter{Policy: &nonPolicy, MinSeverity: 4}, []string{"c2_comm"}, 4},
+		{"event type", &Filter{EventTypes: []string{"ip"}}, nil, 0},
+		{"groups", &Filter{Groups: []string{"servers", "desktops"}}, []string{"c2_comm", "unusual_query", "tor_usage"}, 4},
+		{"other groups", &Filter{Groups: []string{"desktops"}}, nil, 0},
+		{"flags", &Filter{Flags: []string{"c2"}}, nil, 0},
+		{"no threats", &Filter{MinSeverity: 5}, nil, 0},
+	} {
+		ev, ok := tt.filter.Apply(event)
+		if ok != (tt.threats != nil) {
+			t.Fatalf("%s: invalid match - got %t; expected %t", tt.name, ok, tt.threats != nil)
+		}
+		if !ok {
+			continue
+		}
+		if len(ev.Threats) != len(tt.threats) {
+			t.Fatalf("%s: invalid number of threats - got %d; expected %d", tt.name, len(ev.Threats), len(tt.threats))
+		}
+		for _, tid := range tt.threats {
+			if _, ok := ev.Threats[tid]; !ok {
+				t.Fatalf("%s: threat %s filtered out", tt.name, tid)
+			}
+		}
+		if ev.Severity != tt.severity {
+			t.Fatalf("%s: invalid severity - got %d; expected %d", tt.name, ev.Severity, tt.severity)
+		}
+	}
+
+	if len(event.Threats) != 3 || event.Severity != 4 {
+		t.Fatalf("filter modified original event")
+	}
+}
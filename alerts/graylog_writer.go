@@ -3,6 +3,7 @@ package alerts
 import (
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -17,13 +18,15 @@ type GraylogWriter struct {
 	g        *gelf.Gelf
 	level    int
 	hostname string
+	progress sendProgress
 }
 
-// NewGraylogWriter creates new graylog writer.
-func NewGraylogWriter(uri string, level int) (*GraylogWriter, error) {
-	g, err := gelf.New(uri)
+// NewGraylogWriter creates new graylog writer. It connects to the server
+// on first write.
+func NewGraylogWriter(uri string, level int, cfg gelf.Config) (*GraylogWriter, error) {
+	g, err := gelf.NewWithConfig(uri, cfg)
 	if err != nil {
-		return nil, fmt.Errorf("connect to graylog send input failed: %s", err)
+		return nil, fmt.Errorf("graylog input: %s", err)
 	}
 
 	hostname, _ := os.Hostname()
@@ -34,14 +37,43 @@ func NewGraylogWriter(uri string, level int) (*GraylogWriter, error) {
 	}, nil
 }
 
-// Write writes alert response to graylog server.
+// Write writes alert response to graylog server. If the event is written
+// again after a failure, then only unsent messages are sent.
 func (w *GraylogWriter) Write(event *Event) error {
-	for tid, threat := range event.Threats {
+	for n, m := range w.messages(event) {
+		if w.progress.skip(event, n) {
+			continue
+		}
+		if err := w.g.Send(m); err != nil {
+			return err
+		}
+		w.progress.done(n)
+	}
+	w.progress = sendProgress{}
+	return nil
+}
+
+// messages returns gelf message for each threat of the event, ordered by threat id.
+func (w *GraylogWriter) messages(event *Event) []*gelf.Message {
+	ts := event.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	tids := make([]string, 0, len(event.Threats))
+	for tid := range event.Threats {
+		tids = append(tids, tid)
+	}
+	sort.Strings(tids)
+
+	var messages []*gelf.Message
+	for _, tid := range tids {
+		threat := event.Threats[tid]
 		m := &gelf.Message{
 			Version:      "1.1",
 			Host:         w.hostname,
 			ShortMessage: threat.Description,
-			Timestamp:    time.Now().Unix(),
+			Timestamp:    float64(ts.UnixNano()/int64(time.Millisecond)) / 1000,
 			Level:        w.level,
 			Extra: map[string]interface{}{
 				"severity":     threat.Severity,
@@ -49,26 +81,88 @@ func (w *GraylogWriter) Write(event *Event) error {
 				"flags":        strings.Join(event.Flags, ","),
 				"threat":       tid,
 				"engine_agent": client.DefaultUserAgent,
+				"event_type":   event.EventType,
 			},
 		}
 
 		m.Extra["original_event"] = event.Timestamp.String()
 		m.Extra["src_ip"] = event.SrcIP
-		m.Extra["query"] = event.Query
-		m.Extra["record_type"] = event.QueryType
 
-		m.Extra["protocol"] = event.Proto
-		m.Extra["src_port"] = event.SrcPort
-		m.Extra["dest_ip"] = event.DestIP
-		m.Extra["dest_port"] = event.DestPort
-		m.Extra["bytes_in"] = event.BytesIn
-		m.Extra["bytes_out"] = event.BytesOut
-		m.Extra["ja3"] = event.Ja3
-		if err := w.g.Send(m); err != nil {
-			return err
+		switch event.EventType {
+		case "dns":
+			m.Extra["query"] = event.Query
+			m.Extra["record_type"] = event.QueryType
+		case "ip":
+			m.Extra["protocol"] = event.Proto
+			m.Extra["src_port"] = event.SrcPort
+			m.Extra["dest_ip"] = event.DestIP
+			m.Extra["dest_port"] = event.DestPort
+			if event.DestHost != "" {
+				m.Extra["dest_host"] = event.DestHost
+			}
+			m.Extra["bytes_in"] = event.BytesIn
+			m.Extra["bytes_out"] = event.BytesOut
+		case "http":
+			if event.DestIP != nil {
+				m.Extra["dest_ip"] = event.DestIP
+			}
+			if event.DestPort != 0 {
+				m.Extra["dest_port"] = event.DestPort
+			}
+			if event.DestHost != "" {
+				m.Extra["dest_host"] = event.DestHost
+			}
+			m.Extra["url"] = event.URL
+			if event.Method != "" {
+				m.Extra["method"] = event.Method
+			}
+			if event.Status != 0 {
+				m.Extra["status"] = event.Status
+			}
+			if event.Action != "" {
+				m.Extra["action"] = event.Action
+			}
+			if event.ContentType != "" {
+				m.Extra["content_type"] = event.ContentType
+			}
+			if event.Referrer != "" {
+				m.Extra["referrer"] = event.Referrer
+			}
+			if event.UserAgent != "" {
+				m.Extra["user_agent"] = event.UserAgent
+			}
+		}
+		if event.Ja3 != "" {
+			m.Extra["ja3"] = event.Ja3
+		}
+		if event.Suppressed > 0 {
+			m.Extra["suppressed"] = event.Suppressed
+		}
+
+		m.Extra["src_host"] = event.SrcHost
+		m.Extra["src_mac"] = event.SrcMac
+		m.Extra["src_user"] = event.SrcUser
+		if event.Asset != nil {
+			m.Extra["asset_owner"] = event.Asset.Owner
+			m.Extra["asset_tag"] = event.Asset.Tag
+			m.Extra["asset_criticality"] = event.Asset.Criticality
 		}
+		if event.PcapFile != "" {
+			m.Extra["pcap_file"] = event.PcapFile
+		}
+		countries, cities, as := geoSummary(event)
+		if countries != "" {
+			m.Extra["dest_country"] = countries
+		}
+		if cities != "" {
+			m.Extra["dest_city"] = cities
+		}
+		if as != "" {
+			m.Extra["dest_as"] = as
+		}
+		messages = append(messages, m)
 	}
-	return nil
+	return messages
 }
 
 // Close closes a connecion with the graylog server.
@@ -0,0 +1,48 @@
+package alerts
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+)
+
+func TestGraylogMessages(t *testing.T) {
+	w := &GraylogWriter{level: 1, hostname: "nfr"}
+	event := &Event{
+		EventType: "http",
+		Threats:   map[string]Threat{"c2_communication": {Severity: 5, Description: "C2 communication"}},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 123e6).UTC(),
+			SrcIP:     net.IPv4(10, 0, 0, 1),
+			URL:       "http://example.com/index.html",
+			Method:    "GET",
+			Status:    200,
+			UserAgent: "curl/7.58.0",
+		},
+	}
+
+	messages := w.messages(event)
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, expected 1", len(messages))
+	}
+	m := messages[0]
+	if m.Timestamp != 1536242944.123 {
+		t.Fatalf("got timestamp %f, expected event timestamp", m.Timestamp)
+	}
+	for k, v := range map[string]interface{}{
+		"event_type": "http",
+		"url":        "http://example.com/index.html",
+		"method":     "GET",
+		"status":     int32(200),
+		"user_agent": "curl/7.58.0",
+	} {
+		if m.Extra[k] != v {
+			t.Fatalf("got %s=%v, expected %v", k, m.Extra[k], v)
+		}
+	}
+	if _, ok := m.Extra["query"]; ok {
+		t.Fatalf("unexpected dns field in http event")
+	}
+}
@@ -0,0 +1,192 @@
+package alerts
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+// Default kafka writer settings.
+const (
+	DefaultKafkaBatchSize = 100
+	DefaultKafkaTimeout   = 10 * time.Second
+)
+
+// KafkaConfig is a configuration of kafka writer.
+type KafkaConfig struct {
+	Brokers []string
+	Topic   string
+	// Key of messages. Possible values are: src_ip, threat or empty for no key.
+	Key string
+	// Acks required from brokers: all, leader or none.
+	Acks string
+
+	// BatchSize is the maximum number of messages produced in one request.
+	BatchSize int
+	// Timeout of a single request.
+	Timeout time.Duration
+
+	TLS *tls.Config
+	// SASLMechanism can be plain, scram-sha-256, scram-sha-512 or empty.
+	SASLMechanism string
+	Username      string
+	Password      string
+}
+
+// kafkaProducer produces messages to kafka, it's implemented by *kafka.Writer.
+type kafkaProducer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// KafkaWriter implements Writer interface and produces api alerts
+// to kafka topic. Alerts are buffered and produced on Flush,
+// which returns after brokers acknowledged them.
+type KafkaWriter struct {
+	cfg  KafkaConfig
+	w    kafkaProducer
+	f    Formatter
+	msgs []kafka.Message
+}
+
+// NewKafkaWriter creates new kafka writer.
+func NewKafkaWriter(cfg KafkaConfig, format Formatter) (*KafkaWriter, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka brokers required")
+	}
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("kafka topic required")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultKafkaBatchSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultKafkaTimeout
+	}
+
+	var acks kafka.RequiredAcks
+	switch cfg.Acks {
+	case "", "all":
+		acks = kafka.RequireAll
+	case "leader":
+		acks = kafka.RequireOne
+	case "none":
+		acks = kafka.RequireNone
+	default:
+		return nil, fmt.Errorf("invalid kafka acks %s", cfg.Acks)
+	}
+
+	mechanism, err := newSASLMechanism(cfg.SASLMechanism, cfg.Username, cfg.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KafkaWriter{
+		cfg: cfg,
+		w: &kafka.Writer{
+			Addr:         kafka.TCP(cfg.Brokers...),
+			Topic:        cfg.Topic,
+			Balancer:     &kafka.Hash{},
+			BatchSize:    cfg.BatchSize,
+			BatchTimeout: 10 * time.Millisecond,
+			ReadTimeout:  cfg.Timeout,
+			WriteTimeout: cfg.Timeout,
+			RequiredAcks: acks,
+			Transport: &kafka.Transport{
+				DialTimeout: cfg.Timeout,
+				TLS:         cfg.TLS,
+				SASL:        mechanism,
+			},
+		},
+		f: format,
+	}, nil
+}
+
+// newSASLMechanism creates sasl mechanism, or returns nil if name is empty.
+func newSASLMechanism(name, username, password string) (sasl.Mechanism, error) {
+	switch name {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: username, Password: password}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, username, password)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, username, password)
+	}
+	return nil, fmt.Errorf("invalid kafka sasl mechanism %s", name)
+}
+
+// kafkaKey returns the message key of the event.
+func kafkaKey(key string, event *Event) []byte {
+	switch key {
+	case "src_ip":
+		if event.SrcIP != nil {
+			return []byte(event.SrcIP.String())
+		}
+	case "threat":
+		// the most severe threat, ties are broken by id, so keys are stable
+		var tids []string
+		for tid := range event.Threats {
+			tids = append(tids, tid)
+		}
+		sort.Slice(tids, func(i, j int) bool {
+			si, sj := event.Threats[tids[i]].Severity, event.Threats[tids[j]].Severity
+			if si != sj {
+				return si > sj
+			}
+			return tids[i] < tids[j]
+		})
+		if len(tids) > 0 {
+			return []byte(tids[0])
+		}
+	}
+	return nil
+}
+
+// Write adds alert to the batch, and produces it if the batch is full.
+func (w *KafkaWriter) Write(event *Event) error {
+	bs, err := w.f.Format(event)
+	if err != nil {
+		return err
+	}
+
+	key := kafkaKey(w.cfg.Key, event)
+	for n := range bs {
+		w.msgs = append(w.msgs, kafka.Message{Key: key, Value: bs[n], Time: event.Timestamp})
+	}
+	if len(w.msgs) >= w.cfg.BatchSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush produces all buffered alerts and waits for acknowledgements.
+func (w *KafkaWriter) Flush() error {
+	if len(w.msgs) == 0 {
+		return nil
+	}
+	msgs := w.msgs
+	w.msgs = nil
+
+	if err := w.w.WriteMessages(context.Background(), msgs...); err != nil {
+		return fmt.Errorf("produce %d alerts to kafka failed: %s", len(msgs), err)
+	}
+	return nil
+}
+
+// Close produces buffered alerts and closes connections to brokers.
+func (w *KafkaWriter) Close() error {
+	err := w.Flush()
+	if cerr := w.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package alerts
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKafkaKey(t *testing.T) {
+	event := &Event{
+		Threats: map[string]Threat{
+			"c2_comm":       Threat{Severity: 4},
+			"beaconing":     Threat{Severity: 4},
+			"young_domain":  Threat{Severity: 2},
+			"unusual_query": Threat{Severity: 1},
+		},
+	}
+	event.SrcIP = net.IPv4(10, 0, 0, 1)
+
+	for _, tt := range []struct {
+		key      string
+		expected string
+	}{
+		{"src_ip", "10.0.0.1"},
+		{"threat", "beaconing"},
+		{"", ""},
+	} {
+		if key := string(kafkaKey(tt.key, event)); key != tt.expected {
+			t.Fatalf("invalid %q message key - got %s; expected %s", tt.key, key, tt.expected)
+		}
+	}
+}
+
+func TestNewKafkaWriter(t *testing.T) {
+	cfg := KafkaConfig{Brokers: []string{"127.0.0.1:9092"}, Topic: "alerts"}
+	if _, err := NewKafkaWriter(cfg, FormatterJSON{}); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Acks = "some"
+	if _, err := NewKafkaWriter(cfg, FormatterJSON{}); err == nil {
+		t.Fatal("expected error for invalid acks")
+	}
+
+	cfg.Acks = "all"
+	cfg.SASLMechanism = "scram-sha-512"
+	cfg.Username, cfg.Password = "nfr", "secret"
+	if _, err := NewKafkaWriter(cfg, FormatterJSON{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeProducer stores produced messages, or fails if err is set.
+type fakeProducer struct {
+	err  error
+	msgs []kafka.Message
+}
+
+func (p *fakeProducer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func (p *fakeProducer) Close() error { return nil }
+
+func TestKafkaWriterFlushFailed(t *testing.T) {
+	w, err := NewKafkaWriter(KafkaConfig{Brokers: []string{"127.0.0.1:9092"}, Topic: "alerts"}, FormatterJSON{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProducer{err: errors.New("leader not available")}
+	w.w = p
+
+	if err := w.Write(newTestEvent("c2_comm")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err == nil {
+		t.Fatal("expected flush error")
+	}
+
+	q, err := newWriterQueue("kafka", w, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.enqueue([]*Event{newTestEvent("c2_comm"), newTestEvent("young_domain")})
+
+	// failed batch is dropped by the writer, so alerts stay in the queue
+	if q.write() {
+		t.Fatal("expected write failure")
+	}
+	if stats := q.Stats(); stats.Written != 0 || stats.Failed != 1 || len(q.events) != 2 {
+		t.Fatalf("invalid queue after failed flush %+v, %d pending alerts", stats, len(q.events))
+	}
+
+	p.err = nil
+	if !q.write() {
+		t.Fatal(q.Stats().LastError)
+	}
+	if len(p.msgs) != 2 || len(q.events) != 0 {
+		t.Fatalf("got %d produced messages and %d pending alerts, expected 2 and 0", len(p.msgs), len(q.events))
+	}
+}
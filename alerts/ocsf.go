@@ -0,0 +1,324 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// OCSF classes alerts can be mapped to.
+const (
+	OCSFDetectionFinding = "detection_finding"
+	OCSFNetworkActivity  = "network_activity"
+)
+
+// ocsfVersion is the version of OCSF schema of formatted events.
+const ocsfVersion = "1.1.0"
+
+// ocsfSeverities are names of OCSF severity ids.
+var ocsfSeverities = []string{"Unknown", "Informational", "Low", "Medium", "High", "Critical"}
+
+// ocsfEvent is an alert mapped to OCSF event class.
+type ocsfEvent struct {
+	ActivityID   int    `json:"activity_id"`
+	ActivityName string `json:"activity_name"`
+	CategoryUID  int    `json:"category_uid"`
+	CategoryName string `json:"category_name"`
+	ClassUID     int    `json:"class_uid"`
+	ClassName    string `json:"class_name"`
+	TypeUID      int    `json:"type_uid"`
+	TypeName     string `json:"type_name"`
+	SeverityID   int    `json:"severity_id"`
+	Severity     string `json:"severity"`
+	StatusID     int    `json:"status_id,omitempty"`
+	Status       string `json:"status,omitempty"`
+	Time         int64  `json:"time"`
+	Message      string `json:"message"`
+	Count        int    `json:"count,omitempty"`
+
+	Metadata ocsfMetadata `json:"metadata"`
+
+	// Detection Finding
+	FindingInfo *ocsfFindingInfo `json:"finding_info,omitempty"`
+	Evidences   []ocsfEvidence   `json:"evidences,omitempty"`
+
+	// Network Activity
+	SrcEndpoint    *ocsfEndpoint       `json:"src_endpoint,omitempty"`
+	DstEndpoint    *ocsfEndpoint       `json:"dst_endpoint,omitempty"`
+	ConnectionInfo *ocsfConnectionInfo `json:"connection_info,omitempty"`
+	Traffic        *ocsfTraffic        `json:"traffic,omitempty"`
+
+	Unmapped map[string]interface{} `json:"unmapped,omitempty"`
+}
+
+type ocsfMetadata struct {
+	Version string      `json:"version"`
+	UID     string      `json:"uid"`
+	Product ocsfProduct `json:"product"`
+	Labels  []string    `json:"labels,omitempty"`
+}
+
+type ocsfProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+	Version    string `json:"version"`
+}
+
+type ocsfFindingInfo struct {
+	UID      string       `json:"uid"`
+	Title    string       `json:"title"`
+	Types    []string     `json:"types"`
+	Analytic ocsfAnalytic `json:"analytic"`
+}
+
+type ocsfAnalytic struct {
+	UID    string `json:"uid"`
+	Name   string `json:"name"`
+	TypeID int    `json:"type_id"`
+	Type   string `json:"type"`
+}
+
+type ocsfEvidence struct {
+	SrcEndpoint    *ocsfEndpoint       `json:"src_endpoint,omitempty"`
+	DstEndpoint    *ocsfEndpoint       `json:"dst_endpoint,omitempty"`
+	ConnectionInfo *ocsfConnectionInfo `json:"connection_info,omitempty"`
+	Query          *ocsfDNSQuery       `json:"query,omitempty"`
+	HTTPRequest    *ocsfHTTPRequest    `json:"http_request,omitempty"`
+}
+
+type ocsfEndpoint struct {
+	IP               string                `json:"ip,omitempty"`
+	Port             int                   `json:"port,omitempty"`
+	Hostname         string                `json:"hostname,omitempty"`
+	MAC              string                `json:"mac,omitempty"`
+	Owner            *ocsfUser             `json:"owner,omitempty"`
+	Location         *ocsfLocation         `json:"location,omitempty"`
+	AutonomousSystem *ocsfAutonomousSystem `json:"autonomous_system,omitempty"`
+}
+
+type ocsfLocation struct {
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+}
+
+type ocsfAutonomousSystem struct {
+	Number int    `json:"number,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+type ocsfUser struct {
+	Name string `json:"name"`
+}
+
+type ocsfConnectionInfo struct {
+	ProtocolName string `json:"protocol_name"`
+}
+
+type ocsfTraffic struct {
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+}
+
+type ocsfDNSQuery struct {
+	Hostname string `json:"hostname"`
+	Type     string `json:"type,omitempty"`
+}
+
+type ocsfHTTPRequest struct {
+	URL        ocsfURL `json:"url"`
+	HTTPMethod string  `json:"http_method,omitempty"`
+	UserAgent  string  `json:"user_agent,omitempty"`
+	Referrer   string  `json:"referrer,omitempty"`
+}
+
+type ocsfURL struct {
+	URLString string `json:"url_string"`
+}
+
+// FormatterOCSF formats alerts as OCSF events, one per threat.
+type FormatterOCSF struct {
+	class   string
+	product ocsfProduct
+}
+
+// NewFormatterOCSF creates OCSF formatter of detection_finding or network_activity class.
+func NewFormatterOCSF(class string) (*FormatterOCSF, error) {
+	if class == "" {
+		class = OCSFDetectionFinding
+	}
+	if class != OCSFDetectionFinding && class != OCSFNetworkActivity {
+		return nil, fmt.Errorf("unsupported ocsf class %s", class)
+	}
+	return &FormatterOCSF{
+		class: class,
+		product: ocsfProduct{
+			Name:       DefaultLogProduct,
+			VendorName: DefaultLogVendor,
+			Version:    strings.TrimPrefix(DefaultLogVersion, "v"),
+		},
+	}, nil
+}
+
+// Format formats each threat of the event as a separate OCSF event.
+func (f *FormatterOCSF) Format(event *Event) ([][]byte, error) {
+	tids := make([]string, 0, len(event.Threats))
+	for tid := range event.Threats {
+		tids = append(tids, tid)
+	}
+	sort.Strings(tids)
+
+	var res [][]byte
+	for _, tid := range tids {
+		b, err := json.Marshal(f.newEvent(event, tid, event.Threats[tid]))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, b)
+	}
+	return res, nil
+}
+
+// newEvent maps the event threat to OCSF event.
+func (f *FormatterOCSF) newEvent(event *Event, tid string, threat Threat) *ocsfEvent {
+	severity := threat.Severity
+	if severity < 0 || severity >= len(ocsfSeverities) {
+		severity = 0
+	}
+
+	e := &ocsfEvent{
+		SeverityID: severity,
+		Severity:   ocsfSeverities[severity],
+		Time:       event.Timestamp.UnixNano() / 1e6,
+		Message:    threat.Description,
+		Metadata: ocsfMetadata{
+			Version: ocsfVersion,
+			UID:     alertUID(event, tid),
+			Product: f.product,
+			Labels:  event.Flags,
+		},
+		Unmapped: map[string]interface{}{
+			"threat": tid,
+			"policy": threat.Policy,
+		},
+	}
+	if event.Suppressed > 0 {
+		e.Count = event.Suppressed + 1
+	}
+	if len(event.Groups) > 0 {
+		groups := make([]string, len(event.Groups))
+		for n := range event.Groups {
+			groups[n] = event.Groups[n].Label
+		}
+		e.Unmapped["groups"] = groups
+	}
+	if event.Asset != nil {
+		e.Unmapped["asset"] = event.Asset
+	}
+	if event.PcapFile != "" {
+		e.Unmapped["pcap_file"] = event.PcapFile
+	}
+	if len(event.ResolvedGeo) > 0 {
+		e.Unmapped["resolved_geo"] = event.ResolvedGeo
+	}
+	if event.Ja3 != "" {
+		e.Unmapped["ja3"] = event.Ja3
+	}
+
+	src := &ocsfEndpoint{
+		IP:       ocsfIP(event.SrcIP),
+		Port:     int(event.SrcPort),
+		Hostname: event.SrcHost,
+		MAC:      event.SrcMac,
+	}
+	if event.SrcUser != "" {
+		src.Owner = &ocsfUser{Name: event.SrcUser}
+	}
+	var (
+		dst  *ocsfEndpoint
+		conn *ocsfConnectionInfo
+	)
+	if event.DestIP != nil || event.DestPort != 0 {
+		dst = &ocsfEndpoint{IP: ocsfIP(event.DestIP), Port: int(event.DestPort), Hostname: event.DestHost}
+		if geo := event.DestGeo; geo != nil {
+			if geo.Country != "" || geo.City != "" {
+				dst.Location = &ocsfLocation{Country: geo.Country, City: geo.City}
+			}
+			if geo.ASN != 0 || geo.ASOrg != "" {
+				dst.AutonomousSystem = &ocsfAutonomousSystem{Number: int(geo.ASN), Name: geo.ASOrg}
+			}
+		}
+	}
+	if event.Proto != "" {
+		conn = &ocsfConnectionInfo{ProtocolName: strings.ToLower(event.Proto)}
+	}
+
+	switch f.class {
+	case OCSFDetectionFinding:
+		e.ActivityID, e.ActivityName = 1, "Create"
+		e.CategoryUID, e.CategoryName = 2, "Findings"
+		e.ClassUID, e.ClassName = 2004, "Detection Finding"
+		e.StatusID, e.Status = 1, "New"
+		e.FindingInfo = &ocsfFindingInfo{
+			UID:   e.Metadata.UID,
+			Title: threat.Description,
+			Types: []string{event.EventType},
+			Analytic: ocsfAnalytic{
+				UID:    tid,
+				Name:   threat.Description,
+				TypeID: 1,
+				Type:   "Rule",
+			},
+		}
+
+		evidence := ocsfEvidence{SrcEndpoint: src, DstEndpoint: dst, ConnectionInfo: conn}
+		switch event.EventType {
+		case "dns":
+			evidence.Query = &ocsfDNSQuery{Hostname: event.Query, Type: event.QueryType}
+		case "http":
+			evidence.HTTPRequest = &ocsfHTTPRequest{
+				URL:        ocsfURL{URLString: event.URL},
+				HTTPMethod: event.Method,
+				UserAgent:  event.UserAgent,
+				Referrer:   event.Referrer,
+			}
+		}
+		e.Evidences = []ocsfEvidence{evidence}
+	case OCSFNetworkActivity:
+		e.ActivityID, e.ActivityName = 6, "Traffic"
+		e.CategoryUID, e.CategoryName = 4, "Network Activity"
+		e.ClassUID, e.ClassName = 4001, "Network Activity"
+		e.SrcEndpoint = src
+		e.DstEndpoint = dst
+		e.ConnectionInfo = conn
+		if event.EventType == "ip" {
+			e.Traffic = &ocsfTraffic{BytesIn: event.BytesIn, BytesOut: event.BytesOut}
+		}
+		switch event.EventType {
+		case "dns":
+			e.DstEndpoint = &ocsfEndpoint{Hostname: event.Query}
+			e.Unmapped["query_type"] = event.QueryType
+		case "http":
+			e.Unmapped["url"] = event.URL
+			if event.Method != "" {
+				e.Unmapped["http_method"] = event.Method
+			}
+		}
+	}
+
+	e.TypeUID = e.ClassUID*100 + e.ActivityID
+	e.TypeName = e.ClassName + ": " + e.ActivityName
+	if event.Status != 0 {
+		e.Unmapped["http_status"] = event.Status
+	}
+	return e
+}
+
+// ocsfIP returns ip address string, or empty string for nil address.
+func ocsfIP(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
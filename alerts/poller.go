@@ -2,11 +2,17 @@
 package alerts
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/utils"
 )
 
 // Poller polls alerts from AlphaSOC api and user logger
@@ -14,24 +20,178 @@ import (
 type Poller struct {
 	c          client.Client
 	writers    []Writer
+	filters    []*Filter
+	queues     []*writerQueue
+	queueDir   string
+	queueSize  int
+	suppressor *Suppressor
+	enricher   Enricher
+	capture    Capture
+	recorder   Recorder
 	ticker     *time.Ticker
 	follow     string
 	followFile string
 	mapper     *AlertMapper
+
+	// mx synchronizes processing of polled and pushed events.
+	mx sync.Mutex
+	// recorderStats are counters of the recorder, guarded by mx.
+	recorderStats RecorderStats
+	// local events pushed for processing.
+	local chan Event
+}
+
+// RecorderStats are counters of alerts passed to the recorder.
+type RecorderStats struct {
+	// Recorded alerts.
+	Recorded uint64
+	// Failed alerts, which were not recorded.
+	Failed uint64
+	// LastError of the recorder.
+	LastError error
 }
 
+// localQueueSize is the maximum number of pushed events pending for processing.
+const localQueueSize = 1000
+
 // NewPoller creates new poller base on give client and writer.
 func NewPoller(c client.Client, mapper *AlertMapper) *Poller {
 	return &Poller{
 		c:       c,
 		writers: make([]Writer, 0),
 		mapper:  mapper,
+		local:   make(chan Event, localQueueSize),
 	}
 }
 
+// SetQueue sets the maximum number of alerts pending for each writer, and
+// the directory where pending alerts are stored. If dir is empty, then
+// pending alerts are kept only in memory. It must be called before adding writers.
+func (p *Poller) SetQueue(dir string, size int) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	p.queueDir = dir
+	p.queueSize = size
+	return nil
+}
+
+// SetSuppressor sets suppressor of repeated alerts.
+func (p *Poller) SetSuppressor(s *Suppressor) {
+	p.suppressor = s
+}
+
+// SetEnricher sets enricher of alerts, used before alerts are suppressed and written.
+func (p *Poller) SetEnricher(e Enricher) {
+	p.enricher = e
+}
+
+// SetCapture sets capture of alerts packets, used after alerts are enriched.
+func (p *Poller) SetCapture(c Capture) {
+	p.capture = c
+}
+
+// SetRecorder sets recorder of all alerts, used after alerts are enriched.
+// Recording is best-effort, so alerts are written also if the recorder fails.
+func (p *Poller) SetRecorder(r Recorder) {
+	p.recorder = r
+}
+
+// RecorderStats returns counters of the recorder.
+func (p *Poller) RecorderStats() RecorderStats {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	return p.recorderStats
+}
+
 // AddWriter adds writer to poller.
-func (p *Poller) AddWriter(w Writer) {
+func (p *Poller) AddWriter(w Writer) error {
+	return p.AddFilteredWriter(w, nil, "")
+}
+
+// AddFilteredWriter adds writer to poller, which gets only alerts
+// matching the filter. If filter is nil, then all alerts are written.
+// Each writer has its own queue, so failing writer doesn't block others.
+// The queue is named by the writer type and id of the output, e.g. its url,
+// so pending alerts stay with the output when other outputs are changed.
+func (p *Poller) AddFilteredWriter(w Writer, f *Filter, id string) error {
+	name := p.queueName(w, id)
+	var file string
+	if p.queueDir != "" {
+		file = filepath.Join(p.queueDir, "alerts-queue-"+name)
+	}
+
+	q, err := newWriterQueue(name, w, file, p.queueSize)
+	if err != nil {
+		return fmt.Errorf("load %s alerts queue: %s", name, err)
+	}
+	q.start()
+
 	p.writers = append(p.writers, w)
+	p.filters = append(p.filters, f)
+	p.queues = append(p.queues, q)
+	return nil
+}
+
+// queueName returns unique name of the writer queue.
+func (p *Poller) queueName(w Writer, id string) string {
+	name := writerName(w)
+	if id != "" {
+		sum := sha1.Sum([]byte(id))
+		name += "-" + hex.EncodeToString(sum[:4])
+	}
+
+	// outputs of the same type and id are told apart by their order
+	taken := func(name string) bool {
+		for _, q := range p.queues {
+			if q.name == name {
+				return true
+			}
+		}
+		return false
+	}
+	unique := name
+	for n := 2; taken(unique); n++ {
+		unique = fmt.Sprintf("%s-%d", name, n)
+	}
+	return unique
+}
+
+// Stats returns counters of each writer.
+func (p *Poller) Stats() []WriterStats {
+	stats := make([]WriterStats, len(p.queues))
+	for n := range p.queues {
+		stats[n] = p.queues[n].Stats()
+	}
+	return stats
+}
+
+// Close processes pushed events, which are still pending, stops writing
+// alerts and closes the writers. Pending alerts are kept in the queue files,
+// or they are written once more, if queues are kept only in memory.
+func (p *Poller) Close() error {
+	var events []Event
+	for more := true; more; {
+		select {
+		case ev := <-p.local:
+			events = append(events, ev)
+		default:
+			more = false
+		}
+	}
+	err := p.process(events)
+
+	// wait for events processed by DoLocal
+	p.mx.Lock()
+	defer p.mx.Unlock()
+	for _, q := range p.queues {
+		if cerr := q.close(); cerr != nil && err == nil {
+			err = fmt.Errorf("close %s output: %s", q.name, cerr)
+		}
+	}
+	return err
 }
 
 // SetFollowDataFile sets file for storing follow id.
@@ -82,18 +242,16 @@ func (p *Poller) do(interval time.Duration, maxTries int) error {
 		}
 		more = alerts.More
 
-		if len(alerts.Alerts) == 0 {
-			continue
+		var newEvents []Event
+		if len(alerts.Alerts) > 0 {
+			newEvents = p.mapper.Map(alerts).Events
+		}
+		if err := p.process(newEvents); err != nil {
+			return err
 		}
 
-		newAlerts := p.mapper.Map(alerts)
-
-		for _, w := range p.writers {
-			for _, ev := range newAlerts.Events {
-				if err := w.Write(&ev); err != nil {
-					return err
-				}
-			}
+		if len(alerts.Alerts) == 0 {
+			continue
 		}
 
 		if p.follow == alerts.Follow {
@@ -110,6 +268,192 @@ func (p *Poller) do(interval time.Duration, maxTries int) error {
 	return nil
 }
 
+// process enriches, captures packets of, records and suppresses new events,
+// and passes them to writers queues. Summaries of suppressed alerts are
+// passed also if there are no new events.
+func (p *Poller) process(newEvents []Event) error {
+	// enrichers may resolve names over network, so it's done
+	// before the lock to not hold up other events meanwhile
+	p.enrich(newEvents)
+
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	var events []*Event
+	now := time.Now()
+	if p.suppressor != nil {
+		events = p.suppressor.Expire(now)
+	}
+
+	if len(newEvents) > 0 {
+		if p.capture != nil {
+			for i := range newEvents {
+				newEvents[i].PcapFile = p.capture.Capture(&newEvents[i])
+			}
+		}
+		if p.recorder != nil {
+			// failing history must not stop writing alerts to outputs
+			if err := p.recorder.Record(newEvents); err != nil {
+				p.recorderStats.Failed += uint64(len(newEvents))
+				p.recorderStats.LastError = err
+			} else {
+				p.recorderStats.Recorded += uint64(len(newEvents))
+			}
+		}
+		if p.suppressor != nil {
+			events = append(events, p.suppressor.Apply(now, newEvents)...)
+		} else {
+			for i := range newEvents {
+				events = append(events, &newEvents[i])
+			}
+		}
+	}
+
+	// alerts are written by writers queues, so poller
+	// progress doesn't depend on health of the outputs
+	for n, q := range p.queues {
+		var filtered []*Event
+		for _, ev := range events {
+			if ev, ok := p.filters[n].Apply(ev); ok {
+				filtered = append(filtered, ev)
+			}
+		}
+		q.enqueue(filtered)
+	}
+
+	if p.suppressor != nil {
+		return p.suppressor.Save()
+	}
+	return nil
+}
+
+// enrichWorkers limits events enriched concurrently.
+const enrichWorkers = 16
+
+// enrich fills events with enricher, if it's set. Events are enriched
+// concurrently, so slow lookups of different addresses don't add up.
+func (p *Poller) enrich(events []Event) {
+	if p.enricher == nil || len(events) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, enrichWorkers)
+	for i := range events {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(ev *Event) {
+			defer wg.Done()
+			p.enricher.Enrich(ev)
+			<-sem
+		}(&events[i])
+	}
+	wg.Wait()
+}
+
+// Push adds event detected locally, e.g. matched with indicators of compromise,
+// which is then processed by DoLocal the same way as polled alerts. Groups of
+// the event are set by its source ip. Push doesn't block, and it returns false
+// if the event was dropped, because too many events are pending.
+func (p *Poller) Push(ev *Event) bool {
+	ev.Groups = p.mapper.srcGroups(ev.SrcIP)
+	select {
+	case p.local <- *ev:
+		return true
+	default:
+		return false
+	}
+}
+
+// DoLocal processes pushed events. If the error occurs DoLocal should be called again.
+func (p *Poller) DoLocal() error {
+	for ev := range p.local {
+		events := []Event{ev}
+		// take also other pending events
+		for more := true; more && len(events) < localQueueSize; {
+			select {
+			case ev := <-p.local:
+				events = append(events, ev)
+			default:
+				more = false
+			}
+		}
+		if err := p.process(events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fetch fetches alerts of events between after and before time, and writes
+// them directly to the writers with names in outputs, or all writers if outputs
+// is empty. Follow id of the poller is not changed, and alerts are neither
+// suppressed nor recorded. It returns the number of written alerts.
+func (p *Poller) Fetch(after, before time.Time, outputs []string) (int, error) {
+	var writers []int
+	for n, w := range p.writers {
+		if len(outputs) == 0 || utils.StringsContains(outputs, writerName(w)) {
+			writers = append(writers, n)
+		}
+	}
+	names := make([]string, len(p.writers))
+	for n, w := range p.writers {
+		names[n] = writerName(w)
+	}
+	for _, name := range outputs {
+		if !utils.StringsContains(names, name) {
+			return 0, fmt.Errorf("no %s output configured", name)
+		}
+	}
+	if len(writers) == 0 {
+		return 0, fmt.Errorf("no outputs configured")
+	}
+
+	var (
+		follow string
+		count  int
+	)
+	for {
+		alerts, err := p.c.AlertsRange(follow, after, before)
+		if err == client.ErrTooManyRequests {
+			time.Sleep(30 * time.Second)
+			continue
+		} else if err != nil {
+			return count, err
+		}
+
+		if len(alerts.Alerts) > 0 {
+			newAlerts := p.mapper.Map(alerts)
+			p.enrich(newAlerts.Events)
+			for i := range newAlerts.Events {
+				ev := &newAlerts.Events[i]
+				for _, n := range writers {
+					if ev, ok := p.filters[n].Apply(ev); ok {
+						if err := p.writers[n].Write(ev); err != nil {
+							return count, fmt.Errorf("%s output: %s", writerName(p.writers[n]), err)
+						}
+					}
+				}
+				count++
+			}
+		}
+
+		if !alerts.More || alerts.Follow == "" || alerts.Follow == follow {
+			break
+		}
+		follow = alerts.Follow
+	}
+
+	for _, n := range writers {
+		if f, ok := p.writers[n].(Flusher); ok {
+			if err := f.Flush(); err != nil {
+				return count, fmt.Errorf("%s output: %s", writerName(p.writers[n]), err)
+			}
+		}
+	}
+	return count, nil
+}
+
 // stop stops poller do, by stoping ticker.
 func (p *Poller) stop() {
 	if p.ticker != nil {
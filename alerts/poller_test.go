@@ -2,9 +2,12 @@
 package alerts
 
 import (
+	"errors"
 	"io/ioutil"
+	"net"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/groups"
@@ -33,3 +36,162 @@ func TestPollerDo(t *testing.T) {
 		t.Fatal("no alerts should be written to file")
 	}
 }
+
+// rangeClient returns alerts range in pages.
+type rangeClient struct {
+	client.MockAlphaSOCClient
+	pages   []*client.AlertsResponse
+	follows []string
+}
+
+func (c *rangeClient) AlertsRange(follow string, after, before time.Time) (*client.AlertsResponse, error) {
+	c.follows = append(c.follows, follow)
+	resp := c.pages[0]
+	c.pages = c.pages[1:]
+	return resp, nil
+}
+
+func TestPollerFetch(t *testing.T) {
+	threats := map[string]client.Threat{"c2_comm": {Severity: 4}}
+	c := &rangeClient{pages: []*client.AlertsResponse{
+		{Follow: "2", More: true, Threats: threats, Alerts: []client.Alert{{EventType: "dns", Threats: []string{"c2_comm"}}}},
+		{Follow: "3", Threats: threats, Alerts: []client.Alert{{EventType: "ip", Threats: []string{"c2_comm"}}}},
+	}}
+
+	p := NewPoller(c, NewAlertMapper(groups.New()))
+	defer p.Close()
+	p.follow = "1"
+
+	w := &testWriter{}
+	if err := p.AddWriter(w); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := p.Fetch(time.Now().Add(-time.Hour), time.Now(), []string{"syslog"}); err == nil {
+		t.Fatal("expected error for not configured output")
+	}
+
+	count, err := p.Fetch(time.Now().Add(-time.Hour), time.Now(), []string{"test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(w.events) != 2 {
+		t.Fatalf("got %d alerts, %d written; expected 2", count, len(w.events))
+	}
+	if len(c.follows) != 2 || c.follows[0] != "" || c.follows[1] != "2" {
+		t.Fatalf("invalid pages follow %v", c.follows)
+	}
+	if p.follow != "1" {
+		t.Fatalf("poller follow changed to %s", p.follow)
+	}
+}
+
+func TestPollerPush(t *testing.T) {
+	p := NewPoller(client.NewMock(), NewAlertMapper(groups.New()))
+	defer p.Close()
+
+	w := &testWriter{}
+	if err := p.AddWriter(w); err != nil {
+		t.Fatal(err)
+	}
+	go p.DoLocal()
+
+	for i := 0; i < 3; i++ {
+		if !p.Push(&Event{EventType: "dns", Threats: map[string]Threat{"ioc_local": {Severity: 4}}}) {
+			t.Fatal("event dropped")
+		}
+	}
+	waitWritten(t, w, 3)
+}
+
+// testCapture captures packets of events to files named by source ip.
+type testCapture struct{}
+
+func (testCapture) Capture(ev *Event) string {
+	if ev.SrcIP == nil {
+		return ""
+	}
+	return ev.SrcIP.String() + ".pcap"
+}
+
+func TestPollerCapture(t *testing.T) {
+	p := NewPoller(client.NewMock(), NewAlertMapper(groups.New()))
+	defer p.Close()
+	p.SetCapture(testCapture{})
+
+	w := &testWriter{}
+	if err := p.AddWriter(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.process([]Event{
+		{EventType: "ip", EventUnified: client.EventUnified{SrcIP: net.IPv4(10, 0, 0, 1)}},
+		{EventType: "dns"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	waitWritten(t, w, 2)
+
+	if w.events[0].PcapFile != "10.0.0.1.pcap" || w.events[1].PcapFile != "" {
+		t.Fatalf("invalid pcap files %q %q", w.events[0].PcapFile, w.events[1].PcapFile)
+	}
+}
+
+// failingRecorder fails to record events.
+type failingRecorder struct{}
+
+func (failingRecorder) Record([]Event) error {
+	return errors.New("disk full")
+}
+
+func TestPollerFailingRecorder(t *testing.T) {
+	p := NewPoller(client.NewMock(), NewAlertMapper(groups.New()))
+	defer p.Close()
+	p.SetRecorder(failingRecorder{})
+
+	w := &testWriter{}
+	if err := p.AddWriter(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.process([]Event{{EventType: "dns"}, {EventType: "ip"}}); err != nil {
+		t.Fatal(err)
+	}
+	waitWritten(t, w, 2)
+
+	if stats := p.RecorderStats(); stats.Failed != 2 || stats.Recorded != 0 || stats.LastError == nil {
+		t.Fatalf("invalid recorder stats %+v", stats)
+	}
+}
+
+// slowEnricher fills source host after a delay, like uncached reverse dns.
+type slowEnricher struct{}
+
+func (slowEnricher) Enrich(ev *Event) {
+	time.Sleep(200 * time.Millisecond)
+	ev.SrcHost = "host"
+}
+
+func TestPollerEnrich(t *testing.T) {
+	p := NewPoller(client.NewMock(), NewAlertMapper(groups.New()))
+	defer p.Close()
+	p.SetEnricher(slowEnricher{})
+
+	w := &testWriter{}
+	if err := p.AddWriter(w); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := p.process(make([]Event, 10)); err != nil {
+		t.Fatal(err)
+	}
+	// events are enriched concurrently
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("enriching took %s", elapsed)
+	}
+	waitWritten(t, w, 10)
+
+	for _, ev := range w.events {
+		if ev.SrcHost != "host" {
+			t.Fatalf("event not enriched %+v", ev)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package alerts
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQRadarWriter(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	w, err := NewQRadarWriter(l.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	if err := w.Write(newTestEvent("c2_comm")); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// messages are terminated with new line
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	m, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(m, "<9>1 2018-09-06T14:09:04") || !strings.Contains(m, " NFR ") || !strings.Contains(m, "LEEF:") {
+		t.Fatalf("invalid message %s", m)
+	}
+}
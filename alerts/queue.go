@@ -0,0 +1,320 @@
+package alerts
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+// DefaultQueueSize is the default maximum number of alerts pending for a writer.
+const DefaultQueueSize = 10000
+
+// queueMaxRetryInterval is the maximum wait time before retrying failed writer.
+const queueMaxRetryInterval = 5 * time.Minute
+
+// queueSaveInterval is how often changed queue is stored in its file.
+const queueSaveInterval = 10 * time.Second
+
+// WriterStats are counters of alerts passed to a writer.
+type WriterStats struct {
+	Name string
+	// Written alerts.
+	Written uint64
+	// Failed write attempts.
+	Failed uint64
+	// Dropped alerts, when the queue was full.
+	Dropped uint64
+	// Pending alerts in the queue.
+	Pending int
+	// LastError of the writer or of storing the queue.
+	LastError error
+}
+
+// writerQueue passes alerts to a writer in its own goroutine, so a failing
+// writer doesn't block others. Failed writes are retried with exponential
+// backoff, and pending alerts are stored in a file periodically and when
+// the queue is closed, so they survive restart. Alerts are written at least
+// once, i.e. a failed batch is written again. The queue owns the writer,
+// and closes it when the queue is closed.
+type writerQueue struct {
+	name string
+	w    Writer
+	file string
+	size int
+
+	mx     sync.Mutex
+	events []*Event
+	// head is the number of alerts removed from the queue so far.
+	head  uint64
+	stats WriterStats
+	// dirty is true if the queue changed since it was stored.
+	dirty bool
+
+	backoff backoff.BackOff
+	notify  chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// newWriterQueue creates queue for the writer. If file is not empty, then
+// pending alerts are loaded from it.
+func newWriterQueue(name string, w Writer, file string, size int) (*writerQueue, error) {
+	if size <= 0 {
+		size = DefaultQueueSize
+	}
+
+	b := backoff.NewExponentialBackOff()
+	b.MaxInterval = queueMaxRetryInterval
+	b.MaxElapsedTime = 0
+
+	q := &writerQueue{
+		name:    name,
+		w:       w,
+		file:    file,
+		size:    size,
+		stats:   WriterStats{Name: name},
+		backoff: b,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// load reads pending alerts from the queue file. Corrupted lines are skipped.
+func (q *writerQueue) load() error {
+	if q.file == "" {
+		return nil
+	}
+
+	f, err := os.Open(q.file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var ev Event
+		if json.Unmarshal(s.Bytes(), &ev) == nil {
+			q.events = append(q.events, &ev)
+		}
+	}
+	return s.Err()
+}
+
+// save stores pending alerts in the queue file, if they changed. It's called
+// only by the queue goroutine, or after it's stopped.
+func (q *writerQueue) save() {
+	if q.file == "" {
+		return
+	}
+
+	q.mx.Lock()
+	events, dirty := q.events, q.dirty
+	q.dirty = false
+	q.mx.Unlock()
+	if !dirty {
+		return
+	}
+
+	err := q.saveEvents(events)
+	if err != nil {
+		q.mx.Lock()
+		q.stats.LastError = err
+		q.dirty = true
+		q.mx.Unlock()
+	}
+}
+
+// saveEvents writes events to the queue file.
+func (q *writerQueue) saveEvents(events []*Event) error {
+	tmp := q.file + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, ev := range events {
+		if err = enc.Encode(ev); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, q.file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// start starts writing queued alerts.
+func (q *writerQueue) start() {
+	q.wg.Add(1)
+	go q.run()
+	if len(q.events) > 0 {
+		q.wakeup()
+	}
+}
+
+func (q *writerQueue) wakeup() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// enqueue adds alerts to the queue. If the queue is full, then the oldest alerts are dropped.
+func (q *writerQueue) enqueue(events []*Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	q.mx.Lock()
+	q.events = append(q.events, events...)
+	if n := len(q.events) - q.size; n > 0 {
+		q.events = q.events[n:]
+		q.head += uint64(n)
+		q.stats.Dropped += uint64(n)
+	}
+	q.dirty = true
+	q.mx.Unlock()
+
+	q.wakeup()
+}
+
+// run writes queued alerts until the queue is closed.
+func (q *writerQueue) run() {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(queueSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ticker.C:
+			q.save()
+			continue
+		case <-q.notify:
+		}
+
+		for !q.write() {
+			retry := time.After(q.backoff.NextBackOff())
+		wait:
+			for {
+				select {
+				case <-q.done:
+					return
+				case <-ticker.C:
+					q.save()
+				case <-retry:
+					break wait
+				}
+			}
+		}
+		q.backoff.Reset()
+	}
+}
+
+// write writes all pending alerts. It returns false if the writer failed.
+func (q *writerQueue) write() bool {
+	q.mx.Lock()
+	events, head := q.events, q.head
+	q.mx.Unlock()
+
+	if len(events) == 0 {
+		return true
+	}
+
+	var (
+		n   int
+		err error
+	)
+	for _, ev := range events {
+		if err = q.w.Write(ev); err != nil {
+			break
+		}
+		n++
+	}
+	if f, ok := q.w.(Flusher); ok {
+		if err == nil {
+			err = f.Flush()
+		}
+		// buffering writer drops the failed batch, so write all alerts again
+		if err != nil {
+			n = 0
+		}
+	}
+
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	// some of written alerts may be already dropped, when the queue was full
+	if end := head + uint64(n); end > q.head {
+		q.events = q.events[end-q.head:]
+		q.head = end
+		q.dirty = true
+	}
+	q.stats.Written += uint64(n)
+	if err != nil {
+		q.stats.Failed++
+		q.stats.LastError = err
+		return false
+	}
+	return true
+}
+
+// Stats returns counters of the queue.
+func (q *writerQueue) Stats() WriterStats {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	stats := q.stats
+	stats.Pending = len(q.events)
+	return stats
+}
+
+// close stops writing alerts and closes the writer. Pending alerts are kept
+// in the queue file, or if there is no file, then they are written once more.
+func (q *writerQueue) close() error {
+	close(q.done)
+	q.wg.Wait()
+	if q.file == "" {
+		q.write()
+	} else {
+		q.save()
+	}
+
+	if c, ok := q.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// writerName returns short name of the writer type, e.g. syslog for *SyslogWriter.
+func writerName(w Writer) string {
+	name := strings.TrimPrefix(strings.TrimPrefix(fmt.Sprintf("%T", w), "*"), "alerts.")
+	return strings.ToLower(strings.TrimSuffix(name, "Writer"))
+}
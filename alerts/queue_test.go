@@ -0,0 +1,223 @@
+package alerts
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/groups"
+	"github.com/cenkalti/backoff/v4"
+)
+
+// testWriter records written events, and fails first failures writes.
+type testWriter struct {
+	mx       sync.Mutex
+	failures int
+	events   []*Event
+}
+
+func (w *testWriter) Write(event *Event) error {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	if w.failures != 0 {
+		w.failures--
+		return fmt.Errorf("output down")
+	}
+	w.events = append(w.events, event)
+	return nil
+}
+
+func (w *testWriter) written() int {
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	return len(w.events)
+}
+
+// waitWritten waits until writer gets n events.
+func waitWritten(t *testing.T, w *testWriter, n int) {
+	for i := 0; i < 100 && w.written() < n; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if written := w.written(); written != n {
+		t.Fatalf("invalid number of written events - got %d; expected %d", written, n)
+	}
+}
+
+func TestWriterQueueRetry(t *testing.T) {
+	w := &testWriter{failures: 2}
+	q, err := newWriterQueue("test", w, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.backoff = &backoff.ConstantBackOff{Interval: time.Millisecond}
+	q.start()
+	defer q.close()
+
+	q.enqueue([]*Event{newTestEvent("c2_comm"), newTestEvent("tor_usage")})
+	waitWritten(t, w, 2)
+
+	stats := q.Stats()
+	if stats.Written != 2 || stats.Failed != 2 || stats.Pending != 0 || stats.LastError == nil {
+		t.Fatalf("invalid queue stats %+v", stats)
+	}
+}
+
+func TestWriterQueueFull(t *testing.T) {
+	q, err := newWriterQueue("test", &testWriter{}, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.enqueue([]*Event{newTestEvent("c2_comm"), newTestEvent("tor_usage"), newTestEvent("young_domain")})
+
+	stats := q.Stats()
+	if stats.Dropped != 1 || stats.Pending != 2 {
+		t.Fatalf("invalid queue stats %+v", stats)
+	}
+	if _, ok := q.events[0].Threats["tor_usage"]; !ok {
+		t.Fatalf("oldest event not dropped")
+	}
+}
+
+func TestWriterQueuePersist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "queue")
+
+	q, err := newWriterQueue("test", &testWriter{failures: -1}, file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.enqueue([]*Event{newTestEvent("c2_comm"), newTestEvent("tor_usage")})
+	if err := q.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// events pending in the file are written after restart
+	w := &testWriter{}
+	q, err = newWriterQueue("test", w, file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.start()
+	defer q.close()
+
+	waitWritten(t, w, 2)
+	if w.events[0].Query != "virus.com" {
+		t.Fatalf("invalid event loaded from queue file - got query %s", w.events[0].Query)
+	}
+	if stats := q.Stats(); stats.Pending != 0 {
+		t.Fatalf("invalid number of pending events - got %d; expected 0", stats.Pending)
+	}
+}
+
+// closingWriter records if it was closed.
+type closingWriter struct {
+	testWriter
+	closed bool
+}
+
+func (w *closingWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestWriterQueueClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "queue")
+
+	w := &closingWriter{testWriter: testWriter{failures: -1}}
+	q, err := newWriterQueue("test", w, file, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.start()
+	q.enqueue([]*Event{newTestEvent("c2_comm")})
+
+	// queue is stored periodically, not on every change
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("queue file stored on enqueue")
+	}
+	if err := q.close(); err != nil {
+		t.Fatal(err)
+	}
+	if !w.closed {
+		t.Fatal("writer not closed with the queue")
+	}
+	if b, err := ioutil.ReadFile(file); err != nil || len(b) == 0 {
+		t.Fatalf("pending alerts not stored on close: %v", err)
+	}
+}
+
+// alertsClient returns the same alerts response.
+type alertsClient struct {
+	client.MockAlphaSOCClient
+	resp *client.AlertsResponse
+}
+
+func (c *alertsClient) Alerts(follow string) (*client.AlertsResponse, error) {
+	return c.resp, nil
+}
+
+func TestPollerFailingWriter(t *testing.T) {
+	resp := &client.AlertsResponse{
+		Follow:  "2",
+		Threats: map[string]client.Threat{"c2_comm": {Severity: 4}},
+		Alerts:  []client.Alert{{EventType: "dns", Threats: []string{"c2_comm"}}},
+	}
+
+	p := NewPoller(&alertsClient{resp: resp}, NewAlertMapper(groups.New()))
+	defer p.Close()
+
+	failing, w := &testWriter{failures: -1}, &testWriter{}
+	if err := p.AddWriter(failing); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.AddWriter(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.do(1, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.follow != "2" {
+		t.Fatalf("invalid follow - got %s; expected %s", p.follow, "2")
+	}
+	waitWritten(t, w, 1)
+	if stats := p.Stats(); stats[0].Failed == 0 || stats[0].Pending != 1 || stats[0].Name != "test" {
+		t.Fatalf("invalid failing writer stats %+v", stats[0])
+	}
+}
+
+func TestPollerQueueNames(t *testing.T) {
+	names := func(ids ...string) []string {
+		p := NewPoller(&alertsClient{}, NewAlertMapper(groups.New()))
+		defer p.Close()
+		for _, id := range ids {
+			if err := p.AddFilteredWriter(&testWriter{}, nil, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var names []string
+		for _, stats := range p.Stats() {
+			names = append(names, stats.Name)
+		}
+		return names
+	}
+
+	a, b := names("http://a", "http://b", "http://a"), names("http://b", "http://a")
+	if a[0] != b[1] || a[1] != b[0] || a[2] != a[0]+"-2" {
+		t.Fatalf("queue names depend on outputs order %v %v", a, b)
+	}
+}
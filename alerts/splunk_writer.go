@@ -0,0 +1,237 @@
+package alerts
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+)
+
+// Default splunk writer settings.
+const (
+	DefaultSplunkSourceType = "nfr:alert"
+	DefaultSplunkBatchSize  = 100
+	DefaultSplunkTimeout    = 10 * time.Second
+)
+
+// splunkEventPath is the path of HTTP Event Collector JSON endpoint.
+const splunkEventPath = "/services/collector/event"
+
+// SplunkConfig is a configuration of splunk writer.
+type SplunkConfig struct {
+	// URL of HTTP Event Collector, e.g. https://splunk:8088
+	URL   string
+	Token string
+
+	Index      string
+	Source     string
+	SourceType string
+
+	// BatchSize is the maximum number of events sent in one request.
+	BatchSize int
+	// Gzip compresses requests body.
+	Gzip bool
+	// Timeout of a single request.
+	Timeout time.Duration
+	// MaxPending is the maximum number of events kept after failed requests,
+	// which are sent again with the next batch. If it's 0, then failed events
+	// are dropped, e.g. for alerts, which are written again by alerts queue.
+	MaxPending int
+}
+
+// hecEvent is an event in HTTP Event Collector format.
+type hecEvent struct {
+	Time       float64     `json:"time"`
+	Host       string      `json:"host,omitempty"`
+	Index      string      `json:"index,omitempty"`
+	Source     string      `json:"source,omitempty"`
+	SourceType string      `json:"sourcetype,omitempty"`
+	Event      interface{} `json:"event"`
+}
+
+// SplunkWriter implements Writer interface and sends api alerts
+// to Splunk HTTP Event Collector in batches. It may be also used
+// to forward network events sent for analysis.
+type SplunkWriter struct {
+	cfg      SplunkConfig
+	url      string
+	hostname string
+	client   *http.Client
+
+	mx     sync.Mutex
+	events []*hecEvent
+	// failed is the number of events kept in the batch after failed request.
+	failed int
+}
+
+// NewSplunkWriter creates new splunk writer.
+func NewSplunkWriter(cfg SplunkConfig) (*SplunkWriter, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("splunk url required")
+	}
+	if cfg.SourceType == "" {
+		cfg.SourceType = DefaultSplunkSourceType
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultSplunkBatchSize
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultSplunkTimeout
+	}
+
+	url := strings.TrimRight(cfg.URL, "/")
+	if !strings.HasSuffix(url, splunkEventPath) {
+		url += splunkEventPath
+	}
+
+	hostname, _ := os.Hostname()
+	return &SplunkWriter{
+		cfg:      cfg,
+		url:      url,
+		hostname: hostname,
+		client:   &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// Write adds alert to the batch, and sends it if the batch is full.
+func (w *SplunkWriter) Write(event *Event) error {
+	// event is kept in the batch, while caller may reuse it
+	ev := *event
+	return w.add(ev.Timestamp, w.cfg.SourceType, &ev)
+}
+
+// WriteTelemetry adds network event to the batch with given sourcetype,
+// and sends it if the batch is full.
+func (w *SplunkWriter) WriteTelemetry(ts time.Time, sourceType string, event interface{}) error {
+	return w.add(ts, sourceType, event)
+}
+
+func (w *SplunkWriter) add(ts time.Time, sourceType string, event interface{}) error {
+	w.mx.Lock()
+	w.events = append(w.events, &hecEvent{
+		Time:       float64(ts.UnixNano()/int64(time.Millisecond)) / 1000,
+		Host:       w.hostname,
+		Index:      w.cfg.Index,
+		Source:     w.cfg.Source,
+		SourceType: sourceType,
+		Event:      event,
+	})
+	// failed events are retried with a batch of new ones
+	full := len(w.events)-w.failed >= w.cfg.BatchSize
+	w.mx.Unlock()
+
+	if full {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush sends all buffered events to the HTTP Event Collector.
+func (w *SplunkWriter) Flush() error {
+	w.mx.Lock()
+	events := w.events
+	w.events, w.failed = nil, 0
+	w.mx.Unlock()
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	if err := w.flush(events); err != nil {
+		w.keep(events)
+		return err
+	}
+	return nil
+}
+
+// keep puts back failed events before events added in the meantime,
+// up to MaxPending events. The oldest events are dropped.
+func (w *SplunkWriter) keep(events []*hecEvent) {
+	if w.cfg.MaxPending <= 0 {
+		return
+	}
+
+	w.mx.Lock()
+	defer w.mx.Unlock()
+	added := len(w.events)
+	w.events = append(events, w.events...)
+	if n := len(w.events) - w.cfg.MaxPending; n > 0 {
+		w.events = w.events[n:]
+	}
+	if w.failed = len(w.events) - added; w.failed < 0 {
+		w.failed = 0
+	}
+}
+
+// flush sends events in one request.
+func (w *SplunkWriter) flush(events []*hecEvent) error {
+	var body bytes.Buffer
+	var bw io.Writer = &body
+	var zw *gzip.Writer
+	if w.cfg.Gzip {
+		zw = gzip.NewWriter(&body)
+		bw = zw
+	}
+	enc := json.NewEncoder(bw)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.send(&body); err != nil {
+		return fmt.Errorf("send %d events to splunk failed: %s", len(events), err)
+	}
+	return nil
+}
+
+func (w *SplunkWriter) send(body io.Reader) error {
+	req, err := http.NewRequest(http.MethodPost, w.url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+w.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", client.DefaultUserAgent)
+	if w.cfg.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var r struct {
+			Text string `json:"text"`
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(b, &r) == nil && r.Text != "" {
+			return fmt.Errorf("%s: %s", resp.Status, r.Text)
+		}
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+// Close sends buffered events.
+func (w *SplunkWriter) Close() error {
+	return w.Flush()
+}
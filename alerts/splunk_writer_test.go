@@ -0,0 +1,138 @@
+package alerts
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSplunkWriter(t *testing.T) {
+	var events []map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/collector/event" {
+			t.Errorf("invalid path - got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Splunk token" {
+			t.Errorf("invalid authorization header - got %q", r.Header.Get("Authorization"))
+		}
+
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = zr
+		}
+		dec := json.NewDecoder(body)
+		for dec.More() {
+			var event map[string]interface{}
+			if err := dec.Decode(&event); err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, event)
+		}
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer srv.Close()
+
+	w, err := NewSplunkWriter(SplunkConfig{
+		URL:       srv.URL,
+		Token:     "token",
+		Index:     "nfr",
+		BatchSize: 2,
+		Gzip:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := w.Write(newTestEvent("c2_comm")); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("batch sent before it's full")
+	}
+	if err := w.WriteTelemetry(time.Unix(1536242945, 5e8), "nfr:dns", map[string]string{"query": "virus.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("invalid number of events - got %d; expected %d", len(events), 2)
+	}
+
+	if events[0]["time"] != 1536242944.0 || events[0]["index"] != "nfr" || events[0]["sourcetype"] != "nfr:alert" {
+		t.Fatalf("invalid alert event metadata - got %v", events[0])
+	}
+	if event := events[0]["event"].(map[string]interface{}); event["query"] != "virus.com" {
+		t.Fatalf("invalid alert event - got %v", event)
+	}
+	if events[1]["time"] != 1536242945.5 || events[1]["sourcetype"] != "nfr:dns" {
+		t.Fatalf("invalid telemetry event metadata - got %v", events[1])
+	}
+}
+
+func TestSplunkWriterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"text":"Invalid token","code":4}`))
+	}))
+	defer srv.Close()
+
+	w, err := NewSplunkWriter(SplunkConfig{URL: srv.URL, Token: "invalid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(newTestEvent("c2_comm"))
+	if err := w.Flush(); err == nil {
+		t.Fatal("no error for invalid token")
+	}
+}
+
+func TestSplunkWriterPending(t *testing.T) {
+	var (
+		requests int
+		events   int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		dec := json.NewDecoder(r.Body)
+		for dec.More() {
+			var event map[string]interface{}
+			if err := dec.Decode(&event); err != nil {
+				t.Fatal(err)
+			}
+			events++
+		}
+		w.Write([]byte(`{"text":"Success","code":0}`))
+	}))
+	defer srv.Close()
+
+	w, err := NewSplunkWriter(SplunkConfig{URL: srv.URL, BatchSize: 2, MaxPending: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first batch fails, and only its last event is kept
+	w.WriteTelemetry(time.Now(), "nfr:dns", map[string]string{"query": "a.com"})
+	if err := w.WriteTelemetry(time.Now(), "nfr:dns", map[string]string{"query": "b.com"}); err == nil {
+		t.Fatal("no error for unavailable splunk")
+	}
+	// failed event is retried with a batch of new ones
+	w.WriteTelemetry(time.Now(), "nfr:dns", map[string]string{"query": "c.com"})
+	if requests != 1 {
+		t.Fatalf("failed batch retried before new batch is full")
+	}
+	if err := w.WriteTelemetry(time.Now(), "nfr:dns", map[string]string{"query": "d.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 || events != 3 {
+		t.Fatalf("got %d requests with %d events; expected 2 requests with 3 events", requests, events)
+	}
+}
@@ -0,0 +1,329 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// stixTimeFormat is the format of STIX timestamps, in UTC with milliseconds.
+const stixTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// stixNamespace is the namespace of deterministic ids of STIX cyber-observable objects.
+var stixNamespace = mustParseUUID("00abedb4-aa42-52bd-91bb-8ca79c6f2a9a")
+
+// stixIdentityID is the id of nfr identity, which creates STIX objects.
+var stixIdentityID = "identity--" + uuid5(nfrNamespace, "identity")
+
+// stixBundle is a STIX 2.1 bundle of objects.
+type stixBundle struct {
+	Type    string        `json:"type"`
+	ID      string        `json:"id"`
+	Objects []interface{} `json:"objects"`
+}
+
+// stixCommon are properties common for STIX domain and relationship objects.
+type stixCommon struct {
+	Type         string `json:"type"`
+	SpecVersion  string `json:"spec_version"`
+	ID           string `json:"id"`
+	Created      string `json:"created"`
+	Modified     string `json:"modified"`
+	CreatedByRef string `json:"created_by_ref,omitempty"`
+}
+
+type stixIdentity struct {
+	stixCommon
+	Name          string `json:"name"`
+	IdentityClass string `json:"identity_class"`
+}
+
+type stixIndicator struct {
+	stixCommon
+	Name           string   `json:"name"`
+	Description    string   `json:"description,omitempty"`
+	IndicatorTypes []string `json:"indicator_types"`
+	Pattern        string   `json:"pattern"`
+	PatternType    string   `json:"pattern_type"`
+	ValidFrom      string   `json:"valid_from"`
+	Labels         []string `json:"labels,omitempty"`
+}
+
+type stixObservedData struct {
+	stixCommon
+	FirstObserved  string   `json:"first_observed"`
+	LastObserved   string   `json:"last_observed"`
+	NumberObserved int      `json:"number_observed"`
+	ObjectRefs     []string `json:"object_refs"`
+}
+
+type stixSighting struct {
+	stixCommon
+	SightingOfRef    string   `json:"sighting_of_ref"`
+	ObservedDataRefs []string `json:"observed_data_refs"`
+	WhereSightedRefs []string `json:"where_sighted_refs"`
+	FirstSeen        string   `json:"first_seen"`
+	LastSeen         string   `json:"last_seen"`
+	Count            int      `json:"count"`
+}
+
+// stixObservable is STIX cyber-observable object.
+type stixObservable map[string]interface{}
+
+// FormatterSTIX formats alerts as STIX 2.1 bundles. Each bundle contains
+// observed data of the event, and indicator with sighting for each threat.
+type FormatterSTIX struct {
+}
+
+// NewFormatterSTIX creates STIX formatter.
+func NewFormatterSTIX() *FormatterSTIX {
+	return &FormatterSTIX{}
+}
+
+// Format formats the event as STIX bundle.
+func (f *FormatterSTIX) Format(event *Event) ([][]byte, error) {
+	b, err := json.Marshal(newSTIXBundle([]*Event{event}))
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{b}, nil
+}
+
+// newSTIXBundle creates bundle with objects of the events.
+func newSTIXBundle(events []*Event) *stixBundle {
+	identity := &stixIdentity{
+		stixCommon: stixCommon{
+			Type:        "identity",
+			SpecVersion: "2.1",
+			ID:          stixIdentityID,
+			// identity is the same in all bundles
+			Created:  "2021-01-01T00:00:00.000Z",
+			Modified: "2021-01-01T00:00:00.000Z",
+		},
+		Name:          DefaultLogVendor + " " + DefaultLogProduct,
+		IdentityClass: "system",
+	}
+
+	bundle := &stixBundle{Type: "bundle", Objects: []interface{}{identity}}
+	uids := make([]string, len(events))
+	for n, event := range events {
+		uids[n] = alertUID(event, "")
+		bundle.Objects = append(bundle.Objects, newSTIXObjects(event)...)
+	}
+	bundle.ID = "bundle--" + uuid5(nfrNamespace, strings.Join(uids, ","))
+	return bundle
+}
+
+// newSTIXObjects maps the event to observables, observed data, and indicator
+// with sighting for each threat.
+func newSTIXObjects(event *Event) []interface{} {
+	ts := event.Timestamp.UTC().Format(stixTimeFormat)
+	now := time.Now().UTC().Format(stixTimeFormat)
+
+	observables := stixObservables(event)
+	refs := make([]string, len(observables))
+	for n := range observables {
+		refs[n] = observables[n]["id"].(string)
+	}
+
+	count := event.Suppressed + 1
+	observedData := &stixObservedData{
+		stixCommon: stixCommon{
+			Type:         "observed-data",
+			SpecVersion:  "2.1",
+			ID:           "observed-data--" + alertUID(event, ""),
+			Created:      now,
+			Modified:     now,
+			CreatedByRef: stixIdentityID,
+		},
+		FirstObserved:  ts,
+		LastObserved:   ts,
+		NumberObserved: count,
+		ObjectRefs:     refs,
+	}
+
+	var objects []interface{}
+	for _, o := range observables {
+		objects = append(objects, o)
+	}
+	objects = append(objects, observedData)
+
+	tids := make([]string, 0, len(event.Threats))
+	for tid := range event.Threats {
+		tids = append(tids, tid)
+	}
+	sort.Strings(tids)
+
+	for _, tid := range tids {
+		threat := event.Threats[tid]
+		indicatorType := "malicious-activity"
+		if threat.Policy {
+			indicatorType = "anomalous-activity"
+		}
+		uid := alertUID(event, tid)
+		indicator := &stixIndicator{
+			stixCommon: stixCommon{
+				Type:         "indicator",
+				SpecVersion:  "2.1",
+				ID:           "indicator--" + uid,
+				Created:      now,
+				Modified:     now,
+				CreatedByRef: stixIdentityID,
+			},
+			Name:           threat.Description,
+			Description:    fmt.Sprintf("%s (threat %s, severity %d)", threat.Description, tid, threat.Severity),
+			IndicatorTypes: []string{indicatorType},
+			Pattern:        stixPattern(event),
+			PatternType:    "stix",
+			ValidFrom:      ts,
+			Labels:         append([]string{tid}, event.Flags...),
+		}
+		sighting := &stixSighting{
+			stixCommon: stixCommon{
+				Type:         "sighting",
+				SpecVersion:  "2.1",
+				ID:           "sighting--" + uid,
+				Created:      now,
+				Modified:     now,
+				CreatedByRef: stixIdentityID,
+			},
+			SightingOfRef:    indicator.ID,
+			ObservedDataRefs: []string{observedData.ID},
+			WhereSightedRefs: []string{stixIdentityID},
+			FirstSeen:        ts,
+			LastSeen:         ts,
+			Count:            count,
+		}
+		objects = append(objects, indicator, sighting)
+	}
+	return objects
+}
+
+// stixObservables returns cyber-observable objects of the event.
+func stixObservables(event *Event) []stixObservable {
+	var observables []stixObservable
+	add := func(o stixObservable, contributing ...string) string {
+		props := make(map[string]interface{}, len(contributing))
+		for _, name := range contributing {
+			if v, ok := o[name]; ok {
+				props[name] = v
+			}
+		}
+		b, _ := json.Marshal(props)
+		o["id"] = o["type"].(string) + "--" + uuid5(stixNamespace, string(b))
+		o["spec_version"] = "2.1"
+		observables = append(observables, o)
+		return o["id"].(string)
+	}
+	addIP := func(value string, v6 bool) string {
+		typ := "ipv4-addr"
+		if v6 {
+			typ = "ipv6-addr"
+		}
+		return add(stixObservable{"type": typ, "value": value}, "value")
+	}
+
+	var srcRef, dstRef string
+	if event.SrcIP != nil {
+		srcRef = addIP(event.SrcIP.String(), event.SrcIP.To4() == nil)
+		src := observables[len(observables)-1]
+		if event.SrcMac != "" {
+			src["resolves_to_refs"] = []string{add(stixObservable{"type": "mac-addr", "value": event.SrcMac}, "value")}
+		}
+		if event.SrcHost != "" {
+			add(stixObservable{
+				"type":             "domain-name",
+				"value":            event.SrcHost,
+				"resolves_to_refs": []string{srcRef},
+			}, "value")
+		}
+		// asset details are custom properties of the source address
+		if event.Asset != nil {
+			for name, value := range map[string]string{
+				"x_nfr_asset_owner":       event.Asset.Owner,
+				"x_nfr_asset_tag":         event.Asset.Tag,
+				"x_nfr_asset_criticality": event.Asset.Criticality,
+			} {
+				if value != "" {
+					src[name] = value
+				}
+			}
+		}
+	}
+	if event.SrcUser != "" {
+		add(stixObservable{"type": "user-account", "user_id": event.SrcUser}, "user_id")
+	}
+	if event.DestIP != nil {
+		dstRef = addIP(event.DestIP.String(), event.DestIP.To4() == nil)
+		if event.DestHost != "" {
+			add(stixObservable{
+				"type":             "domain-name",
+				"value":            event.DestHost,
+				"resolves_to_refs": []string{dstRef},
+			}, "value")
+		}
+	}
+
+	switch event.EventType {
+	case "dns":
+		add(stixObservable{"type": "domain-name", "value": event.Query}, "value")
+	case "http":
+		add(stixObservable{"type": "url", "value": event.URL}, "value")
+	}
+
+	if srcRef != "" && dstRef != "" {
+		traffic := stixObservable{
+			"type":    "network-traffic",
+			"start":   event.Timestamp.UTC().Format(stixTimeFormat),
+			"src_ref": srcRef,
+			"dst_ref": dstRef,
+		}
+		if event.SrcPort != 0 {
+			traffic["src_port"] = event.SrcPort
+		}
+		if event.DestPort != 0 {
+			traffic["dst_port"] = event.DestPort
+		}
+		protocols := []string{"ipv4"}
+		if event.SrcIP.To4() == nil {
+			protocols[0] = "ipv6"
+		}
+		if event.Proto != "" {
+			protocols = append(protocols, strings.ToLower(event.Proto))
+		}
+		if event.EventType == "http" {
+			protocols = append(protocols, "http")
+		}
+		traffic["protocols"] = protocols
+		if event.BytesOut != 0 {
+			traffic["src_byte_count"] = event.BytesOut
+		}
+		if event.BytesIn != 0 {
+			traffic["dst_byte_count"] = event.BytesIn
+		}
+		add(traffic, "start", "src_ref", "dst_ref", "src_port", "dst_port", "protocols")
+	}
+	return observables
+}
+
+// stixPattern returns pattern matching the event destination.
+func stixPattern(event *Event) string {
+	switch {
+	case event.EventType == "dns":
+		return fmt.Sprintf("[domain-name:value = '%s']", stixPatternEscaper.Replace(event.Query))
+	case event.EventType == "http":
+		return fmt.Sprintf("[url:value = '%s']", stixPatternEscaper.Replace(event.URL))
+	case event.DestIP != nil && event.DestIP.To4() == nil:
+		return fmt.Sprintf("[ipv6-addr:value = '%s']", event.DestIP)
+	case event.DestIP != nil:
+		return fmt.Sprintf("[ipv4-addr:value = '%s']", event.DestIP)
+	case event.SrcIP != nil && event.SrcIP.To4() == nil:
+		return fmt.Sprintf("[ipv6-addr:value = '%s']", event.SrcIP)
+	}
+	return fmt.Sprintf("[ipv4-addr:value = '%s']", event.SrcIP)
+}
+
+// stixPatternEscaper escapes string literals of STIX patterns.
+var stixPatternEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`)
@@ -0,0 +1,116 @@
+package alerts
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+)
+
+func TestFormatterSTIX(t *testing.T) {
+	event := &Event{
+		EventType: "ip",
+		Threats: map[string]Threat{
+			"c2_comm":   {Severity: 5, Description: "C2 communication"},
+			"tor_comms": {Severity: 2, Description: "Tor traffic", Policy: true},
+		},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 123e6).UTC(),
+			SrcIP:     net.IPv4(10, 0, 0, 1),
+			SrcPort:   51234,
+			SrcHost:   "laptop",
+			SrcMac:    "00:11:22:33:44:55",
+			SrcUser:   "alice",
+			DestIP:    net.IPv4(4, 3, 2, 1),
+			DestPort:  443,
+			Proto:     "tcp",
+			BytesOut:  1024,
+		},
+		Asset: &Asset{Owner: "it", Criticality: "high"},
+	}
+
+	bs, err := NewFormatterSTIX().Format(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bs) != 1 {
+		t.Fatalf("got %d bundles, expected 1", len(bs))
+	}
+
+	var bundle struct {
+		Type    string                   `json:"type"`
+		Objects []map[string]interface{} `json:"objects"`
+	}
+	if err := json.Unmarshal(bs[0], &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Type != "bundle" {
+		t.Fatalf("got %s type, expected bundle", bundle.Type)
+	}
+
+	types := make(map[string]int)
+	ids := make(map[string]bool)
+	for _, o := range bundle.Objects {
+		types[o["type"].(string)]++
+		ids[o["id"].(string)] = true
+	}
+	for typ, count := range map[string]int{
+		"identity":        1,
+		"ipv4-addr":       2,
+		"mac-addr":        1,
+		"domain-name":     1,
+		"user-account":    1,
+		"network-traffic": 1,
+		"observed-data":   1,
+		"indicator":       2,
+		"sighting":        2,
+	} {
+		if types[typ] != count {
+			t.Fatalf("got %d %s objects, expected %d", types[typ], typ, count)
+		}
+	}
+
+	for _, o := range bundle.Objects {
+		switch o["type"] {
+		case "indicator":
+			if o["pattern"] != "[ipv4-addr:value = '4.3.2.1']" || o["valid_from"] != "2018-09-06T14:09:04.123Z" {
+				t.Fatalf("invalid indicator %v", o)
+			}
+		case "ipv4-addr":
+			if o["value"] != "10.0.0.1" {
+				break
+			}
+			refs, _ := o["resolves_to_refs"].([]interface{})
+			if len(refs) != 1 || !ids[refs[0].(string)] ||
+				o["x_nfr_asset_owner"] != "it" || o["x_nfr_asset_criticality"] != "high" {
+				t.Fatalf("invalid source address %v", o)
+			}
+		case "sighting":
+			if !ids[o["sighting_of_ref"].(string)] {
+				t.Fatalf("sighting of unknown indicator %v", o)
+			}
+		case "observed-data":
+			for _, ref := range o["object_refs"].([]interface{}) {
+				if !ids[ref.(string)] {
+					t.Fatalf("reference to unknown object %s", ref)
+				}
+			}
+		}
+	}
+
+	// ids of observables are deterministic
+	bs2, err := NewFormatterSTIX().Format(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(bs2[0], &bundle); err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range bundle.Objects {
+		if !ids[o["id"].(string)] {
+			t.Fatalf("id %s changed", o["id"])
+		}
+	}
+}
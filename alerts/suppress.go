@@ -0,0 +1,183 @@
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSuppressFields are the default fields of the suppression key.
+var DefaultSuppressFields = []string{"threat", "src_ip", "query", "dest_ip"}
+
+// suppressFields maps suppression key fields to the event values.
+var suppressFields = map[string]func(tid string, ev *Event) string{
+	"threat":     func(tid string, ev *Event) string { return tid },
+	"event_type": func(tid string, ev *Event) string { return ev.EventType },
+	"src_ip":     func(tid string, ev *Event) string { return ev.SrcIP.String() },
+	"src_host":   func(tid string, ev *Event) string { return ev.SrcHost },
+	"dest_ip":    func(tid string, ev *Event) string { return ev.DestIP.String() },
+	"dest_port":  func(tid string, ev *Event) string { return strconv.Itoa(int(ev.DestPort)) },
+	"query":      func(tid string, ev *Event) string { return ev.Query },
+	"url":        func(tid string, ev *Event) string { return ev.URL },
+	"ja3":        func(tid string, ev *Event) string { return ev.Ja3 },
+}
+
+// suppression of alerts with the same key.
+type suppression struct {
+	Expires time.Time `json:"expires"`
+	// Count of suppressed alerts.
+	Count int `json:"count"`
+	// Event is the first alert, with a single threat.
+	Event *Event `json:"event"`
+}
+
+// Suppressor suppresses repeated alerts with the same key (e.g. threat,
+// source ip and query) within a time window. When the window closes, a summary
+// alert with the number of suppressed alerts is returned.
+type Suppressor struct {
+	fields []string
+	window time.Duration
+	file   string
+
+	entries map[string]*suppression
+	changed bool
+}
+
+// NewSuppressor creates suppressor for key fields and time window.
+// If file is not empty, then suppressions are loaded from it and saved on Save.
+func NewSuppressor(fields []string, window time.Duration, file string) (*Suppressor, error) {
+	if len(fields) == 0 {
+		fields = DefaultSuppressFields
+	}
+	for _, field := range fields {
+		if _, ok := suppressFields[field]; !ok {
+			return nil, fmt.Errorf("invalid suppression key field %s", field)
+		}
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("invalid suppression window %s", window)
+	}
+
+	s := &Suppressor{
+		fields:  fields,
+		window:  window,
+		file:    file,
+		entries: make(map[string]*suppression),
+	}
+	if file == "" {
+		return s, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.entries); err != nil {
+		return nil, fmt.Errorf("invalid suppression file %s: %s", file, err)
+	}
+	return s, nil
+}
+
+// key returns suppression key of the threat of event.
+func (s *Suppressor) key(tid string, ev *Event) string {
+	values := make([]string, len(s.fields))
+	for n, field := range s.fields {
+		values[n] = suppressFields[field](tid, ev)
+	}
+	return strings.Join(values, "|")
+}
+
+// Apply returns events with threats not suppressed at the given time.
+// If some threats are suppressed, then a copy of the event is returned.
+func (s *Suppressor) Apply(now time.Time, events []Event) []*Event {
+	var res []*Event
+	for i := range events {
+		ev := &events[i]
+		threats := make(map[string]Threat, len(ev.Threats))
+		for tid, threat := range ev.Threats {
+			key := s.key(tid, ev)
+			if e, ok := s.entries[key]; ok && now.Before(e.Expires) {
+				e.Count++
+				s.changed = true
+				continue
+			}
+
+			first := *ev
+			first.Threats = map[string]Threat{tid: threat}
+			first.Severity = threat.Severity
+			s.entries[key] = &suppression{Expires: now.Add(s.window), Event: &first}
+			s.changed = true
+			threats[tid] = threat
+		}
+
+		switch len(threats) {
+		case 0:
+		case len(ev.Threats):
+			res = append(res, ev)
+		default:
+			c := *ev
+			c.Threats = threats
+			c.Severity = 0
+			for _, threat := range threats {
+				if threat.Severity > c.Severity {
+					c.Severity = threat.Severity
+				}
+			}
+			res = append(res, &c)
+		}
+	}
+	return res
+}
+
+// Expire removes suppressions with window closed at the given time, and returns
+// summary alerts of them, for which similar alerts were suppressed.
+func (s *Suppressor) Expire(now time.Time) []*Event {
+	var res []*Event
+	for key, e := range s.entries {
+		if now.Before(e.Expires) {
+			continue
+		}
+		delete(s.entries, key)
+		s.changed = true
+		if e.Count == 0 {
+			continue
+		}
+
+		summary := *e.Event
+		summary.Suppressed = e.Count
+		summary.Threats = make(map[string]Threat, len(e.Event.Threats))
+		for tid, threat := range e.Event.Threats {
+			threat.Description = fmt.Sprintf("%s (suppressed %d similar alerts)", threat.Description, e.Count)
+			summary.Threats[tid] = threat
+		}
+		res = append(res, &summary)
+	}
+	return res
+}
+
+// Save stores suppressions in the file, if they changed.
+func (s *Suppressor) Save() error {
+	if s.file == "" || !s.changed {
+		return nil
+	}
+
+	b, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.file); err != nil {
+		return err
+	}
+	s.changed = false
+	return nil
+}
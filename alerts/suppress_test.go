@@ -0,0 +1,76 @@
+package alerts
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSuppressor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-suppress")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "suppress.json")
+
+	s, err := NewSuppressor(nil, time.Hour, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if events := s.Apply(now, []Event{*newTestEvent("c2_comm")}); len(events) != 1 {
+		t.Fatalf("invalid number of events - got %d; expected %d", len(events), 1)
+	}
+
+	// same threat is suppressed, while other threat of the event is not
+	ev := newTestEvent("c2_comm")
+	ev.Threats["young_domain"] = Threat{Severity: 2}
+	events := s.Apply(now.Add(time.Minute), []Event{*ev, *newTestEvent("c2_comm")})
+	if len(events) != 1 {
+		t.Fatalf("invalid number of events - got %d; expected %d", len(events), 1)
+	}
+	if _, ok := events[0].Threats["young_domain"]; !ok || len(events[0].Threats) != 1 || events[0].Severity != 2 {
+		t.Fatalf("invalid threats of event %v", events[0].Threats)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// suppressions survive restart
+	s, err = NewSuppressor(nil, time.Hour, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if events := s.Apply(now.Add(2*time.Minute), []Event{*newTestEvent("c2_comm")}); len(events) != 0 {
+		t.Fatalf("invalid number of events - got %d; expected %d", len(events), 0)
+	}
+
+	if events := s.Expire(now.Add(30 * time.Minute)); len(events) != 0 {
+		t.Fatalf("invalid number of summaries - got %d; expected %d", len(events), 0)
+	}
+	summaries := s.Expire(now.Add(time.Hour))
+	if len(summaries) != 1 {
+		t.Fatalf("invalid number of summaries - got %d; expected %d", len(summaries), 1)
+	}
+	if summaries[0].Suppressed != 3 {
+		t.Fatalf("invalid number of suppressed alerts - got %d; expected %d", summaries[0].Suppressed, 3)
+	}
+	if desc := summaries[0].Threats["c2_comm"].Description; !strings.HasSuffix(desc, "(suppressed 3 similar alerts)") {
+		t.Fatalf("invalid summary description %s", desc)
+	}
+
+	if events := s.Apply(now.Add(time.Hour), []Event{*newTestEvent("c2_comm")}); len(events) != 1 {
+		t.Fatalf("invalid number of events after window - got %d; expected %d", len(events), 1)
+	}
+}
+
+func TestNewSuppressorInvalidKey(t *testing.T) {
+	if _, err := NewSuppressor([]string{"threat", "src_port"}, time.Hour, ""); err == nil {
+		t.Fatal("expected error for invalid key field")
+	}
+}
@@ -1,50 +1,146 @@
-// +build !windows,!nacl,!plan9
-
 package alerts
 
 import (
 	"fmt"
-	"log/syslog"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/alphasoc/nfr/syslog"
 )
 
+// SyslogSDID is the id of structured data element with alert details.
+const SyslogSDID = "nfr@32473"
+
 // SyslogWriter implements Writer interface and write
-// api alerts to syslog server.
+// api alerts to syslog server in RFC 5424 format.
 type SyslogWriter struct {
-	w *syslog.Writer
-	f Formatter
+	c        *syslog.Client
+	f        Formatter
+	progress sendProgress
 }
 
-// NewSyslogWriter creates new syslog writer.
-func NewSyslogWriter(proto, raddr string, format Formatter) (*SyslogWriter, error) {
-	if proto == "" {
-		proto = "tcp"
-	}
-
-	w, err := syslog.Dial(proto, raddr, logalert, tag)
+// NewSyslogWriter creates new syslog writer. It connects to the server
+// on first write.
+func NewSyslogWriter(cfg syslog.Config, format Formatter) (*SyslogWriter, error) {
+	c, err := syslog.New(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("connect to syslog input failed: %s", err)
+		return nil, fmt.Errorf("syslog input: %s", err)
 	}
 
-	return &SyslogWriter{w: w, f: format}, nil
+	return &SyslogWriter{c: c, f: format}, nil
 }
 
-// Write writes alert response to the syslog input.
+// Write writes alert response to the syslog input. Each threat is sent
+// as a separate message, with its details in structured data. If the event
+// is written again after a failure, then only unsent messages are sent.
 func (w *SyslogWriter) Write(event *Event) error {
-	bs, err := w.f.Format(event)
-	if err != nil {
-		return err
+	tids := make([]string, 0, len(event.Threats))
+	for tid := range event.Threats {
+		tids = append(tids, tid)
 	}
+	sort.Strings(tids)
 
-	for n := range bs {
-		if err := w.w.Alert(string(bs[n])); err != nil {
+	var m int
+	for _, tid := range tids {
+		threat := event.Threats[tid]
+		ev := *event
+		ev.Severity = threat.Severity
+		ev.Threats = map[string]Threat{tid: threat}
+
+		bs, err := w.f.Format(&ev)
+		if err != nil {
 			return err
 		}
-	}
 
+		sd := []syslog.SDElement{{ID: SyslogSDID, Params: syslogSDParams(tid, &ev)}}
+		for n := range bs {
+			if w.progress.skip(event, m) {
+				m++
+				continue
+			}
+			if err := w.c.Send(&syslog.Message{
+				Severity:       syslogSeverity(threat.Severity),
+				Timestamp:      event.Timestamp,
+				MsgID:          event.EventType,
+				StructuredData: sd,
+				Msg:            bs[n],
+			}); err != nil {
+				return err
+			}
+			w.progress.done(m)
+			m++
+		}
+	}
+	w.progress = sendProgress{}
 	return nil
 }
 
+// syslogSDParams returns structured data params of the threat.
+func syslogSDParams(tid string, event *Event) []syslog.SDParam {
+	params := []syslog.SDParam{
+		{Name: "threat", Value: tid},
+		{Name: "severity", Value: strconv.Itoa(event.Severity)},
+		{Name: "policy", Value: strconv.FormatBool(event.Threats[tid].Policy)},
+	}
+	add := func(name, value string) {
+		if value != "" {
+			params = append(params, syslog.SDParam{Name: name, Value: value})
+		}
+	}
+	ip := func(ip net.IP) string {
+		if ip == nil {
+			return ""
+		}
+		return ip.String()
+	}
+	port := func(port uint16) string {
+		if port == 0 {
+			return ""
+		}
+		return strconv.Itoa(int(port))
+	}
+
+	add("src_ip", ip(event.SrcIP))
+	add("src_port", port(event.SrcPort))
+	add("src_host", event.SrcHost)
+	add("src_mac", event.SrcMac)
+	add("src_user", event.SrcUser)
+	if event.Asset != nil {
+		add("asset_owner", event.Asset.Owner)
+		add("asset_tag", event.Asset.Tag)
+		add("asset_criticality", event.Asset.Criticality)
+	}
+	add("dest_ip", ip(event.DestIP))
+	add("dest_port", port(event.DestPort))
+	add("dest_host", event.DestHost)
+	add("query", event.Query)
+	add("url", event.URL)
+	add("pcap_file", event.PcapFile)
+	countries, cities, as := geoSummary(event)
+	add("dest_country", countries)
+	add("dest_city", cities)
+	add("dest_as", as)
+	return params
+}
+
+// syslogSeverity maps threat severity (1-5) to syslog severity.
+func syslogSeverity(severity int) syslog.Severity {
+	switch {
+	case severity >= 5:
+		return syslog.Critical
+	case severity == 4:
+		return syslog.Error
+	case severity == 3:
+		return syslog.Warning
+	case severity == 2:
+		return syslog.Notice
+	default:
+		return syslog.Info
+	}
+}
+
 // Close closes a connecion to the syslog server.
 func (w *SyslogWriter) Close() error {
-	return w.w.Close()
+	return w.c.Close()
 }
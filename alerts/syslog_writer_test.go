@@ -0,0 +1,130 @@
+package alerts
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/syslog"
+)
+
+func TestSyslogWriter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	w, err := NewSyslogWriter(syslog.Config{
+		Network:  "udp",
+		Addr:     conn.LocalAddr().String(),
+		Facility: syslog.User,
+		Hostname: "nfr",
+		AppName:  "NFR",
+	}, &FormatterJSON{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	event := &Event{
+		EventType: "dns",
+		Threats: map[string]Threat{
+			"c2_communication": {Severity: 5, Description: "C2 communication"},
+			"young_domain":     {Severity: 2, Description: "Young domain"},
+		},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 123e6).UTC(),
+			SrcIP:     net.IPv4(10, 0, 0, 1),
+			Query:     "example.com",
+		},
+		Asset: &Asset{Owner: "it", Criticality: "high"},
+	}
+	if err := w.Write(event); err != nil {
+		t.Fatal(err)
+	}
+
+	// threats are sent in order, each with its severity
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, expected := range []string{
+		`<10>1 2018-09-06T14:09:04.123000Z nfr NFR `,
+		`<13>1 2018-09-06T14:09:04.123000Z nfr NFR `,
+	} {
+		b := make([]byte, 4096)
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := string(b[:n])
+		if !strings.HasPrefix(m, expected) {
+			t.Fatalf("got %s, expected prefix %s", m, expected)
+		}
+		if !strings.Contains(m, ` dns [nfr@32473 threat="`) || !strings.Contains(m, `src_ip="10.0.0.1"`) ||
+			!strings.Contains(m, `asset_owner="it"`) || !strings.Contains(m, `asset_criticality="high"`) {
+			t.Fatalf("invalid structured data in %s", m)
+		}
+	}
+}
+
+// failingFormatter fails to format events with the given threat.
+type failingFormatter struct {
+	FormatterJSON
+	threat string
+}
+
+func (f *failingFormatter) Format(event *Event) ([][]byte, error) {
+	if _, ok := event.Threats[f.threat]; ok {
+		return nil, errors.New("format failed")
+	}
+	return f.FormatterJSON.Format(event)
+}
+
+func TestSyslogWriterRetry(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	f := &failingFormatter{threat: "young_domain"}
+	w, err := NewSyslogWriter(syslog.Config{Network: "udp", Addr: conn.LocalAddr().String()}, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	event := &Event{
+		EventType: "dns",
+		Threats: map[string]Threat{
+			"c2_communication": {Severity: 5},
+			"young_domain":     {Severity: 2},
+		},
+	}
+	if err := w.Write(event); err == nil {
+		t.Fatal("expected format error")
+	}
+	f.threat = ""
+	if err := w.Write(event); err != nil {
+		t.Fatal(err)
+	}
+
+	// first threat is not sent again
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, expected := range []string{`threat="c2_communication"`, `threat="young_domain"`} {
+		b := make([]byte, 4096)
+		n, _, err := conn.ReadFrom(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m := string(b[:n]); !strings.Contains(m, expected) {
+			t.Fatalf("got %s, expected %s", m, expected)
+		}
+	}
+	conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := conn.ReadFrom(make([]byte, 4096)); err == nil {
+		t.Fatal("unexpected message")
+	}
+}
@@ -0,0 +1,38 @@
+package alerts
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// nfrNamespace is the namespace of uuids generated for alerts.
+var nfrNamespace = mustParseUUID("3b0d4a5e-6c1f-5f4e-9a8d-7e2c1b9f0a64")
+
+// mustParseUUID parses uuid in canonical format.
+func mustParseUUID(s string) []byte {
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 {
+		panic(fmt.Sprintf("invalid uuid %s", s))
+	}
+	return b
+}
+
+// uuid5 returns name based uuid (RFC 4122 version 5).
+func uuid5(namespace []byte, name string) string {
+	h := sha1.New()
+	h.Write(namespace)
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+	u[6] = (u[6] & 0x0f) | 0x50
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// alertUID returns uuid of the event threat, same for the same alert.
+func alertUID(event *Event, tid string) string {
+	b, _ := json.Marshal(event)
+	return uuid5(nfrNamespace, tid+"\x00"+string(b))
+}
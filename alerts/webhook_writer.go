@@ -0,0 +1,263 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+)
+
+// Default webhook writer settings.
+const (
+	DefaultWebhookBatchSize = 10
+	DefaultWebhookRetries   = 3
+	DefaultWebhookTimeout   = 10 * time.Second
+)
+
+// WebhookAlert is a single threat of an event, passed to webhook
+// template as a slice of alerts to send in one request.
+type WebhookAlert struct {
+	*Event
+
+	ThreatID string `json:"threatID"`
+	Threat   Threat `json:"threat"`
+}
+
+// Summary returns short description of the alert event.
+func (a *WebhookAlert) Summary() string {
+	switch a.EventType {
+	case "dns":
+		return fmt.Sprintf("%s query %s from %s", a.QueryType, a.Query, a.SrcIP)
+	case "ip":
+		if a.DestHost != "" {
+			return fmt.Sprintf("%s traffic from %s:%d to %s:%d (%s)", a.Proto, a.SrcIP, a.SrcPort, a.DestIP, a.DestPort, a.DestHost)
+		}
+		return fmt.Sprintf("%s traffic from %s:%d to %s:%d", a.Proto, a.SrcIP, a.SrcPort, a.DestIP, a.DestPort)
+	case "http":
+		return fmt.Sprintf("%s %s from %s", a.Method, a.URL, a.SrcIP)
+	}
+	return fmt.Sprintf("%s event from %s", a.EventType, a.SrcIP)
+}
+
+// Color returns hex color of the alert severity used in chat messages.
+func (a *WebhookAlert) Color() string {
+	switch {
+	case a.Threat.Severity >= 4:
+		return "d63333"
+	case a.Threat.Severity == 3:
+		return "f2a33a"
+	default:
+		return "439fe0"
+	}
+}
+
+// Prebuilt webhook templates.
+var WebhookTemplates = map[string]string{
+	"json": `{{json .}}`,
+	"slack": `{"text": {{json (printf "%d new NFR alert(s)" (len .))}}, "attachments": [
+{{- range $i, $a := .}}{{if $i}}, {{end -}}
+{"color": "#{{$a.Color}}", "title": {{json $a.Threat.Description}}, "text": {{json $a.Summary}}, "footer": {{json $a.ThreatID}}, "ts": {{$a.Timestamp.Unix}}}
+{{- end}}]}`,
+	"teams": `{"@type": "MessageCard", "@context": "https://schema.org/extensions", "summary": {{json (printf "%d new NFR alert(s)" (len .))}}, "themeColor": "d63333", "title": {{json (printf "%d new NFR alert(s)" (len .))}}, "sections": [
+{{- range $i, $a := .}}{{if $i}}, {{end -}}
+{"activityTitle": {{json $a.Threat.Description}}, "activitySubtitle": {{json $a.Summary}}, "facts": [{"name": "Threat", "value": {{json $a.ThreatID}}}, {"name": "Severity", "value": "{{$a.Threat.Severity}}"}, {"name": "Source", "value": {{json $a.SrcIP.String}}}, {"name": "Time", "value": {{json $a.Timestamp.String}}}]}
+{{- end}}]}`,
+	"ocsf": `[{{range $i, $a := .}}{{if $i}}, {{end}}{{ocsf $a}}{{end}}]`,
+	"stix": `{{stix .}}`,
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"join": strings.Join,
+	"stix": webhookSTIX,
+}
+
+// webhookOCSF returns ocsf template function, which formats the alert
+// as OCSF event of the default class, or class given as an argument.
+func webhookOCSF(defaultClass string) func(*WebhookAlert, ...string) (string, error) {
+	return func(a *WebhookAlert, class ...string) (string, error) {
+		c := defaultClass
+		if len(class) > 0 {
+			c = class[0]
+		}
+		f, err := NewFormatterOCSF(c)
+		if err != nil {
+			return "", err
+		}
+		b, err := json.Marshal(f.newEvent(a.Event, a.ThreatID, a.Threat))
+		return string(b), err
+	}
+}
+
+// webhookSTIX returns the alerts as one STIX bundle.
+func webhookSTIX(alerts []*WebhookAlert) (string, error) {
+	// threats of an event may be split between batches,
+	// so only the ones in this batch are put in the bundle
+	var (
+		events  []*Event
+		threats = make(map[*Event]*Event)
+	)
+	for _, a := range alerts {
+		ev, ok := threats[a.Event]
+		if !ok {
+			e := *a.Event
+			e.Threats = make(map[string]Threat)
+			ev = &e
+			threats[a.Event] = ev
+			events = append(events, ev)
+		}
+		ev.Threats[a.ThreatID] = a.Threat
+	}
+	b, err := json.Marshal(newSTIXBundle(events))
+	return string(b), err
+}
+
+// NewWebhookTemplate parses webhook body template. It may use json, join, ocsf and stix functions.
+// The ocsf function formats alerts as events of ocsfClass, if no class is given,
+// and detection_finding if ocsfClass is empty.
+func NewWebhookTemplate(text, ocsfClass string) (*template.Template, error) {
+	return template.New("webhook").
+		Funcs(webhookFuncs).
+		Funcs(template.FuncMap{"ocsf": webhookOCSF(ocsfClass)}).
+		Parse(text)
+}
+
+// WebhookConfig is a configuration of webhook writer.
+type WebhookConfig struct {
+	URL     string
+	Headers map[string]string
+	// Template executed with []*WebhookAlert to render request body.
+	Template *template.Template
+	// ContentType of request body. Default: application/json
+	ContentType string
+
+	// BatchSize is the maximum number of alerts sent in one request.
+	BatchSize int
+	// Retries is the number of retries of failed request.
+	Retries int
+	// Timeout of a single request.
+	Timeout time.Duration
+}
+
+// WebhookWriter implements Writer interface and sends
+// api alerts to http webhook in batches.
+type WebhookWriter struct {
+	cfg    WebhookConfig
+	client *http.Client
+	alerts []*WebhookAlert
+
+	// retryWait is the wait time before first retry, doubled on next ones.
+	retryWait time.Duration
+}
+
+// NewWebhookWriter creates new webhook writer.
+func NewWebhookWriter(cfg WebhookConfig) (*WebhookWriter, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("webhook url required")
+	}
+	if cfg.Template == nil {
+		cfg.Template, _ = NewWebhookTemplate(WebhookTemplates["json"], "")
+	}
+	if cfg.ContentType == "" {
+		cfg.ContentType = "application/json"
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultWebhookBatchSize
+	}
+	if cfg.Retries < 0 {
+		cfg.Retries = 0
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultWebhookTimeout
+	}
+
+	return &WebhookWriter{
+		cfg:       cfg,
+		client:    &http.Client{Timeout: cfg.Timeout},
+		retryWait: time.Second,
+	}, nil
+}
+
+// Write adds alert to the batch, and sends it if the batch is full.
+func (w *WebhookWriter) Write(event *Event) error {
+	// event is kept in the batch, while caller may reuse it
+	ev := *event
+	for tid, threat := range ev.Threats {
+		w.alerts = append(w.alerts, &WebhookAlert{Event: &ev, ThreatID: tid, Threat: threat})
+		if len(w.alerts) >= w.cfg.BatchSize {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Flush sends all buffered alerts to the webhook.
+func (w *WebhookWriter) Flush() error {
+	if len(w.alerts) == 0 {
+		return nil
+	}
+	// failed batch is dropped, so it doesn't block next alerts
+	alerts := w.alerts
+	w.alerts = nil
+
+	var body bytes.Buffer
+	if err := w.cfg.Template.Execute(&body, alerts); err != nil {
+		return fmt.Errorf("webhook template: %s", err)
+	}
+
+	wait := w.retryWait
+	for try := 0; ; try++ {
+		retry, err := w.send(body.Bytes())
+		if err == nil {
+			return nil
+		}
+		if !retry || try >= w.cfg.Retries {
+			return fmt.Errorf("send %d alerts to webhook failed: %s", len(alerts), err)
+		}
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// send sends request to the webhook. It returns true if failed request should be retried.
+func (w *WebhookWriter) send(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, w.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", w.cfg.ContentType)
+	req.Header.Set("User-Agent", client.DefaultUserAgent)
+	for key, value := range w.cfg.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("unexpected status %s", resp.Status)
+}
+
+// Close sends buffered alerts.
+func (w *WebhookWriter) Close() error {
+	return w.Flush()
+}
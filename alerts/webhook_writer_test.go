@@ -0,0 +1,170 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+)
+
+func newTestEvent(tid string) *Event {
+	return &Event{
+		EventType: "dns",
+		Threats: map[string]Threat{
+			tid: Threat{
+				Severity:    4,
+				Description: "C2 communication",
+			},
+		},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 0).UTC(),
+			SrcIP:     net.IPv4(1, 2, 3, 4),
+			Query:     "virus.com",
+			QueryType: "A",
+		},
+	}
+}
+
+func TestWebhookWriter(t *testing.T) {
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("invalid authorization header - got %q", r.Header.Get("Authorization"))
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, b)
+	}))
+	defer srv.Close()
+
+	w, err := NewWebhookWriter(WebhookConfig{
+		URL:       srv.URL,
+		Headers:   map[string]string{"Authorization": "Bearer token"},
+		BatchSize: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tid := range []string{"c2_comm", "dga", "tunnel"} {
+		if err := w.Write(newTestEvent(tid)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(bodies) != 1 {
+		t.Fatalf("invalid number of requests before flush - got %d; expected %d", len(bodies), 1)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("invalid number of requests after flush - got %d; expected %d", len(bodies), 2)
+	}
+
+	var alerts []WebhookAlert
+	if err := json.Unmarshal(bodies[0], &alerts); err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 2 || alerts[0].ThreatID != "c2_comm" || alerts[1].ThreatID != "dga" {
+		t.Fatalf("invalid alerts in batch - got %s", bodies[0])
+	}
+	if alerts[0].Query != "virus.com" {
+		t.Fatalf("invalid alert query - got %s; expected %s", alerts[0].Query, "virus.com")
+	}
+}
+
+func TestWebhookWriterRetry(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	w, err := NewWebhookWriter(WebhookConfig{URL: srv.URL, BatchSize: 1, Retries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.retryWait = time.Millisecond
+
+	if err := w.Write(newTestEvent("c2_comm")); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Fatalf("invalid number of requests - got %d; expected %d", requests, 3)
+	}
+
+	requests = 0
+	w.cfg.Retries = 1
+	if err := w.Write(newTestEvent("c2_comm")); err == nil {
+		t.Fatal("no error after all retries failed")
+	}
+}
+
+func TestWebhookTemplates(t *testing.T) {
+	for name, text := range WebhookTemplates {
+		tmpl, err := NewWebhookTemplate(text, "")
+		if err != nil {
+			t.Fatalf("%s template: %s", name, err)
+		}
+
+		var body []byte
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = ioutil.ReadAll(r.Body)
+		}))
+
+		w, err := NewWebhookWriter(WebhookConfig{URL: srv.URL, Template: tmpl})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(newTestEvent("c2_comm"))
+		w.Write(newTestEvent("dga"))
+		if err := w.Flush(); err != nil {
+			t.Fatalf("%s template: %s", name, err)
+		}
+		srv.Close()
+
+		if !json.Valid(body) {
+			t.Fatalf("%s template: invalid json %s", name, body)
+		}
+	}
+}
+
+func TestWebhookOCSFClass(t *testing.T) {
+	for class, uid := range map[string]int{"": 2004, "detection_finding": 2004, "network_activity": 4001} {
+		tmpl, err := NewWebhookTemplate(WebhookTemplates["ocsf"], class)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var body []byte
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ = ioutil.ReadAll(r.Body)
+		}))
+		w, err := NewWebhookWriter(WebhookConfig{URL: srv.URL, Template: tmpl})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(newTestEvent("c2_comm"))
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		srv.Close()
+
+		var events []struct {
+			ClassUID int `json:"class_uid"`
+		}
+		if err := json.Unmarshal(body, &events); err != nil {
+			t.Fatal(err)
+		}
+		if len(events) != 1 || events[0].ClassUID != uid {
+			t.Fatalf("%q class: got %+v, expected class_uid %d", class, events, uid)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 	"sort"
 	"strings"
+	"testing"
 	"time"
 
 	"github.com/alphasoc/nfr/client"
@@ -19,6 +20,19 @@ func bytesToSortedStrings(bs [][]byte) []string {
 	return s
 }
 
+func TestDefaultCEFFieldsKeys(t *testing.T) {
+	keys := make(map[string]string)
+	for field, f := range DefaultCEFFields {
+		if f.Key == "" {
+			continue
+		}
+		if other, ok := keys[f.Key]; ok {
+			t.Errorf("fields %s and %s have the same CEF key %s", field, other, f.Key)
+		}
+		keys[f.Key] = field
+	}
+}
+
 func ExampleFormatterCEF_dns() {
 	f := NewFormatterCEF()
 
@@ -51,8 +65,8 @@ func ExampleFormatterCEF_dns() {
 	fmt.Print(strings.Join(bytesToSortedStrings(bs), "\n"))
 
 	// Output:
-	// CEF:0|AlphaSOC|NFR|0.0.0|c2_comm|C2 communication|10|app=dns rt=Sep 06 2018 14:09:04.123 UTC src=1.2.3.4 cs1=c2,young_domain cs1Label=flags cs2=boston cs2Label=groups query=virus.com requestMethod=A
-	// CEF:0|AlphaSOC|NFR|0.0.0|interesting|Interesting event|4|app=dns rt=Sep 06 2018 14:09:04.123 UTC src=1.2.3.4 cs1=c2,young_domain cs1Label=flags cs2=boston cs2Label=groups query=virus.com requestMethod=A
+	// CEF:0|AlphaSOC|NFR|0.0.0|c2_comm|C2 communication|10|app=dns rt=Sep 06 2018 14:09:04.123 UTC src=1.2.3.4 cs1=c2,young_domain cs1Label=flags cs2=boston cs2Label=groups query=virus.com queryType=A
+	// CEF:0|AlphaSOC|NFR|0.0.0|interesting|Interesting event|4|app=dns rt=Sep 06 2018 14:09:04.123 UTC src=1.2.3.4 cs1=c2,young_domain cs1Label=flags cs2=boston cs2Label=groups query=virus.com queryType=A
 }
 
 func ExampleFormatterCEF_ip() {
@@ -94,3 +108,229 @@ func ExampleFormatterCEF_ip() {
 	// CEF:0|AlphaSOC|NFR|0.0.0|c2_comm|C2 communication|10|app=ip rt=Sep 06 2018 14:09:04.123 UTC src=1.2.3.4 cs1=c2,young_domain cs1Label=flags cs2=boston cs2Label=groups spt=16830 dst=4.3.2.1 dpt=443 proto=tcp in=744 out=1376
 	// CEF:0|AlphaSOC|NFR|0.0.0|interesting|Interesting event|4|app=ip rt=Sep 06 2018 14:09:04.123 UTC src=1.2.3.4 cs1=c2,young_domain cs1Label=flags cs2=boston cs2Label=groups spt=16830 dst=4.3.2.1 dpt=443 proto=tcp in=744 out=1376
 }
+
+func ExampleFormatterLEEF_dns() {
+	f := NewFormatterLEEF()
+
+	bs, err := f.Format(&Event{
+		EventType: "dns",
+		Flags:     []string{"c2", "young_domain"},
+		Groups:    []Group{Group{Label: "boston"}},
+		Threats: map[string]Threat{
+			"c2_comm": Threat{
+				Severity:    5,
+				Description: "C2 communication",
+			},
+		},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 123e6).UTC(),
+			SrcIP:     net.IPv4(1, 2, 3, 4),
+			Query:     "virus.com",
+			QueryType: "A",
+		},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(strings.Replace(string(bs[0]), "\t", " ", -1))
+
+	// Output:
+	// LEEF:2.0|AlphaSOC|NFR|0.0.0|c2_comm|cat=dns sev=10 policy=0 description=C2 communication flags=c2,young_domain groups=boston devTimeFormat=MMM dd yyyy HH:mm:ss devTime=Sep 06 2018 14:09:04 src=1.2.3.4 query=virus.com recordType=A
+}
+
+func ExampleFormatterLEEF_ip() {
+	f := NewFormatterLEEF()
+
+	bs, err := f.Format(&Event{
+		EventType: "ip",
+		Threats: map[string]Threat{
+			"c2_comm": Threat{
+				Severity:    5,
+				Description: "C2 communication",
+			},
+		},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 123e6).UTC(),
+			SrcIP:     net.IPv4(1, 2, 3, 4),
+			SrcPort:   16830,
+			DestIP:    net.IPv4(4, 3, 2, 1),
+			DestPort:  443,
+			Proto:     "tcp",
+			BytesIn:   744,
+			BytesOut:  1376,
+		},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(strings.Replace(string(bs[0]), "\t", " ", -1))
+
+	// Output:
+	// LEEF:2.0|AlphaSOC|NFR|0.0.0|c2_comm|cat=ip sev=10 policy=0 description=C2 communication devTimeFormat=MMM dd yyyy HH:mm:ss devTime=Sep 06 2018 14:09:04 src=1.2.3.4 proto=tcp srcPort=16830 dst=4.3.2.1 dstPort=443 srcBytes=1376 dstBytes=744
+}
+
+func ExampleFormatterLEEF_http() {
+	f := NewFormatterLEEF()
+
+	bs, err := f.Format(&Event{
+		EventType: "http",
+		Threats: map[string]Threat{
+			"c2_comm": Threat{
+				Severity:    5,
+				Description: "C2 communication",
+				Policy:      true,
+			},
+		},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 123e6).UTC(),
+			SrcIP:     net.IPv4(1, 2, 3, 4),
+			URL:       "http://virus.com/payload",
+			Method:    "GET",
+			Status:    200,
+		},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(strings.Replace(string(bs[0]), "\t", " ", -1))
+
+	// Output:
+	// LEEF:2.0|AlphaSOC|NFR|0.0.0|c2_comm|cat=http sev=10 policy=1 description=C2 communication devTimeFormat=MMM dd yyyy HH:mm:ss devTime=Sep 06 2018 14:09:04 src=1.2.3.4 url=http://virus.com/payload method=GET status=200
+}
+
+func TestFormatterLEEFHTTPOptional(t *testing.T) {
+	bs, err := NewFormatterLEEF().Format(&Event{
+		EventType:    "http",
+		Threats:      map[string]Threat{"c2_comm": {Severity: 5}},
+		EventUnified: client.EventUnified{URL: "http://virus.com/payload"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := string(bs[0]); strings.Contains(m, "method=") || strings.Contains(m, "status=") {
+		t.Fatalf("unset http fields in %s", m)
+	}
+}
+
+func ExampleFormatterCEF_enriched() {
+	f := NewFormatterCEF()
+
+	bs, err := f.Format(&Event{
+		EventType: "dns",
+		Threats: map[string]Threat{
+			"c2_comm": Threat{
+				Severity:    5,
+				Description: "C2 communication",
+			},
+		},
+		Asset: &Asset{
+			Owner:       "jdoe",
+			Tag:         "LT-0042",
+			Criticality: "high",
+		},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 123e6).UTC(),
+			SrcIP:     net.IPv4(1, 2, 3, 4),
+			SrcHost:   "laptop.corp",
+			SrcMac:    "00:11:22:33:44:55",
+			SrcUser:   "jdoe",
+			Query:     "virus.com",
+			QueryType: "A",
+		},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(strings.Join(bytesToSortedStrings(bs), "\n"))
+
+	// Output:
+	// CEF:0|AlphaSOC|NFR|0.0.0|c2_comm|C2 communication|10|app=dns rt=Sep 06 2018 14:09:04.123 UTC src=1.2.3.4 shost=laptop.corp smac=00:11:22:33:44:55 suser=jdoe cs3=jdoe cs3Label=assetOwner cs4=LT-0042 cs4Label=assetTag cs5=high cs5Label=assetCriticality query=virus.com queryType=A
+}
+
+func ExampleFormatterCEF_http() {
+	f, err := NewFormatterCEFWithConfig(CEFConfig{
+		Vendor: "Example",
+		Fields: map[string]CEFField{
+			"flags":        {Key: "cs3", Label: "nfrFlags"},
+			"groups":       {},
+			"content_type": {Key: "cs4", Label: "contentType"},
+		},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	bs, err := f.Format(&Event{
+		EventType: "http",
+		Flags:     []string{"c2"},
+		Groups:    []Group{Group{Label: "boston"}},
+		Threats: map[string]Threat{
+			"c2_comm": Threat{
+				Severity:    5,
+				Description: "C2 communication",
+			},
+		},
+		EventUnified: client.EventUnified{
+			Timestamp:   time.Unix(1536242944, 123e6).UTC(),
+			SrcIP:       net.IPv4(1, 2, 3, 4),
+			DestIP:      net.IPv4(4, 3, 2, 1),
+			DestPort:    443,
+			URL:         "https://virus.com/payload",
+			Method:      "GET",
+			Status:      200,
+			ContentType: "application/octet-stream",
+			UserAgent:   "curl/7.68.0",
+			Ja3:         "e7d705a3286e19ea42f587b344ee6865",
+		},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(strings.Join(bytesToSortedStrings(bs), "\n"))
+
+	// Output:
+	// CEF:0|Example|NFR|0.0.0|c2_comm|C2 communication|10|app=http rt=Sep 06 2018 14:09:04.123 UTC src=1.2.3.4 cs3=c2 cs3Label=nfrFlags dst=4.3.2.1 dpt=443 request=https://virus.com/payload requestMethod=GET cn1=200 cn1Label=status requestClientApplication=curl/7.68.0 cs4=application/octet-stream cs4Label=contentType cs6=e7d705a3286e19ea42f587b344ee6865 cs6Label=ja3
+}
+
+func ExampleFormatterOCSF_dns() {
+	f, err := NewFormatterOCSF(OCSFDetectionFinding)
+	if err != nil {
+		panic(err)
+	}
+
+	bs, err := f.Format(&Event{
+		EventType: "dns",
+		Flags:     []string{"c2"},
+		Threats: map[string]Threat{
+			"c2_comm": Threat{
+				Severity:    5,
+				Description: "C2 communication",
+			},
+		},
+		EventUnified: client.EventUnified{
+			Timestamp: time.Unix(1536242944, 123e6).UTC(),
+			SrcIP:     net.IPv4(1, 2, 3, 4),
+			Query:     "virus.com",
+			QueryType: "A",
+		},
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Print(strings.Join(bytesToSortedStrings(bs), "\n"))
+
+	// Output:
+	// {"activity_id":1,"activity_name":"Create","category_uid":2,"category_name":"Findings","class_uid":2004,"class_name":"Detection Finding","type_uid":200401,"type_name":"Detection Finding: Create","severity_id":5,"severity":"Critical","status_id":1,"status":"New","time":1536242944123,"message":"C2 communication","metadata":{"version":"1.1.0","uid":"3428d3f0-b178-5575-a416-119e8d6cc9c7","product":{"name":"NFR","vendor_name":"AlphaSOC","version":"0.0.0"},"labels":["c2"]},"finding_info":{"uid":"3428d3f0-b178-5575-a416-119e8d6cc9c7","title":"C2 communication","types":["dns"],"analytic":{"uid":"c2_comm","name":"C2 communication","type_id":1,"type":"Rule"}},"evidences":[{"src_endpoint":{"ip":"1.2.3.4"},"query":{"hostname":"virus.com","type":"A"}}],"unmapped":{"policy":false,"threat":"c2_comm"}}
+}
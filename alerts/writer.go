@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/alphasoc/nfr/leef"
 	"github.com/alphasoc/nfr/version"
 	"github.com/xoebus/ceflog"
 )
@@ -16,6 +17,34 @@ type Writer interface {
 	Write(*Event) error
 }
 
+// Flusher is implemented by writers buffering alerts. Flush is called
+// after all alerts pending in the writer queue are written.
+type Flusher interface {
+	Flush() error
+}
+
+// sendProgress tracks messages of an event already sent by a writer
+// sending one message per threat. When the queue writes the event again
+// after a failure, the sent messages are skipped. Events loaded from
+// the queue file after restart are not tracked and may be sent twice.
+type sendProgress struct {
+	event *Event
+	sent  int
+}
+
+// skip returns true if the n-th message of the event was already sent.
+func (p *sendProgress) skip(event *Event, n int) bool {
+	if p.event != event {
+		p.event, p.sent = event, 0
+	}
+	return n < p.sent
+}
+
+// done marks the n-th message of the event as sent.
+func (p *sendProgress) done(n int) {
+	p.sent = n + 1
+}
+
 type Formatter interface {
 	Format(*Event) ([][]byte, error)
 }
@@ -30,6 +59,7 @@ func (FormatterJSON) Format(event *Event) ([][]byte, error) {
 
 type FormatterCEF struct {
 	vendor, product, version string
+	fields                   map[string]CEFField
 }
 
 func NewFormatterCEF() *FormatterCEF {
@@ -37,9 +67,92 @@ func NewFormatterCEF() *FormatterCEF {
 		vendor:  DefaultLogVendor,
 		product: DefaultLogProduct,
 		version: DefaultLogVersion,
+		fields:  DefaultCEFFields,
 	}
 }
 
+// CEFField is a CEF extension key of an event field. If Label is set, then
+// also key+"Label" extension is added, as for custom fields, e.g. cs1Label.
+// If Key is empty, then the field is omitted.
+type CEFField struct {
+	Key   string
+	Label string
+}
+
+// DefaultCEFFields maps event fields to CEF extensions.
+var DefaultCEFFields = map[string]CEFField{
+	"event_type":        {Key: "app"},
+	"timestamp":         {Key: "rt"},
+	"src_ip":            {Key: "src"},
+	"flags":             {Key: "cs1", Label: "flags"},
+	"groups":            {Key: "cs2", Label: "groups"},
+	"src_host":          {Key: "shost"},
+	"src_mac":           {Key: "smac"},
+	"src_user":          {Key: "suser"},
+	"asset_owner":       {Key: "cs3", Label: "assetOwner"},
+	"asset_tag":         {Key: "cs4", Label: "assetTag"},
+	"asset_criticality": {Key: "cs5", Label: "assetCriticality"},
+	"pcap_file":         {Key: "filePath"},
+	"dest_country":      {Key: "flexString1", Label: "destCountry"},
+	"dest_city":         {Key: "flexString2", Label: "destCity"},
+	"dest_as":           {},
+	"query":             {Key: "query"},
+	"query_type":        {Key: "queryType"},
+	"src_port":          {Key: "spt"},
+	"dest_ip":           {Key: "dst"},
+	"dest_port":         {Key: "dpt"},
+	"dest_host":         {Key: "dhost"},
+	"proto":             {Key: "proto"},
+	"bytes_in":          {Key: "in"},
+	"bytes_out":         {Key: "out"},
+	"url":               {Key: "request"},
+	"method":            {Key: "requestMethod"},
+	"status":            {Key: "cn1", Label: "status"},
+	"user_agent":        {Key: "requestClientApplication"},
+	"referrer":          {Key: "requestContext"},
+	"content_type":      {},
+	"ja3":               {Key: "cs6", Label: "ja3"},
+	"suppressed":        {Key: "cn2", Label: "suppressed"},
+}
+
+// CEFConfig is a configuration of CEF formatter. Empty values are defaults.
+type CEFConfig struct {
+	Vendor  string
+	Product string
+	Version string
+	// Fields overrides DefaultCEFFields.
+	Fields map[string]CEFField
+}
+
+// NewFormatterCEFWithConfig creates CEF formatter with custom header and field map.
+func NewFormatterCEFWithConfig(cfg CEFConfig) (*FormatterCEF, error) {
+	f := NewFormatterCEF()
+	if cfg.Vendor != "" {
+		f.vendor = cfg.Vendor
+	}
+	if cfg.Product != "" {
+		f.product = cfg.Product
+	}
+	if cfg.Version != "" {
+		f.version = cfg.Version
+	}
+	if len(cfg.Fields) == 0 {
+		return f, nil
+	}
+
+	f.fields = make(map[string]CEFField, len(DefaultCEFFields))
+	for name, field := range DefaultCEFFields {
+		f.fields[name] = field
+	}
+	for name, field := range cfg.Fields {
+		if _, ok := DefaultCEFFields[name]; !ok {
+			return nil, fmt.Errorf("unknown cef field %s", name)
+		}
+		f.fields[name] = field
+	}
+	return f, nil
+}
+
 var (
 	DefaultLogVendor  = "AlphaSOC"
 	DefaultLogProduct = "NFR"
@@ -48,50 +161,116 @@ var (
 	cefTimeFormat = "Jan 02 2006 15:04:05.000 MST"
 )
 
-func cefCustomString(id int, label, value string) []ceflog.Pair {
-	key := fmt.Sprintf("cs%d", id)
-	return []ceflog.Pair{
-		{key, value},
-		{key + "Label", label},
-	}
-}
-
 func (f *FormatterCEF) Format(event *Event) ([][]byte, error) {
 	var res [][]byte
 
 	// CEF log extensions
-	ext := ceflog.Extension{
-		{"app", event.EventType},
-		{"rt", event.Timestamp.Format(cefTimeFormat)},
-		{"src", event.SrcIP.String()},
+	var ext ceflog.Extension
+	add := func(name, value string) {
+		field := f.fields[name]
+		if field.Key == "" {
+			return
+		}
+		ext = append(ext, ceflog.Pair{Key: field.Key, Value: value})
+		if field.Label != "" {
+			ext = append(ext, ceflog.Pair{Key: field.Key + "Label", Value: field.Label})
+		}
 	}
 
+	add("event_type", event.EventType)
+	add("timestamp", event.Timestamp.Format(cefTimeFormat))
+	add("src_ip", event.SrcIP.String())
+
 	if v := strings.Join(event.Flags, ","); v != "" {
-		ext = append(ext, cefCustomString(1, "flags", v)...)
+		add("flags", v)
 	}
 	if len(event.Groups) > 0 {
 		groups := make([]string, len(event.Groups))
 		for n := range event.Groups {
 			groups[n] = event.Groups[n].Label
 		}
-		ext = append(ext, cefCustomString(2, "groups", strings.Join(groups, ","))...)
+		add("groups", strings.Join(groups, ","))
+	}
+	if event.SrcHost != "" {
+		add("src_host", event.SrcHost)
+	}
+	if event.SrcMac != "" {
+		add("src_mac", event.SrcMac)
+	}
+	if event.SrcUser != "" {
+		add("src_user", event.SrcUser)
+	}
+	if event.Asset != nil {
+		if event.Asset.Owner != "" {
+			add("asset_owner", event.Asset.Owner)
+		}
+		if event.Asset.Tag != "" {
+			add("asset_tag", event.Asset.Tag)
+		}
+		if event.Asset.Criticality != "" {
+			add("asset_criticality", event.Asset.Criticality)
+		}
+	}
+	if event.PcapFile != "" {
+		add("pcap_file", event.PcapFile)
+	}
+	countries, cities, as := geoSummary(event)
+	if countries != "" {
+		add("dest_country", countries)
+	}
+	if cities != "" {
+		add("dest_city", cities)
+	}
+	if as != "" {
+		add("dest_as", as)
 	}
 
 	switch event.EventType {
 	case "dns":
-		ext = append(ext, ceflog.Extension{
-			{"query", event.Query},
-			{"requestMethod", event.QueryType},
-		}...)
+		add("query", event.Query)
+		add("query_type", event.QueryType)
 	case "ip":
-		ext = append(ext, ceflog.Extension{
-			{"spt", strconv.Itoa(int(event.SrcPort))},
-			{"dst", event.DestIP.String()},
-			{"dpt", strconv.Itoa(int(event.DestPort))},
-			{"proto", event.Proto},
-			{"in", strconv.Itoa(int(event.BytesIn))},
-			{"out", strconv.Itoa(int(event.BytesOut))},
-		}...)
+		add("src_port", strconv.Itoa(int(event.SrcPort)))
+		add("dest_ip", event.DestIP.String())
+		add("dest_port", strconv.Itoa(int(event.DestPort)))
+		if event.DestHost != "" {
+			add("dest_host", event.DestHost)
+		}
+		add("proto", event.Proto)
+		add("bytes_in", strconv.Itoa(int(event.BytesIn)))
+		add("bytes_out", strconv.Itoa(int(event.BytesOut)))
+	case "http":
+		if event.DestIP != nil {
+			add("dest_ip", event.DestIP.String())
+		}
+		if event.DestPort != 0 {
+			add("dest_port", strconv.Itoa(int(event.DestPort)))
+		}
+		if event.DestHost != "" {
+			add("dest_host", event.DestHost)
+		}
+		add("url", event.URL)
+		if event.Method != "" {
+			add("method", event.Method)
+		}
+		if event.Status != 0 {
+			add("status", strconv.Itoa(int(event.Status)))
+		}
+		if event.UserAgent != "" {
+			add("user_agent", event.UserAgent)
+		}
+		if event.Referrer != "" {
+			add("referrer", event.Referrer)
+		}
+		if event.ContentType != "" {
+			add("content_type", event.ContentType)
+		}
+	}
+	if event.Ja3 != "" {
+		add("ja3", event.Ja3)
+	}
+	if event.Suppressed > 0 {
+		add("suppressed", strconv.Itoa(event.Suppressed))
 	}
 
 	// Format each threat as a separate event
@@ -111,3 +290,133 @@ func (f *FormatterCEF) Format(event *Event) ([][]byte, error) {
 
 	return res, nil
 }
+
+type FormatterLEEF struct {
+	vendor, product, version string
+}
+
+func NewFormatterLEEF() *FormatterLEEF {
+	return &FormatterLEEF{
+		vendor:  DefaultLogVendor,
+		product: DefaultLogProduct,
+		version: strings.TrimPrefix(DefaultLogVersion, "v"),
+	}
+}
+
+var (
+	leefTimeFormat       = "Jan 02 2006 15:04:05"
+	leefDevTimeFormatKey = "MMM dd yyyy HH:mm:ss"
+)
+
+func (f *FormatterLEEF) Format(event *Event) ([][]byte, error) {
+	var res [][]byte
+
+	// Format each threat as a separate event
+	for threatID, threat := range event.Threats {
+		e := leef.NewEvent()
+		e.SetHeader(f.vendor, f.product, f.version, threatID)
+
+		e.SetCatAttr(event.EventType)
+		e.SetSevAttr(threat.Severity * 2) // 0-10 scale
+		if threat.Policy {
+			e.SetPolicyAttr("1")
+		} else {
+			e.SetPolicyAttr("0")
+		}
+		e.SetAttr("description", threat.Description)
+		if v := strings.Join(event.Flags, ","); v != "" {
+			e.SetAttr("flags", v)
+		}
+		if len(event.Groups) > 0 {
+			groups := make([]string, len(event.Groups))
+			for n := range event.Groups {
+				groups[n] = event.Groups[n].Label
+			}
+			e.SetAttr("groups", strings.Join(groups, ","))
+		}
+
+		e.SetDevTimeFormatAttr(leefDevTimeFormatKey)
+		e.SetDevTimeAttr(event.Timestamp.Format(leefTimeFormat))
+		e.SetSrcAttr(event.SrcIP)
+		if event.SrcHost != "" {
+			e.SetIdentHostNameAttr(event.SrcHost)
+		}
+		if event.SrcUser != "" {
+			e.SetUserNameAttr(event.SrcUser)
+		}
+		if event.SrcMac != "" {
+			e.SetAttr("srcMAC", event.SrcMac)
+		}
+		if event.Asset != nil {
+			if event.Asset.Owner != "" {
+				e.SetAttr("assetOwner", event.Asset.Owner)
+			}
+			if event.Asset.Tag != "" {
+				e.SetAttr("assetTag", event.Asset.Tag)
+			}
+			if event.Asset.Criticality != "" {
+				e.SetAttr("assetCriticality", event.Asset.Criticality)
+			}
+		}
+		if event.PcapFile != "" {
+			e.SetAttr("pcapFile", event.PcapFile)
+		}
+		countries, cities, as := geoSummary(event)
+		if countries != "" {
+			e.SetAttr("dstCountry", countries)
+		}
+		if cities != "" {
+			e.SetAttr("dstCity", cities)
+		}
+		if as != "" {
+			e.SetAttr("dstAS", as)
+		}
+
+		switch event.EventType {
+		case "dns":
+			e.SetAttr("query", event.Query)
+			e.SetAttr("recordType", event.QueryType)
+		case "ip":
+			e.SetProtoAttr(event.Proto)
+			e.SetSrcPortAttr(int(event.SrcPort))
+			e.SetDstAttr(event.DestIP)
+			e.SetDstPortAttr(int(event.DestPort))
+			if event.DestHost != "" {
+				e.SetAttr("dstHost", event.DestHost)
+			}
+			// bytes sent by the source are bytes out of the local host
+			e.SetSrcBytesAttr(int(event.BytesOut))
+			e.SetDstBytesAttr(int(event.BytesIn))
+		case "http":
+			if event.DestIP != nil {
+				e.SetDstAttr(event.DestIP)
+			}
+			if event.DestPort != 0 {
+				e.SetDstPortAttr(int(event.DestPort))
+			}
+			if event.DestHost != "" {
+				e.SetAttr("dstHost", event.DestHost)
+			}
+			e.SetURLAttr(event.URL)
+			if event.Method != "" {
+				e.SetAttr("method", event.Method)
+			}
+			if event.Status != 0 {
+				e.SetAttr("status", strconv.Itoa(int(event.Status)))
+			}
+			if event.ContentType != "" {
+				e.SetAttr("contentType", event.ContentType)
+			}
+			if event.Referrer != "" {
+				e.SetAttr("referrer", event.Referrer)
+			}
+			if event.UserAgent != "" {
+				e.SetAttr("userAgent", event.UserAgent)
+			}
+		}
+
+		res = append(res, []byte(strings.TrimRight(e.String(), "\t")))
+	}
+
+	return res, nil
+}
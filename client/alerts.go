@@ -41,8 +41,12 @@ type EventUnified struct {
 	// IP fields
 	DestIP   net.IP `json:"destIP,omitempty"`
 	DestPort uint16 `json:"destPort,omitempty"`
+	// DestHost is the name resolved to the destination ip, from passive dns.
+	DestHost string `json:"destHost,omitempty"`
 	Proto    string `json:"proto,omitempty"`
 	Ja3      string `json:"ja3,omitempty"`
+	// Internal is set for traffic between two home networks.
+	Internal bool `json:"internal,omitempty"`
 
 	// HTTP fields
 	URL         string `json:"url,omitempty"`
@@ -80,13 +84,33 @@ type Threat struct {
 
 // Alerts returns AlphaSOC events that informs about potential risk.
 func (c *AlphaSOCClient) Alerts(follow string) (*AlertsResponse, error) {
-	if c.key == "" {
-		return nil, ErrNoAPIKey
+	query := url.Values{}
+	if follow != "" {
+		query.Add("follow", follow)
 	}
+	return c.alerts(query)
+}
+
+// AlertsRange returns alerts of events between after and before time.
+// Next pages of the range are returned for follow from previous response.
+func (c *AlphaSOCClient) AlertsRange(follow string, after, before time.Time) (*AlertsResponse, error) {
 	query := url.Values{}
 	if follow != "" {
 		query.Add("follow", follow)
 	}
+	if !after.IsZero() {
+		query.Add("after", after.UTC().Format(time.RFC3339))
+	}
+	if !before.IsZero() {
+		query.Add("before", before.UTC().Format(time.RFC3339))
+	}
+	return c.alerts(query)
+}
+
+func (c *AlphaSOCClient) alerts(query url.Values) (*AlertsResponse, error) {
+	if c.key == "" {
+		return nil, ErrNoAPIKey
+	}
 	resp, err := c.get(context.Background(), "alerts", query)
 	if err != nil {
 		return nil, err
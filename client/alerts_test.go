@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -33,6 +34,20 @@ func TestAlertsFollow(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestAlertsRange(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.RawQuery != "after=2021-03-01T00%3A00%3A00Z&before=2021-03-02T00%3A00%3A00Z&follow=1" {
+			t.Fatalf("invalid query %s", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(&AlertsResponse{})
+	}))
+	defer ts.Close()
+
+	after := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	_, err := New(ts.URL, "test-key").AlertsRange("1", after, after.Add(24*time.Hour))
+	require.NoError(t, err)
+}
+
 func TestAlertsFail(t *testing.T) {
 	_, err := New(internalServerErrorServer.URL, "test-key").Alerts("")
 	require.Error(t, err)
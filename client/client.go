@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/alphasoc/nfr/version"
 	"golang.org/x/net/context/ctxhttp"
@@ -21,6 +22,7 @@ type Client interface {
 	AccountRegister(*AccountRegisterRequest) error
 	AccountStatus() (*AccountStatusResponse, error)
 	Alerts(string) (*AlertsResponse, error)
+	AlertsRange(string, time.Time, time.Time) (*AlertsResponse, error)
 	EventsDNS(*EventsDNSRequest) (*EventsDNSResponse, error)
 	EventsIP(*EventsIPRequest) (*EventsIPResponse, error)
 	EventsHTTP([]*HTTPEntry) (*EventsHTTPResponse, error)
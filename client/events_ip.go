@@ -15,6 +15,7 @@ type IPEntry struct {
 	SrcPort   int       `json:"srcPort"`
 	DstIP     net.IP    `json:"destIp"`
 	DstPort   int       `json:"destPort"`
+	DstHost   string    `json:"destHost,omitempty"`
 	Protocol  string    `json:"proto"`
 	BytesIn   int       `json:"bytesIn"`
 	BytesOut  int       `json:"bytesOut"`
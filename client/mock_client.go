@@ -1,5 +1,7 @@
 package client
 
+import "time"
+
 // MockAlphaSOCClient creates Client for testing.
 type MockAlphaSOCClient struct{}
 
@@ -23,6 +25,11 @@ func (c *MockAlphaSOCClient) Alerts(follow string) (*AlertsResponse, error) {
 	return &AlertsResponse{}, nil
 }
 
+// AlertsRange mock.
+func (c *MockAlphaSOCClient) AlertsRange(follow string, after, before time.Time) (*AlertsResponse, error) {
+	return &AlertsResponse{}, nil
+}
+
 // EventsDNS mock.
 func (c *MockAlphaSOCClient) EventsDNS(req *EventsDNSRequest) (*EventsDNSResponse, error) {
 	return &EventsDNSResponse{}, nil
@@ -22,7 +22,7 @@ func newAccountKeyResetCommand() *cobra.Command {
 				return fmt.Errorf("invalid email %s", args[0])
 			}
 
-			_, c, err := createConfigAndClient(false)
+			_, c, err := createConfigAndClient(false, false)
 			if err != nil {
 				return err
 			}
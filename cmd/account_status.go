@@ -13,7 +13,7 @@ func newAccountStatusCommand() *cobra.Command {
 		Use:   "status",
 		Short: "Show the status of your AlphaSOC API key and license",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			_, c, err := createConfigAndClient(false)
+			_, c, err := createConfigAndClient(false, false)
 			if err != nil {
 				return err
 			}
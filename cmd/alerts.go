@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/store"
+	"github.com/spf13/cobra"
+)
+
+var alertsFormats = []string{"table", "json", "csv"}
+
+func newAlertsCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "alerts",
+		Short: "Query alerts history stored locally, or fetch alerts from AlphaSOC Engine",
+		Long: `Query alerts stored in the local alerts store, which must be enabled with
+outputs.store.enabled setting, or fetch alerts of a time range from AlphaSOC Engine.`,
+	}
+	cmd.AddCommand(newAlertsListCommand())
+	cmd.AddCommand(newAlertsShowCommand())
+	cmd.AddCommand(newAlertsExportCommand())
+	cmd.AddCommand(newAlertsFetchCommand())
+	return cmd
+}
+
+// alertsFilterFlags are flags of alerts filter shared by commands.
+type alertsFilterFlags struct {
+	since, until string
+	severity     int
+	threats      []string
+	srcIP        string
+	domain       string
+	groups       []string
+}
+
+func (f *alertsFilterFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.since, "since", "", "Show alerts since time (RFC3339, date or duration ago, e.g. 24h or 7d)")
+	cmd.Flags().StringVar(&f.until, "until", "", "Show alerts until time (RFC3339, date or duration ago)")
+	cmd.Flags().IntVar(&f.severity, "severity", 0, "Minimum severity of alerts")
+	cmd.Flags().StringSliceVar(&f.threats, "threat", nil, "Show alerts with the threat")
+	cmd.Flags().StringVar(&f.srcIP, "src-ip", "", "Show alerts from source ip or network in CIDR notation")
+	cmd.Flags().StringVar(&f.domain, "domain", "", "Show alerts of domain and its subdomains")
+	cmd.Flags().StringSliceVar(&f.groups, "group", nil, "Show alerts of the group")
+}
+
+// filter returns store filter from the flags.
+func (f *alertsFilterFlags) filter(now time.Time) (*store.Filter, error) {
+	filter := &store.Filter{
+		MinSeverity: f.severity,
+		Threats:     f.threats,
+		Domain:      f.domain,
+		Groups:      f.groups,
+	}
+
+	var err error
+	if f.since != "" {
+		if filter.Since, err = parseAlertsTime(f.since, now); err != nil {
+			return nil, fmt.Errorf("invalid since: %s", err)
+		}
+	}
+	if f.until != "" {
+		if filter.Until, err = parseAlertsTime(f.until, now); err != nil {
+			return nil, fmt.Errorf("invalid until: %s", err)
+		}
+	}
+
+	if f.srcIP != "" {
+		if !strings.Contains(f.srcIP, "/") {
+			ip := net.ParseIP(f.srcIP)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid src ip %s", f.srcIP)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			filter.SrcNet = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		} else if _, filter.SrcNet, err = net.ParseCIDR(f.srcIP); err != nil {
+			return nil, fmt.Errorf("invalid src ip %s", f.srcIP)
+		}
+	}
+	return filter, nil
+}
+
+// parseAlertsTime parses time in RFC3339 or 2006-01-02 format, or duration before now.
+func parseAlertsTime(s string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err == nil && days >= 0 {
+			return now.Add(-time.Duration(days) * 24 * time.Hour), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("%s is not a time or duration", s)
+}
+
+// openAlertsStore opens alerts store from the config.
+func openAlertsStore() (*store.Store, error) {
+	cfg, err := config.New(configPath)
+	if err != nil {
+		return nil, err
+	}
+	s, err := store.Open(cfg.AlertsStoreFile())
+	if err != nil {
+		return nil, fmt.Errorf("open alerts store failed (is outputs.store enabled?): %s", err)
+	}
+	return s, nil
+}
+
+// alertsPrinter prints alerts in one of alertsFormats.
+type alertsPrinter struct {
+	format string
+	tw     *tabwriter.Writer
+	cw     *csv.Writer
+	w      io.Writer
+}
+
+var alertsCSVHeader = []string{"id", "timestamp", "severity", "event_type", "threats",
+	"src_ip", "src_port", "src_host", "query", "query_type", "dest_ip", "dest_port",
+	"dest_host", "proto", "url", "groups", "flags"}
+
+func newAlertsPrinter(w io.Writer, format string) (*alertsPrinter, error) {
+	p := &alertsPrinter{format: format, w: w}
+	switch format {
+	case "table":
+		p.tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(p.tw, "ID\tTIME\tSEVERITY\tTHREATS\tSOURCE\tDESTINATION")
+	case "csv":
+		p.cw = csv.NewWriter(w)
+		if err := p.cw.Write(alertsCSVHeader); err != nil {
+			return nil, err
+		}
+	case "json":
+	default:
+		return nil, fmt.Errorf("unknown %s format, must be one of %s", format, sprintSlice(alertsFormats))
+	}
+	return p, nil
+}
+
+// Print prints the alert.
+func (p *alertsPrinter) Print(a *store.Alert) error {
+	switch p.format {
+	case "table":
+		_, err := fmt.Fprintf(p.tw, "%s\t%s\t%d\t%s\t%s\t%s\n",
+			a.ID,
+			a.Timestamp.Local().Format("2006-01-02 15:04:05"),
+			a.Severity,
+			strings.Join(threatIDs(&a.Event), ","),
+			alertSource(&a.Event),
+			alertDestination(&a.Event),
+		)
+		return err
+	case "csv":
+		var destIP, destPort, srcPort string
+		if a.DestIP != nil {
+			destIP = a.DestIP.String()
+		}
+		if a.DestPort != 0 {
+			destPort = strconv.Itoa(int(a.DestPort))
+		}
+		if a.SrcPort != 0 {
+			srcPort = strconv.Itoa(int(a.SrcPort))
+		}
+		groups := make([]string, len(a.Groups))
+		for n := range a.Groups {
+			groups[n] = a.Groups[n].Label
+		}
+		return p.cw.Write([]string{
+			a.ID,
+			a.Timestamp.Format(time.RFC3339Nano),
+			strconv.Itoa(a.Severity),
+			a.EventType,
+			strings.Join(threatIDs(&a.Event), ","),
+			a.SrcIP.String(),
+			srcPort,
+			a.SrcHost,
+			a.Query,
+			a.QueryType,
+			destIP,
+			destPort,
+			a.DestHost,
+			a.Proto,
+			a.URL,
+			strings.Join(groups, ","),
+			strings.Join(a.Flags, ","),
+		})
+	default:
+		b, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(p.w, "%s\n", b)
+		return err
+	}
+}
+
+// Flush flushes buffered output.
+func (p *alertsPrinter) Flush() error {
+	switch p.format {
+	case "table":
+		return p.tw.Flush()
+	case "csv":
+		p.cw.Flush()
+		return p.cw.Error()
+	}
+	return nil
+}
+
+func threatIDs(event *alerts.Event) []string {
+	tids := make([]string, 0, len(event.Threats))
+	for tid := range event.Threats {
+		tids = append(tids, tid)
+	}
+	sort.Strings(tids)
+	return tids
+}
+
+func alertSource(event *alerts.Event) string {
+	if event.SrcHost != "" {
+		return fmt.Sprintf("%s (%s)", event.SrcIP, event.SrcHost)
+	}
+	return event.SrcIP.String()
+}
+
+func alertDestination(event *alerts.Event) string {
+	switch event.EventType {
+	case "dns":
+		return event.Query
+	case "http":
+		return event.URL
+	}
+	if event.DestIP == nil {
+		return ""
+	}
+	dest := net.JoinHostPort(event.DestIP.String(), strconv.Itoa(int(event.DestPort)))
+	if event.DestHost != "" {
+		return fmt.Sprintf("%s (%s)", dest, event.DestHost)
+	}
+	return dest
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/alphasoc/nfr/store"
+	"github.com/spf13/cobra"
+)
+
+func newAlertsExportCommand() *cobra.Command {
+	var (
+		flags  alertsFilterFlags
+		format string
+		output string
+	)
+
+	var cmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export stored alerts as JSON lines or CSV",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := flags.filter(time.Now())
+			if err != nil {
+				return err
+			}
+			if format != "json" && format != "csv" {
+				return fmt.Errorf("unknown %s format, must be json or csv", format)
+			}
+
+			s, err := openAlertsStore()
+			if err != nil {
+				return err
+			}
+
+			var w io.Writer = os.Stdout
+			if output != "" && output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+
+			p, err := newAlertsPrinter(w, format)
+			if err != nil {
+				return err
+			}
+			if err := s.Query(filter, func(a *store.Alert) error { return p.Print(a) }); err != nil {
+				return err
+			}
+			return p.Flush()
+		},
+	}
+	flags.register(cmd)
+	cmd.Flags().StringVarP(&format, "format", "f", "json", "One of [json|csv] output format")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Output file, stdout if not set")
+	return cmd
+}
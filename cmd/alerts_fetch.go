@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/executor"
+	"github.com/spf13/cobra"
+)
+
+func newAlertsFetchCommand() *cobra.Command {
+	var (
+		since, until string
+		outputs      []string
+	)
+
+	var cmd = &cobra.Command{
+		Use:   "fetch",
+		Short: "Fetch alerts of a time range from AlphaSOC Engine and write them to outputs",
+		Long: `Fetch alerts of events in a time range from AlphaSOC Engine, e.g. when an output
+was down, and write them to the configured outputs. Use --output to write only
+to some of them, e.g. --output file --output kafka.
+
+Alerts are written directly, without suppression and output queues, and the
+follow state of a running nfr is not changed.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if since == "" {
+				return errors.New("since required")
+			}
+
+			now := time.Now()
+			after, err := parseAlertsTime(since, now)
+			if err != nil {
+				return err
+			}
+			before := now
+			if until != "" {
+				if before, err = parseAlertsTime(until, now); err != nil {
+					return err
+				}
+			}
+			if !after.Before(before) {
+				return errors.New("since must be before until")
+			}
+
+			cfg, c, err := createConfigAndClient(true, false)
+			if err != nil {
+				return err
+			}
+			// fetched alerts are written directly, without suppression
+			cfg.Outputs.Suppress.Enabled = false
+
+			e, err := executor.NewOffline(c, cfg)
+			if err != nil {
+				return err
+			}
+			// alerts are written directly, closing only stops the queues and closes outputs
+			defer e.Close()
+			count, err := e.FetchAlerts(after, before, outputs)
+			if err != nil {
+				return err
+			}
+			log.Infof("%d alerts fetched", count)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&since, "since", "", "Fetch alerts since time (RFC3339, date or duration ago, e.g. 24h or 7d)")
+	cmd.Flags().StringVar(&until, "until", "", "Fetch alerts until time (RFC3339, date or duration ago), now if not set")
+	cmd.Flags().StringSliceVar(&outputs, "output", nil, "Write alerts only to the output, e.g. file, syslog, kafka")
+	return cmd
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alphasoc/nfr/store"
+	"github.com/spf13/cobra"
+)
+
+func newAlertsListCommand() *cobra.Command {
+	var (
+		flags  alertsFilterFlags
+		format string
+		limit  int
+	)
+
+	var cmd = &cobra.Command{
+		Use:   "list",
+		Short: "List stored alerts, from the newest one",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter, err := flags.filter(time.Now())
+			if err != nil {
+				return err
+			}
+			filter.Limit = limit
+
+			p, err := newAlertsPrinter(os.Stdout, format)
+			if err != nil {
+				return err
+			}
+			s, err := openAlertsStore()
+			if err != nil {
+				return err
+			}
+			if err := s.Query(filter, func(a *store.Alert) error { return p.Print(a) }); err != nil {
+				return err
+			}
+			return p.Flush()
+		},
+	}
+	flags.register(cmd)
+	cmd.Flags().StringVarP(&format, "format", "f", "table", fmt.Sprintf("One of %s output format", sprintSlice(alertsFormats)))
+	cmd.Flags().IntVarP(&limit, "limit", "n", 50, "Maximum number of alerts, 0 lists all")
+	return cmd
+}
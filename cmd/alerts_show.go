@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newAlertsShowCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "show id",
+		Short: "Show all details of stored alert",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return errors.New("alert id required")
+			}
+
+			s, err := openAlertsStore()
+			if err != nil {
+				return err
+			}
+			a, err := s.Get(args[0])
+			if err != nil {
+				return err
+			}
+			if a == nil {
+				return fmt.Errorf("alert %s not found", args[0])
+			}
+
+			b, err := json.MarshalIndent(a, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+			return nil
+		},
+	}
+	return cmd
+}
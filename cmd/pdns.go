@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"text/tabwriter"
+
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/pdns"
+	"github.com/spf13/cobra"
+)
+
+var pdnsFormats = []string{"table", "json"}
+
+func newPdnsCommand() *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "pdns",
+		Short: "Query passive dns records stored locally",
+		Long: `Query names resolved to ip addresses, seen in dns responses by nfr.
+Passive dns must be enabled with outputs.enrich.passive_dns.enabled setting.`,
+	}
+	cmd.AddCommand(newPdnsLookupCommand())
+	return cmd
+}
+
+func newPdnsLookupCommand() *cobra.Command {
+	var format string
+
+	var cmd = &cobra.Command{
+		Use:   "lookup ip|name...",
+		Short: "Show names resolved to ip address, or addresses of name",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("ip address or name required")
+			}
+			if format != "table" && format != "json" {
+				return fmt.Errorf("unknown %s format, must be one of %s", format, sprintSlice(pdnsFormats))
+			}
+
+			cfg, err := config.New(configPath)
+			if err != nil {
+				return err
+			}
+			c, err := pdns.Open(cfg.PassiveDNSFile())
+			if err != nil {
+				return fmt.Errorf("open passive dns records failed (is passive_dns enabled?): %s", err)
+			}
+
+			records := []pdns.Record{}
+			for _, arg := range args {
+				if ip := net.ParseIP(arg); ip != nil {
+					records = append(records, c.Lookup(ip)...)
+				} else {
+					records = append(records, c.LookupName(arg)...)
+				}
+			}
+
+			if format == "json" {
+				b, err := json.MarshalIndent(records, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Println(string(b))
+				return nil
+			}
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "IP\tNAME\tFIRST SEEN\tLAST SEEN\tCOUNT")
+			for _, r := range records {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\n",
+					r.IP,
+					r.Name,
+					r.FirstSeen.Local().Format("2006-01-02 15:04:05"),
+					r.LastSeen.Local().Format("2006-01-02 15:04:05"),
+					r.Count,
+				)
+			}
+			return tw.Flush()
+		},
+	}
+	cmd.Flags().StringVarP(&format, "format", "f", "table", fmt.Sprintf("One of %s output format", sprintSlice(pdnsFormats)))
+	return cmd
+}
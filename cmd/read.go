@@ -43,7 +43,7 @@ See nfr read --help for more informations.`,
 				return errors.New("at least 1 file required")
 			}
 
-			cfg, c, err := createConfigAndClient(true)
+			cfg, c, err := createConfigAndClient(true, false)
 			if err != nil {
 				return err
 			}
@@ -56,10 +56,11 @@ See nfr read --help for more informations.`,
 }
 
 func send(cfg *config.Config, c client.Client, fileFormat, fileType string, files []string) error {
-	e, err := executor.New(c, cfg)
+	e, err := executor.NewOffline(c, cfg)
 	if err != nil {
 		return err
 	}
+	defer e.Close()
 
 	for i := range files {
 		if err := e.Send(files[i], fileFormat, fileType); err != nil {
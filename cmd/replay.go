@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"errors"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/executor"
+	"github.com/spf13/cobra"
+)
+
+func newReplayCommand() *cobra.Command {
+	var speed float64
+
+	var cmd = &cobra.Command{
+		Use:   "replay",
+		Short: "Replay pcap files through the network sniffer pipeline",
+		Long: `Replay packets stored in pcap or pcapng files and process them the same way
+as packets captured live by the sniffer, including direction detection and scope
+groups. By default packets are replayed as fast as possible. Use --speed 1 to
+replay them in real time, or e.g. --speed 10 to replay them 10 times faster.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("at least 1 file required")
+			}
+			if speed < 0 {
+				return errors.New("speed must not be negative")
+			}
+
+			cfg, c, err := createConfigAndClient(true, false)
+			if err != nil {
+				return err
+			}
+
+			e, err := executor.NewOffline(c, cfg)
+			if err != nil {
+				return err
+			}
+			defer e.Close()
+
+			for i := range args {
+				if err := e.Replay(args[i], speed); err != nil {
+					return err
+				}
+				log.Infof("file %s replayed", args[i])
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Float64Var(&speed, "speed", 0, "Replay speed multiplier, 0 replays packets as fast as possible")
+	return cmd
+}
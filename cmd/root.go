@@ -8,6 +8,7 @@ import (
 	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/config"
 	"github.com/alphasoc/nfr/logger"
+	"github.com/alphasoc/nfr/rotate"
 	"github.com/spf13/cobra"
 )
 
@@ -27,7 +28,7 @@ func init() {
 // NewRootCommand represents the base command when called without any subcommands
 func NewRootCommand() *cobra.Command {
 	var cmd = &cobra.Command{
-		Use:   "nfr account|listen|read|version",
+		Use:   "nfr account|alerts|listen|read|replay|version",
 		Short: "nfr is main command used to send dns and ip events to AlphaSOC Engine",
 		Long: `Network Flight Recorder (NFR) is an application which captures network traffic
 and provides deep analysis and alerting of suspicious events, identifying gaps
@@ -40,19 +41,28 @@ in your security controls, highlighting targeted attacks and policy violations.`
 
 	cmd.AddCommand(newVersionCommand())
 	cmd.AddCommand(newAccountCommand())
+	cmd.AddCommand(newAlertsCommand())
+	cmd.AddCommand(newPdnsCommand())
 	cmd.AddCommand(newStartCommand())
 	cmd.AddCommand(newReadCommand())
+	cmd.AddCommand(newReplayCommand())
 	return cmd
 }
 
-// createConfigAndClient takes one argument to check if key is active.
-func createConfigAndClient(checkKey bool) (*config.Config, *client.AlphaSOCClient, error) {
+// createConfigAndClient creates config and client, and checks if key is active if
+// checkKey is set. Log file is rotated only if rotateLog is set, so that offline
+// commands don't rotate files of the running daemon.
+func createConfigAndClient(checkKey, rotateLog bool) (*config.Config, *client.AlphaSOCClient, error) {
 	cfg, err := config.New(configPath)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	if err := logger.SetOutput(cfg.Log.File); err != nil {
+	var rcfg rotate.Config
+	if rotateLog {
+		rcfg = cfg.Log.Rotate.RotateConfig()
+	}
+	if err := logger.SetOutput(cfg.Log.File, rcfg); err != nil {
 		return nil, nil, err
 	}
 	logger.SetLevel(cfg.Log.Level)
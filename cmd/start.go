@@ -1,9 +1,11 @@
 package cmd
 
 import (
+	log "github.com/Sirupsen/logrus"
 	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/config"
 	"github.com/alphasoc/nfr/executor"
+	"github.com/alphasoc/nfr/rotate"
 	"github.com/spf13/cobra"
 )
 
@@ -13,7 +15,7 @@ func newStartCommand() *cobra.Command {
 		Short: "Start processing network events (inputs defined in config)",
 		Long:  `Start processing network events. API key must be set before calling this mode.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, c, err := createConfigAndClient(true)
+			cfg, c, err := createConfigAndClient(true, true)
 			if err != nil {
 				return err
 			}
@@ -28,5 +30,9 @@ func start(c client.Client, cfg *config.Config) error {
 	if err != nil {
 		return err
 	}
+	// log and alerts files are reopened after external rotation
+	rotate.ReopenOnSignal(func(err error) {
+		log.Errorf("reopening files failed: %s", err)
+	})
 	return e.Start()
 }
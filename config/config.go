@@ -14,6 +14,10 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/alphasoc/nfr/elastic"
+	"github.com/alphasoc/nfr/ioc"
+	"github.com/alphasoc/nfr/pdns"
+	"github.com/alphasoc/nfr/rotate"
+	"github.com/alphasoc/nfr/syslog"
 	"github.com/alphasoc/nfr/utils"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
@@ -34,6 +38,252 @@ type group struct {
 	TrustedIps     []string `yaml:"trusted_ips"`
 }
 
+// Sniffer is a config for a network sniffer.
+type Sniffer struct {
+	// Interface on which nfr should listen.
+	// Default: (none)
+	Interface string `yaml:"interface,omitempty"`
+
+	// BPFilter is a BPF filter expression for captured packets.
+	// Default: tcp or udp traffic, also vlan tagged or gre encapsulated
+	BPFilter string `yaml:"bpf_filter,omitempty"`
+
+	// ScopeGroup is a name of scope group used to filter captured packets.
+	// Default: (none) - all scope groups are used
+	ScopeGroup string `yaml:"scope_group,omitempty"`
+
+	// Direction method used to determine if packet is incoming or outgoing.
+	// Possible values are: networks (by home networks), mac (by interface hardware address).
+	// Default: networks
+	Direction string `yaml:"direction,omitempty"`
+
+	// HomeNetworks is a list of internal networks used to determine packet direction.
+	// Default: in_scope networks of the scope group, or of all scope groups
+	HomeNetworks []string `yaml:"home_networks,omitempty"`
+
+	// Capture method used by sniffer.
+	// Possible values are: pcap, afpacket (linux only).
+	// Default: pcap
+	Capture string `yaml:"capture,omitempty"`
+
+	// Snaplen is the maximum number of bytes captured from a packet.
+	// Default: 1600
+	Snaplen int `yaml:"snaplen,omitempty"`
+
+	// Promiscuous if set to true sniffer puts the interface into promiscuous mode.
+	// Default: true
+	Promiscuous bool `yaml:"promiscuous"`
+
+	// BufferSize is the size of kernel capture buffer in megabytes.
+	// Default: system default for pcap, 64 for afpacket
+	BufferSize int `yaml:"buffer_size,omitempty"`
+
+	// BlockSize is the size of afpacket ring buffer block in kilobytes.
+	// It must be a multiple of 4.
+	// Default: 1024
+	BlockSize int `yaml:"block_size,omitempty"`
+
+	// Fanout is the number of afpacket sockets sharing captured traffic.
+	// Each socket is processed by own goroutine.
+	// Default: 1
+	Fanout int `yaml:"fanout,omitempty"`
+
+	// Interface physical hardware address.
+	HardwareAddr net.HardwareAddr `yaml:"-"`
+}
+
+// Sniffers is a list of sniffers configs. Unset fields have default values.
+type Sniffers []Sniffer
+
+// UnmarshalYAML unmarshals sniffers list with defaults for unset fields.
+func (s *Sniffers) UnmarshalYAML(value *yaml.Node) error {
+	var nodes []yaml.Node
+	if err := value.Decode(&nodes); err != nil {
+		return err
+	}
+
+	*s = make(Sniffers, len(nodes))
+	for i := range nodes {
+		(*s)[i] = newDefaultSniffer()
+		if err := nodes[i].Decode(&(*s)[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newDefaultSniffer returns sniffer config with set defaults.
+func newDefaultSniffer() Sniffer {
+	return Sniffer{
+		Direction:   "networks",
+		Capture:     "pcap",
+		Snaplen:     1600,
+		Promiscuous: true,
+		Fanout:      1,
+	}
+}
+
+// Rotate is a configuration of file rotation.
+type Rotate struct {
+	// MaxSize of a file in MB, after which it's rotated.
+	// Default: 0 (no size based rotation)
+	MaxSize int `yaml:"max_size,omitempty"`
+	// Interval after which a file is rotated.
+	// Default: 0 (no time based rotation)
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// MaxFiles is the number of rotated files kept.
+	// Default: 0 (all files are kept)
+	MaxFiles int `yaml:"max_files,omitempty"`
+	// Compress rotated files with gzip.
+	// Default: false
+	Compress bool `yaml:"compress"`
+}
+
+// RotateConfig returns config of rotate package.
+func (r *Rotate) RotateConfig() rotate.Config {
+	return rotate.Config{
+		MaxSize:  int64(r.MaxSize) * 1024 * 1024,
+		Interval: r.Interval,
+		MaxFiles: r.MaxFiles,
+		Compress: r.Compress,
+	}
+}
+
+// validate checks rotation settings.
+func (r *Rotate) validate() error {
+	if r.MaxSize < 0 {
+		return fmt.Errorf("invalid rotate max size %d", r.MaxSize)
+	}
+	if r.Interval < 0 || (r.Interval > 0 && r.Interval < time.Minute) {
+		return fmt.Errorf("rotate interval must be at least 1m")
+	}
+	if r.MaxFiles < 0 {
+		return fmt.Errorf("invalid rotate max files %d", r.MaxFiles)
+	}
+	return nil
+}
+
+// CEFField is a CEF extension key and label of an alert field.
+type CEFField struct {
+	// Key of the extension, e.g. cs1. If empty, then the field is omitted.
+	Key string `yaml:"key"`
+	// Label of custom extension, written as key+"Label", e.g. cs1Label.
+	Label string `yaml:"label,omitempty"`
+}
+
+// Filter selects alerts written to an output. Empty fields match all alerts.
+type Filter struct {
+	// MinSeverity of threats.
+	// Default: 0
+	MinSeverity int `yaml:"min_severity,omitempty"`
+	// Threats ids to include and to exclude.
+	// Default: (none)
+	Threats        []string `yaml:"threats,omitempty"`
+	ExcludeThreats []string `yaml:"exclude_threats,omitempty"`
+	// Policy if set, then only policy (true) or non-policy (false) threats are written.
+	// Default: (none)
+	Policy *bool `yaml:"policy,omitempty"`
+	// EventTypes of alerts. Possible values are: dns, ip, http.
+	// Default: (none)
+	EventTypes []string `yaml:"event_types,omitempty"`
+	// Groups labels of scope groups.
+	// Default: (none)
+	Groups []string `yaml:"groups,omitempty"`
+	// Flags of alerts.
+	// Default: (none)
+	Flags []string `yaml:"flags,omitempty"`
+}
+
+// IsEmpty returns true if filter matches all alerts.
+func (f *Filter) IsEmpty() bool {
+	return f.MinSeverity == 0 && len(f.Threats) == 0 && len(f.ExcludeThreats) == 0 &&
+		f.Policy == nil && len(f.EventTypes) == 0 && len(f.Groups) == 0 && len(f.Flags) == 0
+}
+
+// validate checks filter values.
+func (f *Filter) validate() error {
+	if f.MinSeverity < 0 || f.MinSeverity > 5 {
+		return fmt.Errorf("invalid filter min severity %d", f.MinSeverity)
+	}
+	for _, t := range f.EventTypes {
+		if t != "dns" && t != "ip" && t != "http" {
+			return fmt.Errorf("invalid filter event type %s", t)
+		}
+	}
+	return nil
+}
+
+// Webhook is a config for http webhook output.
+type Webhook struct {
+	// URL of the webhook.
+	// Default: (none)
+	URL string `yaml:"url"`
+
+	// Headers added to requests, e.g. Authorization.
+	// Default: (none)
+	Headers map[string]string `yaml:"headers,omitempty"`
+
+	// Template of request body. Possible values are: json, slack, teams, ocsf, stix.
+	// Default: json
+	Template string `yaml:"template,omitempty"`
+
+	// TemplateFile is a file with go text/template of request body.
+	// If set, then template is ignored.
+	// Default: (none)
+	TemplateFile string `yaml:"template_file,omitempty"`
+
+	// ContentType of request body.
+	// Default: application/json
+	ContentType string `yaml:"content_type,omitempty"`
+
+	// BatchSize is the maximum number of alerts sent in one request.
+	// Default: 10
+	BatchSize int `yaml:"batch_size,omitempty"`
+
+	// Retries is the number of retries of failed request.
+	// Default: 3
+	Retries *int `yaml:"retries,omitempty"`
+
+	// Timeout of a single request.
+	// Default: 10s
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	// Filter of alerts sent to the webhook.
+	Filter Filter `yaml:"filter,omitempty"`
+}
+
+// IOCFeed is a config of local indicators of compromise file.
+type IOCFeed struct {
+	// Name of the feed.
+	// Default: (none)
+	Name string `yaml:"name"`
+
+	// File with indicators.
+	// Default: (none)
+	File string `yaml:"file"`
+
+	// Format of the file. Possible values are: list, csv, misp, stix.
+	// Default: list
+	Format string `yaml:"format,omitempty"`
+
+	// Type of indicators in list or csv file without type column.
+	// Possible values are: domain, ip, url, ja3.
+	// Default: (none) - detected from each indicator
+	Type string `yaml:"type,omitempty"`
+
+	// Threat id of alerts of matched events.
+	// Default: ioc_ followed by the feed name
+	Threat string `yaml:"threat,omitempty"`
+
+	// Severity of alerts of matched events, from 1 to 5.
+	// Default: 4
+	Severity int `yaml:"severity,omitempty"`
+
+	// Description of the threat.
+	// Default: the feed name
+	Description string `yaml:"description,omitempty"`
+}
+
 // Config for nfr
 type Config struct {
 	// AlphaSOC server configuration
@@ -64,22 +314,65 @@ type Config struct {
 			// Default: 5m
 			PollInterval time.Duration `yaml:"poll_interval,omitempty"`
 		} `yaml:"alerts,omitempty"`
+
+		// IOC matches events locally with indicators of compromise. Matched
+		// events are written to outputs as alerts.
+		IOC struct {
+			// Feeds with indicators.
+			Feeds []IOCFeed `yaml:"feeds,omitempty"`
+			// Interval for checking if feed files changed.
+			// Default: 1m
+			ReloadInterval time.Duration `yaml:"reload_interval,omitempty"`
+			// DedupWindow within which the same threat and indicators of the same
+			// source and destination are alerted once, e.g. for packets of a flow.
+			// Default: 5m
+			DedupWindow time.Duration `yaml:"dedup_window,omitempty"`
+		} `yaml:"ioc,omitempty"`
 	} `yaml:"engine"`
 
 	// Inputs describes where collects network traffic to score from
 	Inputs struct {
 		// Sniffer configuration.
 		Sniffer struct {
-			// Enabled if set to true nfr will run sniffer.
+			// Enabled if set to true nfr will run sniffers.
 			Enabled bool `yaml:"enabled"`
-			// Interface on which nfr should listen.
-			// Default: (none)
-			Interface string `yaml:"interface,omitempty"`
 
-			// Interface physical hardware address.
-			HardwareAddr net.HardwareAddr `yaml:"-"`
+			Sniffer `yaml:",inline"`
 		} `yaml:"sniffer,omitempty"`
 
+		// Sniffers is a list of additional sniffers, each with own settings.
+		Sniffers Sniffers `yaml:"sniffers,omitempty"`
+
+		// PcapRing keeps recent sniffed packets on disk, so packets of the alert
+		// source around the event time are written to a pcap file of the alert.
+		PcapRing struct {
+			// Enabled if set to true, then sniffed packets are kept in the ring.
+			// Default: false
+			Enabled bool `yaml:"enabled"`
+			// Dir of the ring pcap files.
+			// Default: pcap-ring in data dir
+			Dir string `yaml:"dir,omitempty"`
+			// MaxSize of all ring pcap files in MB.
+			// Default: 1024
+			MaxSize int `yaml:"max_size,omitempty"`
+			// MaxAge of kept packets.
+			// Default: 1h
+			MaxAge time.Duration `yaml:"max_age,omitempty"`
+			// SegmentSize of a single ring pcap file in MB.
+			// Default: 64
+			SegmentSize int `yaml:"segment_size,omitempty"`
+			// SegmentInterval is the time range of packets in a single ring pcap file.
+			// Default: 1m
+			SegmentInterval time.Duration `yaml:"segment_interval,omitempty"`
+			// AlertsDir where pcap files of alerts are written.
+			// Default: pcap-alerts in data dir
+			AlertsDir string `yaml:"alerts_dir,omitempty"`
+			// Before and After the event time, packets are written to pcap file of the alert.
+			// Default: 1m
+			Before time.Duration `yaml:"before,omitempty"`
+			After  time.Duration `yaml:"after,omitempty"`
+		} `yaml:"pcap_ring"`
+
 		// Monitors keeps list of log files to monitor.
 		Monitors []Monitor `yaml:"monitor"`
 
@@ -102,6 +395,15 @@ type Config struct {
 		Graylog struct {
 			URI   string `yaml:"uri"`
 			Level int    `yaml:"level"`
+			// Compression of udp messages. Possible values are: none, gzip, zlib.
+			// Default: none
+			Compression string `yaml:"compression,omitempty"`
+			// ChunkSize is the maximum size of udp datagram, bigger messages are chunked.
+			// Default: 1420
+			ChunkSize int `yaml:"chunk_size,omitempty"`
+			// TLS of tcp connection.
+			TLS    TLS    `yaml:"tls"`
+			Filter Filter `yaml:"filter,omitempty"`
 		} `yaml:"graylog"`
 
 		// Syslog server
@@ -114,15 +416,245 @@ type Config struct {
 			Proto string `yaml:"proto,omitempty"`
 			// Default: json
 			Format string `yaml:"format,omitempty"`
+			// Facility of messages, e.g. user, daemon, local0.
+			// Default: user
+			Facility string `yaml:"facility,omitempty"`
+			// AppName of messages.
+			// Default: NFR
+			AppName string `yaml:"app_name,omitempty"`
+			// Framing of tcp messages. Possible values are: octet-counting, non-transparent.
+			// Default: octet-counting
+			Framing string `yaml:"framing,omitempty"`
+			// TLS of tcp connection.
+			TLS    TLS    `yaml:"tls"`
+			Filter Filter `yaml:"filter,omitempty"`
 		} `yaml:"syslog"`
 
+		// QRadar syslog input, alerts are sent in LEEF format.
+		QRadar struct {
+			// Default: (none)
+			IP string `yaml:"ip"`
+			// Default: 514
+			Port int `yaml:"port"`
+			// TLS of tcp connection.
+			TLS    TLS    `yaml:"tls"`
+			Filter Filter `yaml:"filter,omitempty"`
+		} `yaml:"qradar"`
+
+		// Splunk HTTP Event Collector.
+		Splunk struct {
+			// URL of HTTP Event Collector, e.g. https://splunk:8088
+			// Default: (none)
+			URL string `yaml:"url"`
+			// HEC token.
+			// Default: (none)
+			Token string `yaml:"token"`
+			// Index, source and sourcetype of alert events.
+			// Default: (none), (none), nfr:alert
+			Index      string `yaml:"index,omitempty"`
+			Source     string `yaml:"source,omitempty"`
+			SourceType string `yaml:"sourcetype,omitempty"`
+			// BatchSize is the maximum number of events sent in one request.
+			// Default: 100
+			BatchSize int `yaml:"batch_size,omitempty"`
+			// Gzip compresses requests.
+			// Default: false
+			Gzip bool `yaml:"gzip"`
+			// Timeout of a single request.
+			// Default: 10s
+			Timeout time.Duration `yaml:"timeout,omitempty"`
+			// Telemetry if set to true, then network events sent for analysis
+			// are forwarded too, with nfr:dns, nfr:ip and nfr:http sourcetypes.
+			// Default: false
+			Telemetry bool   `yaml:"telemetry"`
+			Filter    Filter `yaml:"filter,omitempty"`
+		} `yaml:"splunk"`
+
+		// Elasticsearch index where alerts are indexed in ECS format.
+		// Connection settings of the elastic input are used.
+		Elastic struct {
+			// Enabled if set to true alerts are indexed in elasticsearch.
+			Enabled bool `yaml:"enabled"`
+			// Index, ILM alias or data stream name.
+			// Default: nfr-alerts
+			Index string `yaml:"index,omitempty"`
+			// BatchSize is the maximum number of alerts indexed in one request.
+			// Default: 100
+			BatchSize int    `yaml:"batch_size,omitempty"`
+			Filter    Filter `yaml:"filter,omitempty"`
+		} `yaml:"elastic"`
+
+		// Kafka topic where alerts are produced.
+		Kafka struct {
+			// Brokers addresses, e.g. kafka:9092
+			// Default: (none)
+			Brokers []string `yaml:"brokers,omitempty"`
+			// Topic where alerts are produced.
+			// Default: (none)
+			Topic string `yaml:"topic"`
+			// Key of messages. Possible values are: src_ip, threat, none.
+			// Default: src_ip
+			Key string `yaml:"key,omitempty"`
+			// Format of messages; can be json, cef, leef, ocsf or stix.
+			// Default: json
+			Format string `yaml:"format,omitempty"`
+			// Acks required from brokers. Possible values are: all, leader, none.
+			// Default: all
+			Acks string `yaml:"acks,omitempty"`
+			// BatchSize is the maximum number of messages produced in one request.
+			// Default: 100
+			BatchSize int `yaml:"batch_size,omitempty"`
+			// Timeout of a single request.
+			// Default: 10s
+			Timeout time.Duration `yaml:"timeout,omitempty"`
+			TLS     TLS           `yaml:"tls"`
+			SASL    struct {
+				// Mechanism can be plain, scram-sha-256 or scram-sha-512.
+				// Default: (none)
+				Mechanism string `yaml:"mechanism,omitempty"`
+				Username  string `yaml:"username,omitempty"`
+				Password  string `yaml:"password,omitempty"`
+			} `yaml:"sasl"`
+			Filter Filter `yaml:"filter,omitempty"`
+		} `yaml:"kafka"`
+
+		// Queue of alerts pending for each output. Outputs write alerts
+		// independently, and failed writes are retried with backoff.
+		Queue struct {
+			// Size is the maximum number of alerts pending for an output.
+			// If exceeded, then the oldest alerts are dropped.
+			// Default: 10000
+			Size int `yaml:"size,omitempty"`
+			// Persist if set to true, then pending alerts are stored in data dir.
+			// Default: true
+			Persist bool `yaml:"persist"`
+		} `yaml:"queue"`
+
+		// Store keeps history of all alerts in local database,
+		// which can be queried with nfr alerts command.
+		Store struct {
+			// Enabled if set to true, then alerts are stored.
+			// Default: false
+			Enabled bool `yaml:"enabled"`
+			// File of the database.
+			// Default: alerts.db in data dir
+			File string `yaml:"file,omitempty"`
+			// Retention of alerts, older ones are removed.
+			// Default: 720h
+			Retention time.Duration `yaml:"retention,omitempty"`
+			// MaxAlerts is the maximum number of stored alerts. If 0, then there is no limit.
+			// Default: 0
+			MaxAlerts int `yaml:"max_alerts,omitempty"`
+		} `yaml:"store"`
+
+		// Suppress repeated alerts with the same key within a time window.
+		// When the window closes, then a summary alert is written with the
+		// number of suppressed alerts. State is stored in data dir.
+		Suppress struct {
+			// Enabled if set to true, then repeated alerts are suppressed.
+			// Default: false
+			Enabled bool `yaml:"enabled"`
+			// Key fields of alerts. Possible values are: threat, event_type,
+			// src_ip, src_host, dest_ip, dest_port, query, url, ja3.
+			// Default: [threat, src_ip, query, dest_ip]
+			Key []string `yaml:"key,omitempty"`
+			// Window of suppression.
+			// Default: 24h
+			Window time.Duration `yaml:"window,omitempty"`
+		} `yaml:"suppress"`
+
+		// Enrich alerts with source hostname, mac, user and asset details,
+		// and destination hostname and location.
+		Enrich struct {
+			ReverseDNS struct {
+				// Enabled if set to true, then source hostname is resolved with reverse dns.
+				// Default: false
+				Enabled bool `yaml:"enabled"`
+				// Timeout of a single lookup.
+				// Default: 2s
+				Timeout time.Duration `yaml:"timeout,omitempty"`
+				// CacheTTL of resolved names.
+				// Default: 1h
+				CacheTTL time.Duration `yaml:"cache_ttl,omitempty"`
+			} `yaml:"reverse_dns"`
+			// PassiveDNS keeps names resolved to ip addresses, seen in dns responses
+			// of sniffed traffic and zeek or suricata logs. They are used as
+			// destination hostname of ip events and alerts.
+			PassiveDNS struct {
+				// Enabled if set to true, then passive dns records are kept.
+				// Default: false
+				Enabled bool `yaml:"enabled"`
+				// File of the records.
+				// Default: pdns.json in data dir
+				File string `yaml:"file,omitempty"`
+				// MaxAddresses is the maximum number of ip addresses.
+				// Default: 100000
+				MaxAddresses int `yaml:"max_addresses,omitempty"`
+				// MaxNames is the maximum number of names of an ip address.
+				// Default: 10
+				MaxNames int `yaml:"max_names,omitempty"`
+				// Retention of records since they were last seen.
+				// Default: 168h
+				Retention time.Duration `yaml:"retention,omitempty"`
+				// SaveInterval of records to the file.
+				// Default: 1m
+				SaveInterval time.Duration `yaml:"save_interval,omitempty"`
+			} `yaml:"passive_dns"`
+			DHCPLeases struct {
+				// File with dhcp leases.
+				// Default: (none)
+				File string `yaml:"file,omitempty"`
+				// Format of the file. Possible values are: isc, dnsmasq.
+				// Default: isc
+				Format string `yaml:"format,omitempty"`
+			} `yaml:"dhcp_leases"`
+			Inventory struct {
+				// File with asset inventory in csv or json format.
+				// Default: (none)
+				File string `yaml:"file,omitempty"`
+			} `yaml:"inventory"`
+			GeoIP struct {
+				// Files of MaxMind databases (.mmdb), e.g. GeoLite2-City and GeoLite2-ASN.
+				// Default: (none)
+				Files []string `yaml:"files,omitempty"`
+			} `yaml:"geoip"`
+		} `yaml:"enrich"`
+
+		// Webhooks where alerts are sent over http(s).
+		Webhooks []Webhook `yaml:"webhooks,omitempty"`
+
 		// File where to store alerts. If not set then no alerts will be retrieved.
 		// To print alerts to console use two special outputs: stderr or stdout
 		// Default: "stderr"
 		File string `yaml:"file,omitempty"`
 
-		// Format for the file output; can be json or cef (default is json).
+		// Format for the file output; can be json, cef, leef, ocsf or stix (default is json).
 		Format string `yaml:"format,omitempty"`
+
+		// CEF format settings used by all outputs.
+		CEF struct {
+			// Vendor, product and version in CEF header.
+			// Default: AlphaSOC, NFR, (nfr version)
+			Vendor  string `yaml:"vendor,omitempty"`
+			Product string `yaml:"product,omitempty"`
+			Version string `yaml:"version,omitempty"`
+			// Fields maps alert fields to CEF extensions, overriding default ones.
+			// Default: (none)
+			Fields map[string]CEFField `yaml:"fields,omitempty"`
+		} `yaml:"cef"`
+
+		// OCSF format settings used by all outputs.
+		OCSF struct {
+			// Class of OCSF events. Possible values are: detection_finding, network_activity.
+			// Default: detection_finding
+			Class string `yaml:"class,omitempty"`
+		} `yaml:"ocsf"`
+
+		// FileFilter of alerts written to the file output.
+		FileFilter Filter `yaml:"file_filter,omitempty"`
+
+		// FileRotate of the file output.
+		FileRotate Rotate `yaml:"file_rotate"`
 	} `yaml:"outputs"`
 
 	// Log configuration.
@@ -135,6 +667,9 @@ type Config struct {
 		// Log level. Possibles values are: debug, info, warn, error
 		// Default: info
 		Level string `yaml:"level,omitempty"`
+
+		// Rotate of the log file.
+		Rotate Rotate `yaml:"rotate"`
 	} `yaml:"log,omitempty"`
 
 	// Internal nfr data.
@@ -268,8 +803,17 @@ func NewDefault() *Config {
 	cfg.Engine.Analyze.IP = true
 	cfg.Engine.Analyze.HTTP = true
 	cfg.Engine.Alerts.PollInterval = 5 * time.Minute
+	cfg.Engine.IOC.ReloadInterval = time.Minute
+	cfg.Engine.IOC.DedupWindow = ioc.DefaultDedupWindow
 
 	cfg.Inputs.Sniffer.Enabled = true
+	cfg.Inputs.Sniffer.Sniffer = newDefaultSniffer()
+	cfg.Inputs.PcapRing.MaxSize = 1024
+	cfg.Inputs.PcapRing.MaxAge = time.Hour
+	cfg.Inputs.PcapRing.SegmentSize = 64
+	cfg.Inputs.PcapRing.SegmentInterval = time.Minute
+	cfg.Inputs.PcapRing.Before = time.Minute
+	cfg.Inputs.PcapRing.After = time.Minute
 	// Use inotify by default on non-windows OS
 	cfg.Inputs.UseInotify = (runtime.GOOS != "windows")
 
@@ -277,9 +821,34 @@ func NewDefault() *Config {
 	cfg.Outputs.File = "stderr"
 	cfg.Outputs.Format = "json"
 	cfg.Outputs.Graylog.Level = 1
+	cfg.Outputs.Graylog.Compression = "none"
+	cfg.Outputs.Graylog.ChunkSize = 1420
 	cfg.Outputs.Syslog.Port = 514
 	cfg.Outputs.Syslog.Proto = "tcp"
 	cfg.Outputs.Syslog.Format = "json"
+	cfg.Outputs.Syslog.Facility = "user"
+	cfg.Outputs.Syslog.AppName = "NFR"
+	cfg.Outputs.Syslog.Framing = "octet-counting"
+	cfg.Outputs.QRadar.Port = 514
+	cfg.Outputs.Elastic.Index = "nfr-alerts"
+	cfg.Outputs.OCSF.Class = "detection_finding"
+	cfg.Outputs.Queue.Size = 10000
+	cfg.Outputs.Queue.Persist = true
+	cfg.Outputs.Store.Retention = 30 * 24 * time.Hour
+	cfg.Outputs.Suppress.Key = []string{"threat", "src_ip", "query", "dest_ip"}
+	cfg.Outputs.Suppress.Window = 24 * time.Hour
+	cfg.Outputs.Enrich.ReverseDNS.Timeout = 2 * time.Second
+	cfg.Outputs.Enrich.ReverseDNS.CacheTTL = time.Hour
+	cfg.Outputs.Enrich.PassiveDNS.MaxAddresses = pdns.DefaultMaxAddresses
+	cfg.Outputs.Enrich.PassiveDNS.MaxNames = pdns.DefaultMaxNames
+	cfg.Outputs.Enrich.PassiveDNS.Retention = pdns.DefaultRetention
+	cfg.Outputs.Enrich.PassiveDNS.SaveInterval = time.Minute
+	cfg.Outputs.Enrich.DHCPLeases.Format = "isc"
+	cfg.Outputs.Kafka.Key = "src_ip"
+	cfg.Outputs.Kafka.Format = "json"
+	cfg.Outputs.Kafka.Acks = "all"
+	cfg.Outputs.Kafka.BatchSize = 100
+	cfg.Outputs.Kafka.Timeout = 10 * time.Second
 
 	cfg.Log.File = "stdout"
 	cfg.Log.Level = "info"
@@ -319,7 +888,14 @@ func (cfg *Config) Save(file string) error {
 
 // HasOutputs returns true if at least one output is configured and enabled.
 func (cfg *Config) HasOutputs() bool {
-	return cfg.Outputs.Enabled && (cfg.Outputs.File != "" || cfg.Outputs.Graylog.URI != "")
+	return cfg.Outputs.Enabled && (cfg.Outputs.File != "" ||
+		cfg.Outputs.Graylog.URI != "" ||
+		cfg.Outputs.QRadar.IP != "" ||
+		cfg.Outputs.Splunk.URL != "" ||
+		cfg.Outputs.Elastic.Enabled ||
+		cfg.Outputs.Store.Enabled ||
+		len(cfg.Outputs.Kafka.Brokers) > 0 ||
+		len(cfg.Outputs.Webhooks) > 0)
 }
 
 // HasInputs returns true if at least one input is configured and enabled.
@@ -327,6 +903,43 @@ func (cfg *Config) HasInputs() bool {
 	return cfg.Inputs.Sniffer.Enabled || len(cfg.Inputs.Monitors) > 0
 }
 
+// Sniffers returns configs of all enabled sniffers. The sniffer defined
+// directly in sniffer section is skipped if it has no interface, and
+// there are other sniffers defined.
+func (cfg *Config) Sniffers() []*Sniffer {
+	if !cfg.Inputs.Sniffer.Enabled {
+		return nil
+	}
+
+	var sniffers []*Sniffer
+	if cfg.Inputs.Sniffer.Interface != "" || len(cfg.Inputs.Sniffers) == 0 {
+		sniffers = append(sniffers, &cfg.Inputs.Sniffer.Sniffer)
+	}
+	for i := range cfg.Inputs.Sniffers {
+		sniffers = append(sniffers, &cfg.Inputs.Sniffers[i])
+	}
+	return sniffers
+}
+
+// HomeNetworks returns networks used by sniffer to determine packet direction.
+// If none are configured, then in_scope networks of sniffer scope group,
+// or of all scope groups are used.
+func (cfg *Config) HomeNetworks(s *Sniffer) []string {
+	if len(s.HomeNetworks) > 0 {
+		return s.HomeNetworks
+	}
+
+	if group, ok := cfg.ScopeConfig.Groups[s.ScopeGroup]; ok && s.ScopeGroup != "" {
+		return group.InScope
+	}
+
+	var networks []string
+	for _, group := range cfg.ScopeConfig.Groups {
+		networks = append(networks, group.InScope...)
+	}
+	return networks
+}
+
 // load config from content.
 func (cfg *Config) load(content []byte) error {
 	return yaml.Unmarshal(content, cfg)
@@ -342,22 +955,19 @@ func (cfg *Config) validate() error {
 		return fmt.Errorf("inputs are configured but analysis of dns and ip are set to false")
 	}
 
-	if cfg.Inputs.Sniffer.Enabled {
-		if cfg.Inputs.Sniffer.Interface != "" {
-			iface, err := net.InterfaceByName(cfg.Inputs.Sniffer.Interface)
-			if err != nil {
-				return fmt.Errorf("can't open interface %s: %s", cfg.Inputs.Sniffer.Interface, err)
-			}
-			cfg.Inputs.Sniffer.HardwareAddr = iface.HardwareAddr
-		} else {
-			iface, err := utils.InterfaceWithPublicIP()
-			if err != nil {
-				return fmt.Errorf("can't find an interface for sniffing: %s", err)
-			}
-			cfg.Inputs.Sniffer.Interface = iface.Name
-			cfg.Inputs.Sniffer.HardwareAddr = iface.HardwareAddr
+	for i := range cfg.Inputs.Sniffers {
+		if cfg.Inputs.Sniffers[i].Interface == "" {
+			return fmt.Errorf("no interface for sniffer %d", i+1)
 		}
 	}
+	for _, sniffer := range cfg.Sniffers() {
+		if err := cfg.validateSniffer(sniffer); err != nil {
+			return err
+		}
+	}
+	if err := cfg.validatePcapRing(); err != nil {
+		return fmt.Errorf("pcap ring: %s", err)
+	}
 
 	if err := validateFilename(cfg.Log.File, true); err != nil {
 		return err
@@ -369,6 +979,10 @@ func (cfg *Config) validate() error {
 		return fmt.Errorf("invalid %s log level", cfg.Log.Level)
 	}
 
+	if err := cfg.Log.Rotate.validate(); err != nil {
+		return fmt.Errorf("log: %s", err)
+	}
+
 	if err := validateFilename(cfg.Data.File, false); err != nil {
 		return err
 	}
@@ -389,6 +1003,29 @@ func (cfg *Config) validate() error {
 		if _, _, err := net.SplitHostPort(parsedURI.Host); err != nil {
 			return fmt.Errorf("missing port in graylog uri %s", cfg.Outputs.Graylog.URI)
 		}
+
+		if parsedURI.Scheme != "udp" && parsedURI.Scheme != "tcp" {
+			return fmt.Errorf("invalid graylog uri scheme %s, must be udp or tcp", parsedURI.Scheme)
+		}
+
+		if parsedURI.Scheme == "udp" && cfg.Outputs.Graylog.TLS.Enabled {
+			return fmt.Errorf("graylog tls requires tcp uri")
+		}
+
+		if err := cfg.Outputs.Graylog.TLS.validate(); err != nil {
+			return fmt.Errorf("graylog tls: %s", err)
+		}
+	}
+
+	switch cfg.Outputs.Graylog.Compression {
+	case "none", "gzip", "zlib":
+	default:
+		return fmt.Errorf("invalid graylog compression %s", cfg.Outputs.Graylog.Compression)
+	}
+
+	// chunk must hold 12 bytes of header and some data
+	if cfg.Outputs.Graylog.ChunkSize <= 12 || cfg.Outputs.Graylog.ChunkSize > 65507 {
+		return fmt.Errorf("invalid graylog chunk size %d", cfg.Outputs.Graylog.ChunkSize)
 	}
 
 	if cfg.Outputs.Graylog.Level < 0 || cfg.Outputs.Graylog.Level > 7 {
@@ -399,6 +1036,98 @@ func (cfg *Config) validate() error {
 		return fmt.Errorf("config: invalid qradar port number %d", cfg.Outputs.Syslog.Port)
 	}
 
+	if cfg.Outputs.OCSF.Class != "detection_finding" && cfg.Outputs.OCSF.Class != "network_activity" {
+		return fmt.Errorf("invalid ocsf class %s", cfg.Outputs.OCSF.Class)
+	}
+
+	if cfg.Outputs.Syslog.IP != "" {
+		if err := validateSyslog(cfg); err != nil {
+			return fmt.Errorf("syslog output: %s", err)
+		}
+	}
+
+	if cfg.Outputs.QRadar.IP != "" {
+		if cfg.Outputs.QRadar.Port <= 0 || cfg.Outputs.QRadar.Port > 65535 {
+			return fmt.Errorf("invalid qradar port number %d", cfg.Outputs.QRadar.Port)
+		}
+		if err := cfg.Outputs.QRadar.TLS.validate(); err != nil {
+			return fmt.Errorf("qradar output: %s", err)
+		}
+	}
+
+	if cfg.Outputs.Splunk.URL != "" {
+		u, err := url.Parse(cfg.Outputs.Splunk.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid splunk url %s", cfg.Outputs.Splunk.URL)
+		}
+		if cfg.Outputs.Splunk.Token == "" {
+			return fmt.Errorf("splunk token required")
+		}
+	}
+
+	if cfg.Outputs.Elastic.Enabled {
+		if err := cfg.Inputs.Elastic.ValidateConnection(); err != nil {
+			return fmt.Errorf("elastic output: %s", err)
+		}
+		if cfg.Outputs.Elastic.Index == "" {
+			return fmt.Errorf("elastic output: index required")
+		}
+	}
+
+	if len(cfg.Outputs.Kafka.Brokers) > 0 {
+		if err := cfg.validateKafka(); err != nil {
+			return fmt.Errorf("kafka output: %s", err)
+		}
+	}
+
+	if cfg.Outputs.Queue.Size <= 0 {
+		return fmt.Errorf("outputs queue size must be positive")
+	}
+
+	if cfg.Outputs.Store.Retention < 0 {
+		return fmt.Errorf("invalid alerts store retention %s", cfg.Outputs.Store.Retention)
+	}
+	if cfg.Outputs.Store.MaxAlerts < 0 {
+		return fmt.Errorf("invalid alerts store max alerts %d", cfg.Outputs.Store.MaxAlerts)
+	}
+
+	if cfg.Outputs.Suppress.Enabled {
+		if len(cfg.Outputs.Suppress.Key) == 0 {
+			return fmt.Errorf("suppress key required")
+		}
+		if cfg.Outputs.Suppress.Window < time.Minute {
+			return fmt.Errorf("suppress window must be at least 1m")
+		}
+	}
+
+	if err := cfg.Outputs.FileRotate.validate(); err != nil {
+		return fmt.Errorf("file output: %s", err)
+	}
+
+	if err := cfg.validateEnrich(); err != nil {
+		return fmt.Errorf("enrich: %s", err)
+	}
+
+	for _, webhook := range cfg.Outputs.Webhooks {
+		if err := validateWebhook(&webhook); err != nil {
+			return err
+		}
+	}
+
+	for name, filter := range map[string]*Filter{
+		"file":    &cfg.Outputs.FileFilter,
+		"graylog": &cfg.Outputs.Graylog.Filter,
+		"syslog":  &cfg.Outputs.Syslog.Filter,
+		"qradar":  &cfg.Outputs.QRadar.Filter,
+		"splunk":  &cfg.Outputs.Splunk.Filter,
+		"elastic": &cfg.Outputs.Elastic.Filter,
+		"kafka":   &cfg.Outputs.Kafka.Filter,
+	} {
+		if err := filter.validate(); err != nil {
+			return fmt.Errorf("%s output: %s", name, err)
+		}
+	}
+
 	if cfg.Outputs.File != "" {
 		if err := validateFilename(cfg.Outputs.File, true); err != nil {
 			return err
@@ -409,6 +1138,10 @@ func (cfg *Config) validate() error {
 		return fmt.Errorf("events poll interval must be at least 5s")
 	}
 
+	if err := cfg.validateIOC(); err != nil {
+		return fmt.Errorf("ioc: %s", err)
+	}
+
 	if cfg.DNSEvents.BufferSize < 64 {
 		return fmt.Errorf("queries buffer size must be at least 64")
 	}
@@ -490,6 +1223,258 @@ func (cfg *Config) validate() error {
 	return nil
 }
 
+// validateSniffer validates sniffer config and finds its interface hardware address.
+func (cfg *Config) validateSniffer(s *Sniffer) error {
+	if s.Interface != "" {
+		iface, err := net.InterfaceByName(s.Interface)
+		if err != nil {
+			return fmt.Errorf("can't open interface %s: %s", s.Interface, err)
+		}
+		s.HardwareAddr = iface.HardwareAddr
+	} else {
+		iface, err := utils.InterfaceWithPublicIP()
+		if err != nil {
+			return fmt.Errorf("can't find an interface for sniffing: %s", err)
+		}
+		s.Interface = iface.Name
+		s.HardwareAddr = iface.HardwareAddr
+	}
+
+	if s.Direction != "networks" && s.Direction != "mac" {
+		return fmt.Errorf("invalid %s sniffer direction", s.Direction)
+	}
+
+	for _, cidr := range s.HomeNetworks {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return fmt.Errorf("invalid home network %s", cidr)
+		}
+	}
+
+	if s.ScopeGroup != "" {
+		if _, ok := cfg.ScopeConfig.Groups[s.ScopeGroup]; !ok {
+			return fmt.Errorf("sniffer on %s: scope group %s not found", s.Interface, s.ScopeGroup)
+		}
+	}
+
+	switch s.Capture {
+	case "pcap":
+		if s.Fanout > 1 {
+			return fmt.Errorf("sniffer fanout requires afpacket capture")
+		}
+	case "afpacket":
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("afpacket capture is supported only on linux")
+		}
+	default:
+		return fmt.Errorf("invalid %s sniffer capture", s.Capture)
+	}
+	if s.Snaplen < 0 {
+		return fmt.Errorf("invalid %d sniffer snaplen", s.Snaplen)
+	}
+	if s.BufferSize < 0 {
+		return fmt.Errorf("invalid %d sniffer buffer size", s.BufferSize)
+	}
+	if s.BlockSize < 0 || s.BlockSize%4 != 0 {
+		return fmt.Errorf("invalid %d sniffer block size, must be a multiple of 4", s.BlockSize)
+	}
+	if s.Fanout < 1 {
+		return fmt.Errorf("invalid %d sniffer fanout", s.Fanout)
+	}
+	return nil
+}
+
+func validateWebhook(webhook *Webhook) error {
+	u, err := url.Parse(webhook.URL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook url %s", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid webhook url %s", webhook.URL)
+	}
+
+	if webhook.TemplateFile != "" {
+		if _, err := os.Stat(webhook.TemplateFile); err != nil {
+			return fmt.Errorf("can't open webhook template file %s", err)
+		}
+	} else if webhook.Template != "" &&
+		webhook.Template != "json" &&
+		webhook.Template != "slack" &&
+		webhook.Template != "teams" &&
+		webhook.Template != "ocsf" &&
+		webhook.Template != "stix" {
+		return fmt.Errorf("invalid %s webhook template", webhook.Template)
+	}
+
+	if webhook.BatchSize < 0 {
+		return fmt.Errorf("invalid %d webhook batch size", webhook.BatchSize)
+	}
+	if webhook.Retries != nil && *webhook.Retries < 0 {
+		return fmt.Errorf("invalid %d webhook retries", *webhook.Retries)
+	}
+	if err := webhook.Filter.validate(); err != nil {
+		return fmt.Errorf("webhook %s: %s", webhook.URL, err)
+	}
+	return nil
+}
+
+// validateIOC checks local indicators of compromise settings.
+func (cfg *Config) validateIOC() error {
+	ioc := &cfg.Engine.IOC
+	if len(ioc.Feeds) == 0 {
+		return nil
+	}
+	if !cfg.HasOutputs() {
+		return fmt.Errorf("feeds require at least one output")
+	}
+	if ioc.ReloadInterval < time.Second {
+		return fmt.Errorf("reload interval must be at least 1s")
+	}
+	if ioc.DedupWindow < 0 {
+		return fmt.Errorf("dedup window must not be negative")
+	}
+
+	names := make(map[string]bool)
+	for i := range ioc.Feeds {
+		feed := &ioc.Feeds[i]
+		if feed.Name == "" {
+			return fmt.Errorf("no name for feed %d", i+1)
+		}
+		if names[feed.Name] {
+			return fmt.Errorf("duplicated feed %s", feed.Name)
+		}
+		names[feed.Name] = true
+
+		if feed.Format == "" {
+			feed.Format = "list"
+		}
+		if !utils.StringsContains([]string{"list", "csv", "misp", "stix"}, feed.Format) {
+			return fmt.Errorf("invalid feed %s format %s", feed.Name, feed.Format)
+		}
+		if feed.Type != "" && !utils.StringsContains([]string{"domain", "ip", "url", "ja3"}, feed.Type) {
+			return fmt.Errorf("invalid feed %s type %s", feed.Name, feed.Type)
+		}
+		if feed.Severity < 0 || feed.Severity > 5 {
+			return fmt.Errorf("invalid feed %s severity %d", feed.Name, feed.Severity)
+		}
+		if _, err := os.Stat(feed.File); err != nil {
+			return fmt.Errorf("feed %s: %s", feed.Name, err)
+		}
+	}
+	return nil
+}
+
+// validatePcapRing checks packet capture ring settings.
+func (cfg *Config) validatePcapRing() error {
+	ring := &cfg.Inputs.PcapRing
+	if !ring.Enabled {
+		return nil
+	}
+	if ring.MaxSize <= 0 || ring.SegmentSize <= 0 {
+		return fmt.Errorf("max size and segment size must be positive")
+	}
+	if ring.SegmentSize > ring.MaxSize {
+		return fmt.Errorf("segment size %dMB exceeds max size %dMB", ring.SegmentSize, ring.MaxSize)
+	}
+	if ring.MaxAge <= 0 || ring.SegmentInterval <= 0 {
+		return fmt.Errorf("max age and segment interval must be positive")
+	}
+	if ring.Before < 0 || ring.After < 0 {
+		return fmt.Errorf("before and after must not be negative")
+	}
+	return nil
+}
+
+// validateEnrich checks alerts enrichment settings.
+func (cfg *Config) validateEnrich() error {
+	enrich := &cfg.Outputs.Enrich
+	if enrich.PassiveDNS.Enabled {
+		if enrich.PassiveDNS.MaxAddresses <= 0 || enrich.PassiveDNS.MaxNames <= 0 {
+			return fmt.Errorf("passive dns max addresses and max names must be positive")
+		}
+		if enrich.PassiveDNS.Retention < time.Minute {
+			return fmt.Errorf("passive dns retention must be at least 1m")
+		}
+		if enrich.PassiveDNS.SaveInterval <= 0 {
+			return fmt.Errorf("passive dns save interval must be positive")
+		}
+	}
+	if enrich.DHCPLeases.File != "" {
+		if enrich.DHCPLeases.Format != "isc" && enrich.DHCPLeases.Format != "dnsmasq" {
+			return fmt.Errorf("invalid dhcp leases format %s", enrich.DHCPLeases.Format)
+		}
+		if _, err := os.Stat(enrich.DHCPLeases.File); err != nil {
+			return fmt.Errorf("can't open dhcp leases file %s", err)
+		}
+	}
+	if enrich.Inventory.File != "" {
+		if ext := strings.ToLower(filepath.Ext(enrich.Inventory.File)); ext != ".csv" && ext != ".json" {
+			return fmt.Errorf("inventory file %s must be csv or json", enrich.Inventory.File)
+		}
+		if _, err := os.Stat(enrich.Inventory.File); err != nil {
+			return fmt.Errorf("can't open inventory file %s", err)
+		}
+	}
+	for _, file := range enrich.GeoIP.Files {
+		if _, err := os.Stat(file); err != nil {
+			return fmt.Errorf("can't open geoip database %s", err)
+		}
+	}
+	return nil
+}
+
+// validateSyslog validates syslog output config.
+func validateSyslog(cfg *Config) error {
+	if cfg.Outputs.Syslog.Proto != "tcp" && cfg.Outputs.Syslog.Proto != "udp" {
+		return fmt.Errorf("invalid proto %s, must be tcp or udp", cfg.Outputs.Syslog.Proto)
+	}
+	if cfg.Outputs.Syslog.Proto == "udp" && cfg.Outputs.Syslog.TLS.Enabled {
+		return fmt.Errorf("tls requires tcp proto")
+	}
+	if _, err := syslog.ParseFacility(cfg.Outputs.Syslog.Facility); err != nil {
+		return err
+	}
+	if cfg.Outputs.Syslog.Framing != syslog.OctetCounting && cfg.Outputs.Syslog.Framing != syslog.NonTransparent {
+		return fmt.Errorf("invalid framing %s", cfg.Outputs.Syslog.Framing)
+	}
+	return cfg.Outputs.Syslog.TLS.validate()
+}
+
+// validateKafka checks kafka output settings.
+func (cfg *Config) validateKafka() error {
+	kafka := &cfg.Outputs.Kafka
+	if kafka.Topic == "" {
+		return fmt.Errorf("topic required")
+	}
+	switch kafka.Key {
+	case "src_ip", "threat", "none":
+	default:
+		return fmt.Errorf("invalid key %s", kafka.Key)
+	}
+	switch kafka.Format {
+	case "json", "cef", "leef", "ocsf", "stix":
+	default:
+		return fmt.Errorf("invalid format %s", kafka.Format)
+	}
+	switch kafka.Acks {
+	case "all", "leader", "none":
+	default:
+		return fmt.Errorf("invalid acks %s", kafka.Acks)
+	}
+	if kafka.BatchSize <= 0 {
+		return fmt.Errorf("batch size must be positive")
+	}
+	switch kafka.SASL.Mechanism {
+	case "":
+	case "plain", "scram-sha-256", "scram-sha-512":
+		if kafka.SASL.Username == "" {
+			return fmt.Errorf("sasl username required")
+		}
+	default:
+		return fmt.Errorf("invalid sasl mechanism %s", kafka.SASL.Mechanism)
+	}
+	return kafka.TLS.validate()
+}
+
 // validateFilename checks if file can be created.
 func validateFilename(file string, noFileOutput bool) error {
 	if noFileOutput && (file == "stdout" || file == "stderr") {
@@ -600,6 +1585,38 @@ func (cfg *Config) validateScopeConfig() error {
 	return nil
 }
 
+// AlertsStoreFile returns file of the alerts store.
+func (cfg *Config) AlertsStoreFile() string {
+	if cfg.Outputs.Store.File != "" {
+		return cfg.Outputs.Store.File
+	}
+	return path.Join(cfg.Data.Dir, "alerts.db")
+}
+
+// PcapRingDir returns dir of the pcap ring files.
+func (cfg *Config) PcapRingDir() string {
+	if cfg.Inputs.PcapRing.Dir != "" {
+		return cfg.Inputs.PcapRing.Dir
+	}
+	return path.Join(cfg.Data.Dir, "pcap-ring")
+}
+
+// PcapAlertsDir returns dir of the alerts pcap files.
+func (cfg *Config) PcapAlertsDir() string {
+	if cfg.Inputs.PcapRing.AlertsDir != "" {
+		return cfg.Inputs.PcapRing.AlertsDir
+	}
+	return path.Join(cfg.Data.Dir, "pcap-alerts")
+}
+
+// PassiveDNSFile returns file of the passive dns records.
+func (cfg *Config) PassiveDNSFile() string {
+	if cfg.Outputs.Enrich.PassiveDNS.File != "" {
+		return cfg.Outputs.Enrich.PassiveDNS.File
+	}
+	return path.Join(cfg.Data.Dir, "pdns.json")
+}
+
 func (cfg *Config) WriteData(fname string, data []byte) error {
 	fullname := path.Join(cfg.Data.Dir, fname)
 	f, err := os.Create(fullname)
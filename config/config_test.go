@@ -24,9 +24,30 @@ func checkDefaults(t *testing.T, cfg *Config) {
 	if cfg.Outputs.Syslog.Port != 514 {
 		t.Fatalf("invalid output syslog port - got %d; expected %d", cfg.Outputs.Syslog.Port, 514)
 	}
+	if cfg.Outputs.Kafka.Key != "src_ip" || cfg.Outputs.Kafka.Acks != "all" {
+		t.Fatalf("invalid output kafka key or acks - got %s, %s; expected %s, %s", cfg.Outputs.Kafka.Key, cfg.Outputs.Kafka.Acks, "src_ip", "all")
+	}
 	if cfg.Engine.Alerts.PollInterval != 5*time.Minute {
 		t.Fatalf("invalid events poll interval - got %s; expected %s", cfg.Engine.Alerts.PollInterval, 5*time.Minute)
 	}
+	if cfg.Inputs.Sniffer.Direction != "networks" {
+		t.Fatalf("invalid sniffer direction - got %s; expected %s", cfg.Inputs.Sniffer.Direction, "networks")
+	}
+	if cfg.Inputs.Sniffer.Capture != "pcap" {
+		t.Fatalf("invalid sniffer capture - got %s; expected %s", cfg.Inputs.Sniffer.Capture, "pcap")
+	}
+	if cfg.Inputs.Sniffer.Snaplen != 1600 {
+		t.Fatalf("invalid sniffer snaplen - got %d; expected %d", cfg.Inputs.Sniffer.Snaplen, 1600)
+	}
+	if !cfg.Inputs.Sniffer.Promiscuous {
+		t.Fatalf("sniffer promiscuous mode set to false")
+	}
+	if cfg.Inputs.Sniffer.Fanout != 1 {
+		t.Fatalf("invalid sniffer fanout - got %d; expected %d", cfg.Inputs.Sniffer.Fanout, 1)
+	}
+	if l := len(cfg.HomeNetworks(&cfg.Inputs.Sniffer.Sniffer)); l != 4 {
+		t.Fatalf("invalid number of home networks - got %d; expected %d", l, 4)
+	}
 	if cfg.Log.File != "stdout" {
 		t.Fatalf("invalid log file - got %s; expected %s", cfg.Log.File, "stdout")
 	}
@@ -169,3 +190,40 @@ groups:
 		t.Fatal("invalid private group domains exclude")
 	}
 }
+
+func TestReadSniffers(t *testing.T) {
+	var content = []byte(`
+inputs:
+  sniffer:
+    enabled: true
+  sniffers:
+    - interface: eth1
+      bpf_filter: udp port 53
+      scope_group: default
+    - interface: eth2
+      direction: mac
+      promiscuous: false`)
+
+	cfg := NewDefault()
+	if err := cfg.load(content); err != nil {
+		t.Fatal(err)
+	}
+	cfg.loadScopeConfig()
+
+	sniffers := cfg.Sniffers()
+	if l := len(sniffers); l != 2 {
+		t.Fatalf("invalid number of sniffers - got %d; expected %d", l, 2)
+	}
+	if sniffers[0].BPFilter != "udp port 53" {
+		t.Fatalf("invalid sniffer bpf filter - got %s; expected %s", sniffers[0].BPFilter, "udp port 53")
+	}
+	if sniffers[0].Direction != "networks" || !sniffers[0].Promiscuous || sniffers[0].Snaplen != 1600 {
+		t.Fatalf("sniffer defaults not set")
+	}
+	if l := len(cfg.HomeNetworks(sniffers[0])); l != 4 {
+		t.Fatalf("invalid number of sniffer home networks - got %d; expected %d", l, 4)
+	}
+	if sniffers[1].Direction != "mac" || sniffers[1].Promiscuous {
+		t.Fatalf("sniffer settings not read")
+	}
+}
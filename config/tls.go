@@ -0,0 +1,69 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// TLS is a client tls configuration of an output.
+type TLS struct {
+	// Enabled if set to true, then connection is encrypted.
+	// Default: false
+	Enabled bool `yaml:"enabled"`
+
+	// CAFile with PEM encoded certificates used to verify server.
+	// If not set, then system certificates are used.
+	// Default: (none)
+	CAFile string `yaml:"ca_file,omitempty"`
+
+	// CertFile and KeyFile with PEM encoded client certificate and key.
+	// Default: (none)
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+
+	// InsecureSkipVerify disables server certificate verification.
+	// Default: false
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify"`
+}
+
+// ClientConfig loads certificates and returns tls config for a client.
+// It returns nil if tls is not enabled.
+func (t *TLS) ClientConfig() (*tls.Config, error) {
+	if !t.Enabled {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+	if t.CAFile != "" {
+		b, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", t.CAFile)
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// validate checks if tls files are readable.
+func (t *TLS) validate() error {
+	if !t.Enabled {
+		return nil
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("both cert_file and key_file required")
+	}
+	_, err := t.ClientConfig()
+	return err
+}
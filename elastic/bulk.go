@@ -0,0 +1,95 @@
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Document to index. If ID is set, then the document is created with
+// this id, so indexing it again doesn't create a duplicate.
+type Document struct {
+	ID     string
+	Source interface{}
+}
+
+// bulkAction is an action line of bulk api request.
+type bulkAction struct {
+	Create struct {
+		ID string `json:"_id,omitempty"`
+	} `json:"create"`
+}
+
+// bulkResponse is a response of bulk api, with only fields needed to find failed items.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int `json:"status"`
+		Error  struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// Index indexes documents using bulk api. Documents are created, so the index
+// may be an index, ILM alias or data stream. Documents without id get generated
+// ids. Documents with id which already exist are not indexed again, and it's
+// not an error, so failed requests can be retried.
+func (c *Client) Index(ctx context.Context, index string, docs []Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, doc := range docs {
+		var action bulkAction
+		action.Create.ID = doc.ID
+		if err := enc.Encode(&action); err != nil {
+			return err
+		}
+		if err := enc.Encode(doc.Source); err != nil {
+			return err
+		}
+	}
+
+	res, err := c.c.Bulk(&body,
+		c.c.Bulk.WithContext(ctx),
+		c.c.Bulk.WithIndex(index),
+	)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if err := IsAPIError(res); err != nil {
+		return err
+	}
+
+	var r bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return err
+	}
+	if !r.Errors {
+		return nil
+	}
+
+	var failed int
+	var last error
+	for _, item := range r.Items {
+		for _, result := range item {
+			// document with the same id was already created
+			if result.Status >= 300 && result.Status != http.StatusConflict {
+				failed++
+				last = fmt.Errorf("%s: %s", result.Error.Type, result.Error.Reason)
+			}
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d documents not indexed, last error %s", failed, len(docs), last)
+}
@@ -193,6 +193,26 @@ func (cfg *Config) Validate() error {
 		return nil
 	}
 
+	if err := cfg.ValidateConnection(); err != nil {
+		return err
+	}
+
+	if len(cfg.Searches) == 0 {
+		return errors.New("at least one search must be defined")
+	}
+
+	for _, searchcfg := range cfg.Searches {
+		if err := searchcfg.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateConnection returns an error if the connection settings aren't valid.
+// It's used also when only alerts are sent to elasticsearch.
+func (cfg *Config) ValidateConnection() error {
 	emptyCloudID := cfg.CloudID == ""
 	emptyHosts := len(cfg.Hosts) == 0
 
@@ -206,16 +226,6 @@ func (cfg *Config) Validate() error {
 		return errors.New("either apikey or username field must be set")
 	}
 
-	if len(cfg.Searches) == 0 {
-		return errors.New("at least one search must be defined")
-	}
-
-	for _, searchcfg := range cfg.Searches {
-		if err := searchcfg.Validate(); err != nil {
-			return err
-		}
-	}
-
 	return nil
 }
 
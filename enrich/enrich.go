@@ -0,0 +1,87 @@
+// Package enrich fills alerts source host, mac, user and asset details
+// from dhcp leases, asset inventory and reverse dns, destination host
+// from passive dns, and destination location from GeoIP databases.
+package enrich
+
+import (
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/pdns"
+)
+
+// Enricher implements alerts.Enricher interface. Any of its sources may be nil.
+type Enricher struct {
+	Leases     *Leases
+	Inventory  *Inventory
+	ReverseDNS *ReverseDNS
+	PassiveDNS *pdns.Cache
+	GeoIP      *GeoIP
+}
+
+// maxResolvedGeo limits locations of addresses resolved for dns alert.
+const maxResolvedGeo = 10
+
+// Enrich fills empty source fields of the event. Leases are looked up at the
+// event time, then the inventory by ip or mac, and at last reverse dns is used.
+// Empty destination host is filled with the name resolved to destination ip.
+// Destination ip, or addresses the dns query resolved to, are located with GeoIP.
+func (e *Enricher) Enrich(ev *alerts.Event) {
+	if e.PassiveDNS != nil && ev.DestIP != nil && ev.DestHost == "" {
+		ev.DestHost = e.PassiveDNS.Name(ev.DestIP, ev.Timestamp)
+	}
+
+	if e.GeoIP != nil {
+		if ev.DestIP != nil && ev.DestGeo == nil {
+			ev.DestGeo = e.GeoIP.Lookup(ev.DestIP)
+		}
+		if e.PassiveDNS != nil && ev.Query != "" && len(ev.ResolvedGeo) == 0 {
+			for _, r := range e.PassiveDNS.LookupName(ev.Query) {
+				if len(ev.ResolvedGeo) == maxResolvedGeo {
+					break
+				}
+				if geo := e.GeoIP.Lookup(r.IP); geo != nil {
+					ev.ResolvedGeo = append(ev.ResolvedGeo, *geo)
+				}
+			}
+		}
+	}
+
+	if ev.SrcIP == nil {
+		return
+	}
+
+	if e.Leases != nil {
+		if lease := e.Leases.Lookup(ev.SrcIP, ev.Timestamp); lease != nil {
+			if ev.SrcMac == "" {
+				ev.SrcMac = lease.MAC
+			}
+			if ev.SrcHost == "" {
+				ev.SrcHost = lease.Hostname
+			}
+		}
+	}
+
+	if e.Inventory != nil {
+		if asset := e.Inventory.Lookup(ev.SrcIP, ev.SrcMac); asset != nil {
+			if ev.SrcMac == "" {
+				ev.SrcMac = asset.MAC
+			}
+			if ev.SrcHost == "" {
+				ev.SrcHost = asset.Hostname
+			}
+			if ev.SrcUser == "" {
+				ev.SrcUser = asset.User
+			}
+			if asset.Owner != "" || asset.Tag != "" || asset.Criticality != "" {
+				ev.Asset = &alerts.Asset{
+					Owner:       asset.Owner,
+					Tag:         asset.Tag,
+					Criticality: asset.Criticality,
+				}
+			}
+		}
+	}
+
+	if e.ReverseDNS != nil && ev.SrcHost == "" {
+		ev.SrcHost = e.ReverseDNS.Lookup(ev.SrcIP)
+	}
+}
@@ -0,0 +1,292 @@
+package enrich
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/pdns"
+)
+
+const iscLeases = `# The format of this file is documented in the dhcpd.leases(5) manual page.
+lease 192.168.1.10 {
+  starts 4 2021/03/04 10:00:00;
+  ends 4 2021/03/04 22:00:00;
+  binding state free;
+  hardware ethernet 00:11:22:33:44:55;
+  client-hostname "old-laptop";
+}
+lease 192.168.1.10 {
+  starts 5 2021/03/05 08:00:00;
+  ends never;
+  binding state active;
+  hardware ethernet AA:BB:CC:DD:EE:FF;
+  uid "\001\252\273\314\335\356\377";
+  client-hostname "laptop";
+}
+`
+
+const dnsmasqLeases = `1614952800 00:11:22:33:44:55 192.168.1.20 printer 01:00:11:22:33:44:55
+0 aa:bb:cc:00:00:01 192.168.1.21 * *
+duid 00:01:00:01:27:c0:1c:4b:00:11:22:33:44:55
+`
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLeases(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-enrich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	isc, err := NewLeases(writeFile(t, dir, "dhcpd.leases", iscLeases), "isc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip := net.IPv4(192, 168, 1, 10)
+	for _, tt := range []struct {
+		ts       time.Time
+		mac      string
+		hostname string
+	}{
+		{time.Date(2021, 3, 4, 12, 0, 0, 0, time.UTC), "00:11:22:33:44:55", "old-laptop"},
+		{time.Date(2021, 3, 6, 12, 0, 0, 0, time.UTC), "aa:bb:cc:dd:ee:ff", "laptop"},
+	} {
+		lease := isc.Lookup(ip, tt.ts)
+		if lease == nil || lease.MAC != tt.mac || lease.Hostname != tt.hostname {
+			t.Fatalf("invalid lease at %s - got %+v; expected %s %s", tt.ts, lease, tt.mac, tt.hostname)
+		}
+	}
+	if lease := isc.Lookup(ip, time.Date(2021, 3, 5, 0, 0, 0, 0, time.UTC)); lease != nil {
+		t.Fatalf("unexpected lease between leases %+v", lease)
+	}
+
+	dnsmasq, err := NewLeases(writeFile(t, dir, "dnsmasq.leases", dnsmasqLeases), "dnsmasq")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease := dnsmasq.Lookup(net.IPv4(192, 168, 1, 20), time.Unix(1614952000, 0)); lease == nil || lease.Hostname != "printer" {
+		t.Fatalf("invalid dnsmasq lease %+v", lease)
+	}
+	if lease := dnsmasq.Lookup(net.IPv4(192, 168, 1, 20), time.Unix(1614953000, 0)); lease != nil {
+		t.Fatalf("unexpected expired dnsmasq lease %+v", lease)
+	}
+	if lease := dnsmasq.Lookup(net.IPv4(192, 168, 1, 21), time.Now()); lease == nil || lease.Hostname != "" {
+		t.Fatalf("invalid infinite dnsmasq lease %+v", lease)
+	}
+}
+
+func TestInventory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-enrich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	csv := writeFile(t, dir, "assets.csv", `ip,mac,hostname,owner,asset_tag,criticality
+10.0.0.5,,db01,dba-team,SRV-0005,high
+,AA:BB:CC:DD:EE:FF,laptop,jdoe,LT-0042,low
+`)
+	json := writeFile(t, dir, "assets.json", `[{"ip": "10.0.0.5", "hostname": "db01", "owner": "dba-team", "asset_tag": "SRV-0005", "criticality": "high"}]`)
+
+	for _, file := range []string{csv, json} {
+		inv, err := NewInventory(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if asset := inv.Lookup(net.IPv4(10, 0, 0, 5), ""); asset == nil || asset.Owner != "dba-team" || asset.Tag != "SRV-0005" {
+			t.Fatalf("invalid asset of %s - got %+v", file, asset)
+		}
+	}
+
+	inv, err := NewInventory(csv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asset := inv.Lookup(net.IPv4(10, 0, 0, 6), "aa:bb:cc:dd:ee:ff"); asset == nil || asset.Hostname != "laptop" {
+		t.Fatalf("invalid asset by mac - got %+v", asset)
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-enrich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	leases, err := NewLeases(writeFile(t, dir, "dhcpd.leases", iscLeases), "isc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inv, err := NewInventory(writeFile(t, dir, "assets.csv", "mac,user,owner,criticality\naa:bb:cc:dd:ee:ff,jdoe,it,low\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passiveDNS, err := pdns.New("", pdns.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passiveDNS.Add(time.Now(), "alphasoc.com", net.IPv4(35, 196, 211, 126))
+
+	ev := &alerts.Event{EventUnified: client.EventUnified{
+		Timestamp: time.Date(2021, 3, 6, 12, 0, 0, 0, time.UTC),
+		SrcIP:     net.IPv4(192, 168, 1, 10),
+		DestIP:    net.IPv4(35, 196, 211, 126),
+	}}
+	e := &Enricher{Leases: leases, Inventory: inv, PassiveDNS: passiveDNS}
+	e.Enrich(ev)
+
+	if ev.SrcMac != "aa:bb:cc:dd:ee:ff" || ev.SrcHost != "laptop" || ev.SrcUser != "jdoe" {
+		t.Fatalf("invalid enriched source %s %s %s", ev.SrcMac, ev.SrcHost, ev.SrcUser)
+	}
+	if ev.Asset == nil || ev.Asset.Owner != "it" || ev.Asset.Criticality != "low" {
+		t.Fatalf("invalid enriched asset %+v", ev.Asset)
+	}
+	if ev.DestHost != "alphasoc.com" {
+		t.Fatalf("invalid enriched destination host %s", ev.DestHost)
+	}
+}
+
+// mmdbControl writes control byte of the type and size, up to 284 bytes.
+func mmdbControl(buf *bytes.Buffer, typ byte, size int) {
+	if size < 29 {
+		buf.WriteByte(typ<<5 | byte(size))
+		return
+	}
+	buf.Write([]byte{typ<<5 | 29, byte(size - 29)})
+}
+
+// mmdbValue encodes value in MaxMind DB data section format. Only maps,
+// strings, uint32 and string arrays are supported.
+func mmdbValue(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		mmdbControl(buf, 7, len(v))
+		for key, value := range v {
+			mmdbValue(buf, key)
+			mmdbValue(buf, value)
+		}
+	case string:
+		mmdbControl(buf, 2, len(v))
+		buf.WriteString(v)
+	case uint32:
+		buf.WriteByte(6<<5 | 4)
+		binary.Write(buf, binary.BigEndian, v)
+	case []string:
+		// extended type, array is 4 + 7
+		buf.Write([]byte{byte(len(v)), 4})
+		for _, s := range v {
+			mmdbValue(buf, s)
+		}
+	}
+}
+
+// writeMMDB writes ipv4 MaxMind database with record for the network.
+func writeMMDB(t *testing.T, dir, name string, network *net.IPNet, record map[string]interface{}) string {
+	ip := network.IP.To4()
+	bits, _ := network.Mask.Size()
+	nodeCount := uint32(bits)
+
+	var buf bytes.Buffer
+	// search tree with 24 bit records, a node per bit of network
+	for i := 0; i < bits; i++ {
+		next := uint32(i + 1)
+		if i == bits-1 {
+			// pointer to the record at start of data section
+			next = nodeCount + 16
+		}
+		records := [2]uint32{nodeCount, nodeCount}
+		records[ip[i/8]>>(7-uint(i%8))&1] = next
+		for _, r := range records {
+			buf.Write([]byte{byte(r >> 16), byte(r >> 8), byte(r)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	mmdbValue(&buf, record)
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	mmdbValue(&buf, map[string]interface{}{
+		"node_count":                  nodeCount,
+		"record_size":                 uint32(24),
+		"ip_version":                  uint32(4),
+		"database_type":               "GeoLite2-Test",
+		"languages":                   []string{"en"},
+		"binary_format_major_version": uint32(2),
+		"binary_format_minor_version": uint32(0),
+		"build_epoch":                 uint32(time.Now().Unix()),
+		"description":                 map[string]interface{}{"en": "test"},
+	})
+	return writeFile(t, dir, name, buf.String())
+}
+
+func TestGeoIP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-geoip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, network, _ := net.ParseCIDR("8.8.8.0/24")
+	city := writeMMDB(t, dir, "city.mmdb", network, map[string]interface{}{
+		"country": map[string]interface{}{
+			"iso_code": "US",
+			"names":    map[string]interface{}{"en": "United States"},
+		},
+		"city": map[string]interface{}{
+			"names": map[string]interface{}{"en": "Mountain View"},
+		},
+	})
+	asn := writeMMDB(t, dir, "asn.mmdb", network, map[string]interface{}{
+		"autonomous_system_number":       uint32(15169),
+		"autonomous_system_organization": "Google LLC",
+	})
+
+	g, err := NewGeoIP(city, asn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geo := g.Lookup(net.IPv4(8, 8, 8, 8))
+	if geo == nil || geo.Country != "US" || geo.CountryName != "United States" ||
+		geo.City != "Mountain View" || geo.AS() != "AS15169 Google LLC" {
+		t.Fatalf("invalid geo %+v", geo)
+	}
+	if geo := g.Lookup(net.IPv4(1, 1, 1, 1)); geo != nil {
+		t.Fatalf("unexpected geo %+v", geo)
+	}
+	if geo := g.Lookup(net.ParseIP("2001:4860:4860::8888")); geo != nil {
+		t.Fatalf("unexpected geo of ipv6 %+v", geo)
+	}
+
+	passiveDNS, err := pdns.New("", pdns.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	passiveDNS.Add(time.Now(), "dns.google", net.IPv4(8, 8, 8, 8))
+
+	e := &Enricher{PassiveDNS: passiveDNS, GeoIP: g}
+	ev := &alerts.Event{EventUnified: client.EventUnified{DestIP: net.IPv4(8, 8, 8, 4)}}
+	e.Enrich(ev)
+	if ev.DestGeo == nil || ev.DestGeo.Country != "US" || ev.DestGeo.ASN != 15169 {
+		t.Fatalf("invalid destination geo %+v", ev.DestGeo)
+	}
+	ev = &alerts.Event{EventUnified: client.EventUnified{Query: "dns.google"}}
+	e.Enrich(ev)
+	if len(ev.ResolvedGeo) != 1 || !ev.ResolvedGeo[0].IP.Equal(net.IPv4(8, 8, 8, 8)) {
+		t.Fatalf("invalid resolved geo %+v", ev.ResolvedGeo)
+	}
+}
@@ -0,0 +1,114 @@
+package enrich
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+	maxminddb "github.com/oschwald/maxminddb-golang"
+)
+
+// geoRecord holds fields of MaxMind GeoIP2/GeoLite2 City, Country and ASN
+// databases. A database fills only some of them.
+type geoRecord struct {
+	Country struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	ASN   uint   `maxminddb:"autonomous_system_number"`
+	ASOrg string `maxminddb:"autonomous_system_organization"`
+}
+
+// geoIPDB is a single MaxMind database file.
+type geoIPDB struct {
+	file    string
+	modTime time.Time
+	reader  *maxminddb.Reader
+}
+
+// reload reads database file if it was modified since last read.
+// The file is read into memory, so it may be safely replaced.
+func (db *geoIPDB) reload() error {
+	stat, err := os.Stat(db.file)
+	if err != nil {
+		return err
+	}
+	if stat.ModTime().Equal(db.modTime) {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(db.file)
+	if err != nil {
+		return err
+	}
+	reader, err := maxminddb.FromBytes(b)
+	if err != nil {
+		return err
+	}
+	db.reader = reader
+	db.modTime = stat.ModTime()
+	return nil
+}
+
+// GeoIP maps ip addresses to country, city and autonomous system, from
+// MaxMind (.mmdb) databases, e.g. GeoLite2-City and GeoLite2-ASN.
+// The files are reloaded if they change.
+type GeoIP struct {
+	mx  sync.Mutex
+	dbs []*geoIPDB
+}
+
+// NewGeoIP loads MaxMind database files.
+func NewGeoIP(files ...string) (*GeoIP, error) {
+	g := &GeoIP{}
+	for _, file := range files {
+		db := &geoIPDB{file: file}
+		if err := db.reload(); err != nil {
+			return nil, err
+		}
+		g.dbs = append(g.dbs, db)
+	}
+	return g, nil
+}
+
+// Lookup returns location and autonomous system of the ip address merged
+// from all databases, or nil if it's not found in any.
+func (g *GeoIP) Lookup(ip net.IP) *alerts.Geo {
+	g.mx.Lock()
+	defer g.mx.Unlock()
+
+	geo := &alerts.Geo{}
+	for _, db := range g.dbs {
+		// keep previous database, if the file is being rewritten
+		db.reload()
+
+		var r geoRecord
+		// ipv6 address in ipv4 only database is an error, treat it as not found
+		if err := db.reader.Lookup(ip, &r); err != nil {
+			continue
+		}
+		if geo.Country == "" {
+			geo.Country = r.Country.ISOCode
+			geo.CountryName = r.Country.Names["en"]
+		}
+		if geo.City == "" {
+			geo.City = r.City.Names["en"]
+		}
+		if geo.ASN == 0 {
+			geo.ASN = r.ASN
+			geo.ASOrg = r.ASOrg
+		}
+	}
+
+	if geo.Country == "" && geo.City == "" && geo.ASN == 0 {
+		return nil
+	}
+	geo.IP = ip
+	return geo
+}
@@ -0,0 +1,125 @@
+package enrich
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Asset is an entry of the asset inventory.
+type Asset struct {
+	IP          string `json:"ip"`
+	MAC         string `json:"mac"`
+	Hostname    string `json:"hostname"`
+	User        string `json:"user"`
+	Owner       string `json:"owner"`
+	Tag         string `json:"asset_tag"`
+	Criticality string `json:"criticality"`
+}
+
+// Inventory of assets, indexed by ip and mac address.
+type Inventory struct {
+	byIP  map[string]*Asset
+	byMAC map[string]*Asset
+}
+
+// NewInventory loads asset inventory from csv or json file, depending
+// on file extension. Csv file must have a header with column names
+// same as json keys: ip, mac, hostname, user, owner, asset_tag, criticality.
+func NewInventory(file string) (*Inventory, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var assets []*Asset
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".csv":
+		assets, err = readCSVAssets(f)
+	case ".json":
+		err = json.NewDecoder(f).Decode(&assets)
+	default:
+		return nil, fmt.Errorf("unsupported inventory file %s, must be csv or json", file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %s", file, err)
+	}
+
+	inv := &Inventory{
+		byIP:  make(map[string]*Asset),
+		byMAC: make(map[string]*Asset),
+	}
+	for _, asset := range assets {
+		if ip := net.ParseIP(asset.IP); ip != nil {
+			inv.byIP[ip.String()] = asset
+		}
+		if mac, err := net.ParseMAC(asset.MAC); err == nil {
+			inv.byMAC[mac.String()] = asset
+		}
+	}
+	return inv, nil
+}
+
+// readCSVAssets reads assets from csv with header.
+func readCSVAssets(r io.Reader) ([]*Asset, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for n, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = n
+	}
+	if _, ok := columns["ip"]; !ok {
+		if _, ok := columns["mac"]; !ok {
+			return nil, fmt.Errorf("ip or mac column required")
+		}
+	}
+
+	var assets []*Asset
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return assets, nil
+		} else if err != nil {
+			return nil, err
+		}
+		value := func(column string) string {
+			if n, ok := columns[column]; ok && n < len(record) {
+				return strings.TrimSpace(record[n])
+			}
+			return ""
+		}
+		assets = append(assets, &Asset{
+			IP:          value("ip"),
+			MAC:         value("mac"),
+			Hostname:    value("hostname"),
+			User:        value("user"),
+			Owner:       value("owner"),
+			Tag:         value("asset_tag"),
+			Criticality: value("criticality"),
+		})
+	}
+}
+
+// Lookup returns asset with the ip address, or with the mac address if mac is not empty.
+func (inv *Inventory) Lookup(ip net.IP, mac string) *Asset {
+	if asset, ok := inv.byIP[ip.String()]; ok {
+		return asset
+	}
+	if hw, err := net.ParseMAC(mac); err == nil {
+		return inv.byMAC[hw.String()]
+	}
+	return nil
+}
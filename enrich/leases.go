@@ -0,0 +1,208 @@
+package enrich
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lease is a dhcp lease of an ip address.
+type Lease struct {
+	IP       net.IP
+	MAC      string
+	Hostname string
+	// Starts and Ends of the lease. Zero value means unknown or never.
+	Starts time.Time
+	Ends   time.Time
+}
+
+// valid checks if lease is valid at the given time.
+func (l *Lease) valid(ts time.Time) bool {
+	return (l.Starts.IsZero() || !ts.Before(l.Starts)) && (l.Ends.IsZero() || ts.Before(l.Ends))
+}
+
+// Leases maps ip addresses to mac and hostname at the given time, from
+// ISC dhcpd or dnsmasq leases file. The file is reloaded if it changes.
+type Leases struct {
+	file   string
+	format string
+
+	mx      sync.Mutex
+	modTime time.Time
+	leases  map[string][]*Lease
+}
+
+// NewLeases loads leases file in isc (dhcpd.leases) or dnsmasq format.
+func NewLeases(file, format string) (*Leases, error) {
+	if format != "isc" && format != "dnsmasq" {
+		return nil, fmt.Errorf("invalid dhcp leases format %s", format)
+	}
+	l := &Leases{file: file, format: format}
+	if err := l.reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// reload reads leases file if it was modified since last read.
+func (l *Leases) reload() error {
+	stat, err := os.Stat(l.file)
+	if err != nil {
+		return err
+	}
+	if stat.ModTime().Equal(l.modTime) {
+		return nil
+	}
+
+	f, err := os.Open(l.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var leases []*Lease
+	if l.format == "isc" {
+		leases, err = parseISCLeases(f)
+	} else {
+		leases, err = parseDnsmasqLeases(f)
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s: %s", l.file, err)
+	}
+
+	l.leases = make(map[string][]*Lease)
+	for _, lease := range leases {
+		ip := lease.IP.String()
+		l.leases[ip] = append(l.leases[ip], lease)
+	}
+	l.modTime = stat.ModTime()
+	return nil
+}
+
+// Lookup returns lease of the ip address valid at the given time.
+// If many leases match, then the last one from the file is returned.
+func (l *Leases) Lookup(ip net.IP, ts time.Time) *Lease {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	// keep previous leases, if the file is being rewritten
+	l.reload()
+
+	leases := l.leases[ip.String()]
+	for n := len(leases) - 1; n >= 0; n-- {
+		if leases[n].valid(ts) {
+			return leases[n]
+		}
+	}
+	return nil
+}
+
+// iscTimeFormat is the format of dhcpd.leases time, after the weekday.
+const iscTimeFormat = "2006/01/02 15:04:05"
+
+// parseISCTime parses time of isc lease, e.g. "4 2021/03/04 10:00:00",
+// "epoch 1614852000" or "never".
+func parseISCTime(value string) (time.Time, error) {
+	fields := strings.Fields(value)
+	switch {
+	case len(fields) >= 1 && fields[0] == "never":
+		return time.Time{}, nil
+	case len(fields) >= 2 && fields[0] == "epoch":
+		sec, err := strconv.ParseInt(fields[1], 10, 64)
+		return time.Unix(sec, 0).UTC(), err
+	case len(fields) >= 3:
+		return time.Parse(iscTimeFormat, fields[1]+" "+fields[2])
+	}
+	return time.Time{}, fmt.Errorf("invalid lease time %s", value)
+}
+
+// parseISCLeases parses ISC dhcpd.leases file.
+func parseISCLeases(r io.Reader) ([]*Lease, error) {
+	var (
+		leases []*Lease
+		lease  *Lease
+	)
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if lease == nil {
+			if !strings.HasPrefix(line, "lease ") {
+				continue
+			}
+			fields := strings.Fields(line)
+			ip := net.ParseIP(fields[1])
+			if ip == nil {
+				return nil, fmt.Errorf("invalid lease ip %s", fields[1])
+			}
+			lease = &Lease{IP: ip}
+			continue
+		}
+
+		if line == "}" {
+			leases = append(leases, lease)
+			lease = nil
+			continue
+		}
+
+		line = strings.TrimSuffix(line, ";")
+		var err error
+		switch {
+		case strings.HasPrefix(line, "starts "):
+			lease.Starts, err = parseISCTime(strings.TrimPrefix(line, "starts "))
+		case strings.HasPrefix(line, "ends "):
+			lease.Ends, err = parseISCTime(strings.TrimPrefix(line, "ends "))
+		case strings.HasPrefix(line, "hardware ethernet "):
+			lease.MAC = strings.ToLower(strings.TrimPrefix(line, "hardware ethernet "))
+		case strings.HasPrefix(line, "client-hostname "):
+			lease.Hostname = strings.Trim(strings.TrimPrefix(line, "client-hostname "), `"`)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return leases, s.Err()
+}
+
+// parseDnsmasqLeases parses dnsmasq leases file, with lines:
+// expiry mac ip hostname client-id.
+func parseDnsmasqLeases(r io.Reader) ([]*Lease, error) {
+	var leases []*Lease
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		// skip empty lines and duid line
+		if len(fields) < 4 || fields[0] == "duid" {
+			continue
+		}
+
+		lease := &Lease{MAC: strings.ToLower(fields[1])}
+		if lease.IP = net.ParseIP(fields[2]); lease.IP == nil {
+			return nil, fmt.Errorf("invalid lease ip %s", fields[2])
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lease expiry %s", fields[0])
+		}
+		// zero expiry is infinite lease
+		if expiry > 0 {
+			lease.Ends = time.Unix(expiry, 0).UTC()
+		}
+		if fields[3] != "*" {
+			lease.Hostname = fields[3]
+		}
+		leases = append(leases, lease)
+	}
+	return leases, s.Err()
+}
@@ -0,0 +1,79 @@
+package enrich
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default reverse dns settings.
+const (
+	DefaultReverseDNSTimeout  = 2 * time.Second
+	DefaultReverseDNSCacheTTL = time.Hour
+)
+
+// reverseDNSCacheSize is the maximum number of cached names.
+const reverseDNSCacheSize = 65536
+
+type cachedName struct {
+	name    string
+	expires time.Time
+}
+
+// ReverseDNS resolves ip addresses to hostnames. Names, and also failed
+// lookups, are cached, so an address is resolved at most once per ttl.
+type ReverseDNS struct {
+	timeout  time.Duration
+	ttl      time.Duration
+	resolver *net.Resolver
+
+	mx    sync.Mutex
+	cache map[string]cachedName
+}
+
+// NewReverseDNS creates reverse dns resolver.
+func NewReverseDNS(timeout, ttl time.Duration) *ReverseDNS {
+	if timeout <= 0 {
+		timeout = DefaultReverseDNSTimeout
+	}
+	if ttl <= 0 {
+		ttl = DefaultReverseDNSCacheTTL
+	}
+	return &ReverseDNS{
+		timeout:  timeout,
+		ttl:      ttl,
+		resolver: net.DefaultResolver,
+		cache:    make(map[string]cachedName),
+	}
+}
+
+// Lookup returns hostname of the ip address, or empty string if it has none.
+func (r *ReverseDNS) Lookup(ip net.IP) string {
+	key := ip.String()
+	now := time.Now()
+
+	r.mx.Lock()
+	c, ok := r.cache[key]
+	r.mx.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.name
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.timeout)
+	defer cancel()
+
+	var name string
+	if names, err := r.resolver.LookupAddr(ctx, key); err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+
+	r.mx.Lock()
+	if len(r.cache) >= reverseDNSCacheSize {
+		r.cache = make(map[string]cachedName)
+	}
+	r.cache[key] = cachedName{name: name, expires: now.Add(r.ttl)}
+	r.mx.Unlock()
+	return name
+}
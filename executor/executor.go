@@ -5,12 +5,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"os/signal"
 	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -18,7 +22,10 @@ import (
 	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/config"
 	"github.com/alphasoc/nfr/elastic"
+	"github.com/alphasoc/nfr/enrich"
+	"github.com/alphasoc/nfr/gelf"
 	"github.com/alphasoc/nfr/groups"
+	"github.com/alphasoc/nfr/ioc"
 	"github.com/alphasoc/nfr/logs"
 	"github.com/alphasoc/nfr/logs/bro"
 	"github.com/alphasoc/nfr/logs/edge"
@@ -27,7 +34,12 @@ import (
 	"github.com/alphasoc/nfr/logs/suricata"
 	"github.com/alphasoc/nfr/logs/syslognamed"
 	"github.com/alphasoc/nfr/packet"
+	"github.com/alphasoc/nfr/pcapring"
+	"github.com/alphasoc/nfr/pdns"
+	"github.com/alphasoc/nfr/rotate"
 	"github.com/alphasoc/nfr/sniffer"
+	"github.com/alphasoc/nfr/store"
+	"github.com/alphasoc/nfr/syslog"
 	"github.com/alphasoc/nfr/utils"
 	"github.com/hpcloud/tail"
 )
@@ -40,6 +52,20 @@ type Executor struct {
 
 	alertsPoller *alerts.Poller
 
+	// ioc matches events with local indicators of compromise, if feeds are configured.
+	ioc *ioc.Engine
+
+	// pdns keeps names resolved to ip addresses, if passive dns is enabled.
+	// Records are saved only by Start, so other commands (e.g. read and replay)
+	// don't overwrite the file of running nfr.
+	pdns *pdns.Cache
+
+	// ring keeps recent sniffed packets, if pcap ring is enabled. It's used
+	// only by Start, as the ring files can't be shared with other commands.
+	ring *pcapring.Ring
+	// capture writes packets of alerts from the ring.
+	capture *pcapCapture
+
 	groups *groups.Groups
 
 	dnsbuf    *packet.DNSPacketBuffer
@@ -51,39 +77,309 @@ type Executor struct {
 	httpbuf    *packet.HTTPPacketBuffer
 	httpWriter *packet.Writer
 
-	sniffer sniffer.Sniffer
-	lr      logs.FileParser
+	// telemetry forwards events sent for analysis, if enabled.
+	telemetry *alerts.SplunkWriter
+
+	sniffers []*snifferInput
+	lr       logs.FileParser
 
 	// mutex for synchronize sending packets.
 	mx sync.Mutex
+	// senders are goroutines sending full buffers of packets.
+	senders sync.WaitGroup
+	// iocOnce starts ioc alerts processing once.
+	iocOnce sync.Once
 }
 
-func getFormatter(format string) alerts.Formatter {
-	var f alerts.Formatter
+// snifferInput is a network sniffer with its own packet filtering settings.
+type snifferInput struct {
+	cfg     *config.Sniffer
+	sniffer sniffer.Sniffer
 
+	// scope groups used to filter packets.
+	groups *groups.Groups
+	// home networks used to determine ip packets direction.
+	homeNetworks packet.Networks
+}
+
+// defaultBPFilter captures tcp and udp traffic, also when it's vlan tagged
+// (once or twice, as QinQ) or encapsulated in gre (ip protocol 47), so
+// tunnels can be decapsulated.
+const defaultBPFilter = "tcp or udp or proto 47 or (vlan and (tcp or udp or proto 47)) or " +
+	"(vlan and vlan and (tcp or udp or proto 47))"
+
+// getFormatter returns alerts formatter of the format, with CEF settings from the config.
+func getFormatter(cfg *config.Config, format string) (alerts.Formatter, error) {
 	switch format {
 	case "json":
-		f = alerts.FormatterJSON{}
+		return alerts.FormatterJSON{}, nil
 	case "cef":
-		f = alerts.NewFormatterCEF()
+		fields := make(map[string]alerts.CEFField, len(cfg.Outputs.CEF.Fields))
+		for name, field := range cfg.Outputs.CEF.Fields {
+			fields[name] = alerts.CEFField{Key: field.Key, Label: field.Label}
+		}
+		return alerts.NewFormatterCEFWithConfig(alerts.CEFConfig{
+			Vendor:  cfg.Outputs.CEF.Vendor,
+			Product: cfg.Outputs.CEF.Product,
+			Version: cfg.Outputs.CEF.Version,
+			Fields:  fields,
+		})
+	case "leef":
+		return alerts.NewFormatterLEEF(), nil
+	case "ocsf":
+		return alerts.NewFormatterOCSF(cfg.Outputs.OCSF.Class)
+	case "stix":
+		return alerts.NewFormatterSTIX(), nil
+	}
+	return nil, fmt.Errorf("invalid format %s", format)
+}
+
+// newEnricher creates alerts enricher from the config, or returns nil if no enrichment is enabled.
+// The passive dns cache is used for destination hostnames, if it's not nil.
+func newEnricher(cfg *config.Config, passiveDNS *pdns.Cache) (*enrich.Enricher, error) {
+	ecfg := &cfg.Outputs.Enrich
+	if !ecfg.ReverseDNS.Enabled && ecfg.DHCPLeases.File == "" && ecfg.Inventory.File == "" &&
+		len(ecfg.GeoIP.Files) == 0 && passiveDNS == nil {
+		return nil, nil
+	}
+
+	var (
+		enricher = enrich.Enricher{PassiveDNS: passiveDNS}
+		err      error
+	)
+	if ecfg.ReverseDNS.Enabled {
+		enricher.ReverseDNS = enrich.NewReverseDNS(ecfg.ReverseDNS.Timeout, ecfg.ReverseDNS.CacheTTL)
+	}
+	if ecfg.DHCPLeases.File != "" {
+		if enricher.Leases, err = enrich.NewLeases(ecfg.DHCPLeases.File, ecfg.DHCPLeases.Format); err != nil {
+			return nil, fmt.Errorf("load dhcp leases: %s", err)
+		}
+	}
+	if ecfg.Inventory.File != "" {
+		if enricher.Inventory, err = enrich.NewInventory(ecfg.Inventory.File); err != nil {
+			return nil, fmt.Errorf("load asset inventory: %s", err)
+		}
+	}
+	if len(ecfg.GeoIP.Files) > 0 {
+		if enricher.GeoIP, err = enrich.NewGeoIP(ecfg.GeoIP.Files...); err != nil {
+			return nil, fmt.Errorf("load geoip databases: %s", err)
+		}
+	}
+	return &enricher, nil
+}
+
+// newIOCEngine creates engine matching events with indicators of compromise
+// from the config, or returns nil if no feeds are configured.
+func newIOCEngine(cfg *config.Config) (*ioc.Engine, error) {
+	var feeds []ioc.Feed
+	for _, feed := range cfg.Engine.IOC.Feeds {
+		feeds = append(feeds, ioc.Feed{
+			Name:        feed.Name,
+			File:        feed.File,
+			Format:      feed.Format,
+			Type:        feed.Type,
+			Threat:      feed.Threat,
+			Severity:    feed.Severity,
+			Description: feed.Description,
+		})
+	}
+	if len(feeds) == 0 {
+		return nil, nil
+	}
+	engine, err := ioc.New(feeds)
+	if err != nil {
+		return nil, err
+	}
+	engine.SetDedupWindow(cfg.Engine.IOC.DedupWindow)
+	return engine, nil
+}
+
+// newFilter creates alerts filter from the config, or returns nil if it's empty.
+func newFilter(f *config.Filter) *alerts.Filter {
+	if f.IsEmpty() {
+		return nil
+	}
+	return &alerts.Filter{
+		MinSeverity:    f.MinSeverity,
+		Threats:        f.Threats,
+		ExcludeThreats: f.ExcludeThreats,
+		Policy:         f.Policy,
+		EventTypes:     f.EventTypes,
+		Groups:         f.Groups,
+		Flags:          f.Flags,
+	}
+}
+
+// newKafkaWriter creates kafka writer from the config.
+func newKafkaWriter(cfg *config.Config) (*alerts.KafkaWriter, error) {
+	kcfg := &cfg.Outputs.Kafka
+	format, err := getFormatter(cfg, kcfg.Format)
+	if err != nil {
+		return nil, fmt.Errorf("kafka output: %s", err)
+	}
+	tlsConfig, err := kcfg.TLS.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("kafka tls: %s", err)
+	}
+
+	key := kcfg.Key
+	if key == "none" {
+		key = ""
+	}
+	return alerts.NewKafkaWriter(alerts.KafkaConfig{
+		Brokers:       kcfg.Brokers,
+		Topic:         kcfg.Topic,
+		Key:           key,
+		Acks:          kcfg.Acks,
+		BatchSize:     kcfg.BatchSize,
+		Timeout:       kcfg.Timeout,
+		TLS:           tlsConfig,
+		SASLMechanism: kcfg.SASL.Mechanism,
+		Username:      kcfg.SASL.Username,
+		Password:      kcfg.SASL.Password,
+	}, format)
+}
+
+// telemetryMaxPending is the maximum number of forwarded events kept, when splunk fails.
+const telemetryMaxPending = 10000
+
+// newSplunkConfig creates splunk writer config from the config.
+func newSplunkConfig(cfg *config.Config) alerts.SplunkConfig {
+	return alerts.SplunkConfig{
+		URL:        cfg.Outputs.Splunk.URL,
+		Token:      cfg.Outputs.Splunk.Token,
+		Index:      cfg.Outputs.Splunk.Index,
+		Source:     cfg.Outputs.Splunk.Source,
+		SourceType: cfg.Outputs.Splunk.SourceType,
+		BatchSize:  cfg.Outputs.Splunk.BatchSize,
+		Gzip:       cfg.Outputs.Splunk.Gzip,
+		Timeout:    cfg.Outputs.Splunk.Timeout,
+	}
+}
+
+// newGraylogWriter creates graylog writer from the config.
+func newGraylogWriter(cfg *config.Config) (*alerts.GraylogWriter, error) {
+	gcfg := &cfg.Outputs.Graylog
+	tlsConfig, err := gcfg.TLS.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("graylog tls: %s", err)
 	}
+	return alerts.NewGraylogWriter(gcfg.URI, gcfg.Level, gelf.Config{
+		Compression: gcfg.Compression,
+		ChunkSize:   gcfg.ChunkSize,
+		TLS:         tlsConfig,
+	})
+}
 
-	return f
+// newSyslogWriter creates syslog writer from the config.
+func newSyslogWriter(cfg *config.Config) (*alerts.SyslogWriter, error) {
+	scfg := &cfg.Outputs.Syslog
+	format, err := getFormatter(cfg, scfg.Format)
+	if err != nil {
+		return nil, fmt.Errorf("syslog output: %s", err)
+	}
+	tlsConfig, err := scfg.TLS.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("syslog tls: %s", err)
+	}
+	facility, err := syslog.ParseFacility(scfg.Facility)
+	if err != nil {
+		return nil, fmt.Errorf("syslog output: %s", err)
+	}
+	return alerts.NewSyslogWriter(syslog.Config{
+		Network:  scfg.Proto,
+		Addr:     net.JoinHostPort(scfg.IP, strconv.Itoa(scfg.Port)),
+		TLS:      tlsConfig,
+		Framing:  scfg.Framing,
+		Facility: facility,
+		AppName:  scfg.AppName,
+	}, format)
 }
 
-// New creates new executor.
+// newWebhookWriter creates webhook writer from the config. Alerts are formatted
+// as ocsfClass events by the ocsf template.
+func newWebhookWriter(cfg *config.Webhook, ocsfClass string) (*alerts.WebhookWriter, error) {
+	text := alerts.WebhookTemplates["json"]
+	if cfg.Template != "" {
+		text = alerts.WebhookTemplates[cfg.Template]
+	}
+	if cfg.TemplateFile != "" {
+		b, err := ioutil.ReadFile(cfg.TemplateFile)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	tmpl, err := alerts.NewWebhookTemplate(text, ocsfClass)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %s", err)
+	}
+
+	retries := alerts.DefaultWebhookRetries
+	if cfg.Retries != nil {
+		retries = *cfg.Retries
+	}
+
+	return alerts.NewWebhookWriter(alerts.WebhookConfig{
+		URL:         cfg.URL,
+		Headers:     cfg.Headers,
+		Template:    tmpl,
+		ContentType: cfg.ContentType,
+		BatchSize:   cfg.BatchSize,
+		Retries:     retries,
+		Timeout:     cfg.Timeout,
+	})
+}
+
+// New creates new executor of nfr start.
 func New(c client.Client, cfg *config.Config) (*Executor, error) {
+	return newExecutor(c, cfg, false)
+}
+
+// NewOffline creates executor of commands, which may run next to nfr start,
+// e.g. read, replay and alerts fetch. Running nfr owns the state files, so
+// alerts queues and suppression state are kept only in memory, and alerts
+// are not stored. Close must be called at the end, to write pending alerts.
+func NewOffline(c client.Client, cfg *config.Config) (*Executor, error) {
+	return newExecutor(c, cfg, true)
+}
+
+func newExecutor(c client.Client, cfg *config.Config, offline bool) (*Executor, error) {
 	e := &Executor{
 		c:   c,
 		cfg: cfg,
 	}
 
-	groups, err := createGroups(cfg)
+	groups, err := createGroups(cfg, "")
 	if err != nil {
 		return nil, err
 	}
 	e.groups = groups
 
+	if pcfg := &cfg.Outputs.Enrich.PassiveDNS; pcfg.Enabled {
+		if err := os.MkdirAll(path.Dir(cfg.PassiveDNSFile()), 0755); err != nil {
+			return nil, err
+		}
+		e.pdns, err = pdns.New(cfg.PassiveDNSFile(), pdns.Config{
+			MaxAddresses: pcfg.MaxAddresses,
+			MaxNames:     pcfg.MaxNames,
+			Retention:    pcfg.Retention,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("passive dns: %s", err)
+		}
+		log.Infof("loaded passive dns records of %d addresses", e.pdns.Len())
+	}
+
+	if cfg.Outputs.Splunk.URL != "" && cfg.Outputs.Splunk.Telemetry {
+		// telemetry has its own batch, so it doesn't take alerts of the queue
+		scfg := newSplunkConfig(cfg)
+		scfg.MaxPending = telemetryMaxPending
+		if e.telemetry, err = alerts.NewSplunkWriter(scfg); err != nil {
+			return nil, err
+		}
+	}
+
 	if cfg.HasOutputs() {
 		log.Info("outputs enabled")
 		mapper := alerts.NewAlertMapper(groups)
@@ -92,40 +388,149 @@ func New(c client.Client, cfg *config.Config) (*Executor, error) {
 			return nil, err
 		}
 
-		if cfg.Outputs.File != "" {
-			format := getFormatter(cfg.Outputs.Format)
-			if format == nil {
-				return nil, fmt.Errorf("invalid output format: %s", cfg.Outputs.Format)
+		var queueDir string
+		if cfg.Outputs.Queue.Persist && !offline {
+			queueDir = cfg.Data.Dir
+		}
+		if err := e.alertsPoller.SetQueue(queueDir, cfg.Outputs.Queue.Size); err != nil {
+			return nil, err
+		}
+
+		enricher, err := newEnricher(cfg, e.pdns)
+		if err != nil {
+			return nil, err
+		}
+		if enricher != nil {
+			e.alertsPoller.SetEnricher(enricher)
+		}
+
+		if cfg.Outputs.Store.Enabled && !offline {
+			s, err := store.New(cfg.AlertsStoreFile(), cfg.Outputs.Store.Retention, cfg.Outputs.Store.MaxAlerts)
+			if err != nil {
+				return nil, fmt.Errorf("alerts store: %s", err)
+			}
+			e.alertsPoller.SetRecorder(s)
+		}
+
+		if cfg.Outputs.Suppress.Enabled {
+			var file string
+			if !offline {
+				if err := os.MkdirAll(cfg.Data.Dir, 0755); err != nil {
+					return nil, err
+				}
+				file = path.Join(cfg.Data.Dir, "alerts-suppress.json")
 			}
+			suppressor, err := alerts.NewSuppressor(cfg.Outputs.Suppress.Key, cfg.Outputs.Suppress.Window, file)
+			if err != nil {
+				return nil, err
+			}
+			e.alertsPoller.SetSuppressor(suppressor)
+		}
 
-			fileWriter, err := alerts.NewFileWriter(cfg.Outputs.File, format)
+		if cfg.Outputs.File != "" {
+			format, err := getFormatter(cfg, cfg.Outputs.Format)
+			if err != nil {
+				return nil, fmt.Errorf("file output: %s", err)
+			}
 
+			// only the daemon rotates the file
+			var rcfg rotate.Config
+			if !offline {
+				rcfg = cfg.Outputs.FileRotate.RotateConfig()
+			}
+			fileWriter, err := alerts.NewRotatedFileWriter(cfg.Outputs.File, format, rcfg)
 			if err != nil {
 				return nil, err
 			}
-			e.alertsPoller.AddWriter(fileWriter)
+			if err := e.alertsPoller.AddFilteredWriter(fileWriter, newFilter(&cfg.Outputs.FileFilter), cfg.Outputs.File); err != nil {
+				return nil, err
+			}
 		}
 
 		if cfg.Outputs.Graylog.URI != "" {
-			graylogWriter, err := alerts.NewGraylogWriter(cfg.Outputs.Graylog.URI, cfg.Outputs.Graylog.Level)
+			graylogWriter, err := newGraylogWriter(cfg)
 			if err != nil {
 				return nil, err
 			}
-			e.alertsPoller.AddWriter(graylogWriter)
+			if err := e.alertsPoller.AddFilteredWriter(graylogWriter, newFilter(&cfg.Outputs.Graylog.Filter), cfg.Outputs.Graylog.URI); err != nil {
+				return nil, err
+			}
 		}
 
 		if cfg.Outputs.Syslog.IP != "" {
-			addr := net.JoinHostPort(cfg.Outputs.Syslog.IP, strconv.FormatInt(int64(cfg.Outputs.Syslog.Port), 10))
-			format := getFormatter(cfg.Outputs.Syslog.Format)
-			if format == nil {
-				return nil, fmt.Errorf("invalid syslog format: %s", cfg.Outputs.Syslog.Format)
+			syslogWriter, err := newSyslogWriter(cfg)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.alertsPoller.AddFilteredWriter(syslogWriter, newFilter(&cfg.Outputs.Syslog.Filter),
+				fmt.Sprintf("%s:%d", cfg.Outputs.Syslog.IP, cfg.Outputs.Syslog.Port)); err != nil {
+				return nil, err
+			}
+		}
+
+		if cfg.Outputs.QRadar.IP != "" {
+			addr := net.JoinHostPort(cfg.Outputs.QRadar.IP, strconv.FormatInt(int64(cfg.Outputs.QRadar.Port), 10))
+			tlsConfig, err := cfg.Outputs.QRadar.TLS.ClientConfig()
+			if err != nil {
+				return nil, fmt.Errorf("qradar tls: %s", err)
+			}
+			qradarWriter, err := alerts.NewQRadarWriter(addr, tlsConfig)
+			if err != nil {
+				return nil, err
 			}
+			if err := e.alertsPoller.AddFilteredWriter(qradarWriter, newFilter(&cfg.Outputs.QRadar.Filter), addr); err != nil {
+				return nil, err
+			}
+		}
 
-			syslogWriter, err := alerts.NewSyslogWriter(cfg.Outputs.Syslog.Proto, addr, format)
+		if cfg.Outputs.Splunk.URL != "" {
+			splunkWriter, err := alerts.NewSplunkWriter(newSplunkConfig(cfg))
 			if err != nil {
 				return nil, err
 			}
-			e.alertsPoller.AddWriter(syslogWriter)
+			if err := e.alertsPoller.AddFilteredWriter(splunkWriter, newFilter(&cfg.Outputs.Splunk.Filter),
+				cfg.Outputs.Splunk.URL+" "+cfg.Outputs.Splunk.Index); err != nil {
+				return nil, err
+			}
+		}
+
+		if cfg.Outputs.Elastic.Enabled {
+			elasticWriter, err := alerts.NewElasticWriter(&cfg.Inputs.Elastic, cfg.Outputs.Elastic.Index, cfg.Outputs.Elastic.BatchSize)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.alertsPoller.AddFilteredWriter(elasticWriter, newFilter(&cfg.Outputs.Elastic.Filter),
+				cfg.Inputs.Elastic.CloudID+strings.Join(cfg.Inputs.Elastic.Hosts, ",")+" "+cfg.Outputs.Elastic.Index); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(cfg.Outputs.Kafka.Brokers) > 0 {
+			kafkaWriter, err := newKafkaWriter(cfg)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.alertsPoller.AddFilteredWriter(kafkaWriter, newFilter(&cfg.Outputs.Kafka.Filter),
+				strings.Join(cfg.Outputs.Kafka.Brokers, ",")+" "+cfg.Outputs.Kafka.Topic); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, webhook := range cfg.Outputs.Webhooks {
+			webhookWriter, err := newWebhookWriter(&webhook, cfg.Outputs.OCSF.Class)
+			if err != nil {
+				return nil, err
+			}
+			if err := e.alertsPoller.AddFilteredWriter(webhookWriter, newFilter(&webhook.Filter), webhook.URL); err != nil {
+				return nil, err
+			}
+		}
+
+		if e.ioc, err = newIOCEngine(cfg); err != nil {
+			return nil, err
+		}
+		if e.ioc != nil {
+			log.Infof("loaded %d indicators of compromise", e.ioc.Len())
 		}
 	}
 
@@ -136,7 +541,11 @@ func New(c client.Client, cfg *config.Config) (*Executor, error) {
 }
 
 // Start starts sniffer in online mode, where network alerts are sent to api.
+// It runs until interrupted or terminated.
 func (e *Executor) Start() (err error) {
+	if err := e.openPcapRing(); err != nil {
+		return err
+	}
 	e.init()
 	if e.cfg.Engine.Analyze.DNS || e.cfg.Engine.Analyze.IP {
 		e.monitor()
@@ -152,18 +561,33 @@ func (e *Executor) Start() (err error) {
 					return fmt.Errorf("can't open file %s for writing ip events: %s", e.cfg.IPEvents.Failed.File, err.(*net.OpError).Err)
 				}
 			}
-			log.Infof("creating the network sniffer on %s", e.cfg.Inputs.Sniffer.Interface)
-			e.sniffer, err = sniffer.NewLivePcapSniffer(e.cfg.Inputs.Sniffer.Interface, &sniffer.Config{
-				BPFilter: "tcp or udp",
-			})
-			if err != nil {
-				return fmt.Errorf("can't create the network sniffer: %s", err)
+			for _, scfg := range e.cfg.Sniffers() {
+				log.Infof("creating the network sniffer on %s", scfg.Interface)
+				if err := e.openSniffer(scfg); err != nil {
+					return fmt.Errorf("can't create the network sniffer on %s: %s", scfg.Interface, err)
+				}
 			}
-			log.Infof("starting the network sniffer on %s", e.cfg.Inputs.Sniffer.Interface)
-			e.do()
 		}
 	}
 
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	return e.run(stop)
+}
+
+// run processes packets of sniffers and elastic input until stop signal is
+// received. Then it stops the inputs, sends events left in the buffers,
+// and closes the outputs, so pending alerts and the state are not lost.
+func (e *Executor) run(stop <-chan os.Signal) error {
+	sniffed := make(chan struct{})
+	go func() {
+		defer close(sniffed)
+		if len(e.sniffers) > 0 {
+			e.do()
+		}
+	}()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	wg := &sync.WaitGroup{}
 
@@ -171,16 +595,83 @@ func (e *Executor) Start() (err error) {
 		e.startElastic(ctx, wg)
 	}
 
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
+	sig := <-stop
+	log.Infof("%s received, stopping", sig)
 
 	cancel()
+	for _, s := range e.sniffers {
+		s.sniffer.Close()
+	}
+	<-sniffed
 	wg.Wait()
+	e.writeFailedPackets()
+
+	e.Close()
+	e.savePassiveDNS()
+	e.closePcapRing()
+	return nil
+}
+
+// Close processes pending alerts and closes alerts outputs.
+func (e *Executor) Close() {
+	if e.telemetry != nil {
+		e.flushTelemetry()
+	}
+	if e.alertsPoller == nil {
+		return
+	}
+	if err := e.alertsPoller.Close(); err != nil {
+		log.Errorf("closing alerts outputs failed: %s", err)
+	}
+}
 
+// openSniffer creates the network sniffer using configured capture method.
+func (e *Executor) openSniffer(scfg *config.Sniffer) error {
+	s, err := e.newSnifferInput(scfg)
+	if err != nil {
+		return err
+	}
+
+	cfg := &sniffer.Config{
+		BPFilter:    scfg.BPFilter,
+		Snaplen:     scfg.Snaplen,
+		Promiscuous: scfg.Promiscuous,
+		BufferSize:  scfg.BufferSize << 20,
+		BlockSize:   scfg.BlockSize << 10,
+		Fanout:      scfg.Fanout,
+	}
+	if cfg.BPFilter == "" {
+		cfg.BPFilter = defaultBPFilter
+	}
+
+	switch scfg.Capture {
+	case "afpacket":
+		s.sniffer, err = sniffer.NewAFPacketSniffer(scfg.Interface, cfg)
+	default:
+		s.sniffer, err = sniffer.NewLivePcapSniffer(scfg.Interface, cfg)
+	}
+	if err != nil {
+		return err
+	}
+
+	e.sniffers = append(e.sniffers, s)
 	return nil
 }
 
+// newSnifferInput creates sniffer input with packet filtering settings from sniffer config.
+func (e *Executor) newSnifferInput(scfg *config.Sniffer) (s *snifferInput, err error) {
+	s = &snifferInput{cfg: scfg, groups: e.groups}
+	if scfg.ScopeGroup != "" {
+		if s.groups, err = createGroups(e.cfg, scfg.ScopeGroup); err != nil {
+			return nil, err
+		}
+	}
+	if s.homeNetworks, err = packet.NewNetworks(e.cfg.HomeNetworks(scfg)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
 	cfg := &e.cfg.Inputs.Elastic
 	for searchIdx, search := range cfg.Searches {
@@ -269,6 +760,7 @@ func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
 									log.Debugf("event: %+v", entry)
 								}
 
+								e.matchIOCDNS(entry)
 								if _, ok := e.groups.IsDNSQueryWhitelisted(entry.Query, entry.SrcIP, nil); ok {
 									req.Entries = append(req.Entries, entry)
 								}
@@ -300,6 +792,7 @@ func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
 									log.Debugf("event: %+v", entry)
 								}
 
+								e.matchIOCIP(entry, false)
 								if _, ok := e.groups.IsIPWhitelisted(entry.SrcIP, entry.DstIP); ok {
 									req.Entries = append(req.Entries, entry)
 								}
@@ -308,6 +801,7 @@ func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
 							// Send events to the API
 							inglog := log.WithField("lastIngested", cur.NewestIngested())
 							if len(req.Entries) > 0 {
+								e.setDestHosts(req)
 								resp, err := asoclient.EventsIP(req)
 								if err != nil {
 									log.Errorf("sending dns events: %v", err)
@@ -331,6 +825,7 @@ func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
 									log.Debugf("event: %+v", entry)
 								}
 
+								e.matchIOCHTTP(entry)
 								if _, ok := e.groups.IsHTTPQueryWhitelisted(entry.URL, entry.SrcIP); ok {
 									entries = append(entries, entry)
 								}
@@ -372,6 +867,7 @@ func (e *Executor) startElastic(ctx context.Context, wg *sync.WaitGroup) error {
 
 // Send sends dns events from given format file to engine.
 func (e *Executor) Send(file, fileFormat, fileType string) error {
+	e.startIOC()
 	if fileType == "all" {
 		for _, ft := range []string{"dns", "ip", "http"} {
 			if err := e.sendOne(file, fileFormat, ft); err != nil {
@@ -384,6 +880,48 @@ func (e *Executor) Send(file, fileFormat, fileType string) error {
 	return e.sendOne(file, fileFormat, fileType)
 }
 
+// Replay reads packets from pcap or pcapng file and processes them the same way
+// as packets captured by sniffer. If speed is greater than 0, then packets are
+// replayed with their original timing, shortened by speed multiplier.
+func (e *Executor) Replay(file string, speed float64) error {
+	// use settings of the sniffer section, but process packets in order
+	scfg := e.cfg.Inputs.Sniffer.Sniffer
+	scfg.Interface = file
+	scfg.Fanout = 1
+
+	s, err := e.newSnifferInput(&scfg)
+	if err != nil {
+		return err
+	}
+
+	bpfilter := scfg.BPFilter
+	if bpfilter == "" {
+		bpfilter = defaultBPFilter
+	}
+	ps, err := sniffer.NewOfflinePcapSniffer(file, &sniffer.Config{
+		BPFilter: bpfilter,
+		Speed:    speed,
+	})
+	if err != nil {
+		return err
+	}
+	defer ps.Close()
+	s.sniffer = ps
+
+	e.sniffers = []*snifferInput{s}
+	e.startIOC()
+	return e.do()
+}
+
+// FetchAlerts fetches alerts of events between after and before time, and
+// writes them to the outputs, or to all configured outputs if it's empty.
+func (e *Executor) FetchAlerts(after, before time.Time, outputs []string) (int, error) {
+	if e.alertsPoller == nil {
+		return 0, fmt.Errorf("no outputs configured")
+	}
+	return e.alertsPoller.Fetch(after, before, outputs)
+}
+
 func (e *Executor) sendOne(file, fileFormat, fileType string) error {
 	if err := e.openFileParser(file, fileFormat); err != nil {
 		return err
@@ -452,7 +990,8 @@ func (e *Executor) monitor() {
 							continue
 						}
 
-						if !e.shouldSendIPPacket(ippacket) {
+						e.matchIOCIPPacket(ippacket)
+						if !shouldSendIPPacket(e.groups, ippacket) {
 							continue
 						}
 
@@ -465,6 +1004,7 @@ func (e *Executor) monitor() {
 						}
 					}
 				case "dns":
+					e.addPassiveDNSLine(parser, line.Text)
 					if e.cfg.Engine.Analyze.DNS {
 						dnspacket, err := parser.ParseLineDNS(line.Text)
 						if err != nil {
@@ -477,7 +1017,8 @@ func (e *Executor) monitor() {
 							continue
 						}
 
-						if !e.shouldSendDNSPacket(dnspacket) {
+						e.matchIOCDNSPacket(dnspacket)
+						if !shouldSendDNSPacket(e.groups, dnspacket) {
 							continue
 						}
 						e.mx.Lock()
@@ -502,6 +1043,7 @@ func (e *Executor) monitor() {
 							continue
 						}
 
+						e.matchIOCHTTP(dnspacket)
 						if !e.shouldSendHTTPPacket(dnspacket) {
 							continue
 						}
@@ -522,10 +1064,11 @@ func (e *Executor) monitor() {
 
 // init initialize executor.
 func (e *Executor) init() {
-	e.installSignalHandler()
 	if e.cfg.HasOutputs() {
 		e.startAlertPoller()
 	}
+	e.startIOC()
+	e.startPassiveDNS()
 	if e.cfg.HasInputs() {
 		e.startPacketSender()
 	}
@@ -544,7 +1087,8 @@ func (e *Executor) processDNSReader() error {
 	log.Infof("found %d dns packets", len(dnspackets))
 
 	for _, dnspacket := range dnspackets {
-		if !e.shouldSendDNSPacket(dnspacket) {
+		e.matchIOCDNSPacket(dnspacket)
+		if !shouldSendDNSPacket(e.groups, dnspacket) {
 			continue
 		}
 
@@ -571,7 +1115,8 @@ func (e *Executor) processIPReader() error {
 	log.Infof("found %d ip packets", len(ippackets))
 
 	for _, ippacket := range ippackets {
-		if !e.shouldSendIPPacket(ippacket) {
+		e.matchIOCIPPacket(ippacket)
+		if !shouldSendIPPacket(e.groups, ippacket) {
 			continue
 		}
 
@@ -598,6 +1143,7 @@ func (e *Executor) processHTTPReader() error {
 	log.Infof("found %d http packets", len(httppackets))
 
 	for _, httppacket := range httppackets {
+		e.matchIOCHTTP(httppacket)
 		if !e.shouldSendHTTPPacket(httppacket) {
 			continue
 		}
@@ -652,7 +1198,8 @@ func (e *Executor) sendDNSPackets() error {
 	}
 
 	log.Infof("sending %d dns events for analysis", len(packets))
-	resp, err := e.c.EventsDNS(dnsPacketsToRequest(packets))
+	req := dnsPacketsToRequest(packets)
+	resp, err := e.c.EventsDNS(req)
 	if err != nil {
 		log.Errorf("sending of %d dns events for analysis failed: %s", len(packets), err)
 
@@ -664,6 +1211,13 @@ func (e *Executor) sendDNSPackets() error {
 	}
 
 	log.Infof("%d of %d total dns events were successfully sent for analysis", resp.Accepted, resp.Received)
+
+	if e.telemetry != nil {
+		for _, entry := range req.Entries {
+			e.forwardTelemetry(entry.Timestamp, "nfr:dns", entry)
+		}
+		e.flushTelemetry()
+	}
 	return nil
 }
 
@@ -679,7 +1233,9 @@ func (e *Executor) sendIPPackets() error {
 	}
 
 	log.Infof("sending %d ip events for analysis", len(packets))
-	resp, err := e.c.EventsIP(ipPacketsToRequest(packets))
+	req := ipPacketsToRequest(packets)
+	e.setDestHosts(req)
+	resp, err := e.c.EventsIP(req)
 	if err != nil {
 		log.Errorf("sending %d ip events for analysis failed: %s", len(packets), err)
 
@@ -691,6 +1247,13 @@ func (e *Executor) sendIPPackets() error {
 	}
 
 	log.Infof("%d of %d total ip events were successfully sent for analysis", resp.Accepted, resp.Received)
+
+	if e.telemetry != nil {
+		for _, entry := range req.Entries {
+			e.forwardTelemetry(entry.Timestamp, "nfr:ip", entry)
+		}
+		e.flushTelemetry()
+	}
 	return nil
 }
 
@@ -718,27 +1281,97 @@ func (e *Executor) sendHTTPPackets() error {
 	}
 
 	log.Infof("%d of %d total http events were successfully sent for analysis", resp.Accepted, resp.Received)
+
+	if e.telemetry != nil {
+		for _, entry := range packets {
+			e.forwardTelemetry(entry.Timestamp, "nfr:http", entry)
+		}
+		e.flushTelemetry()
+	}
 	return nil
 }
 
-// do retrives packets from sniffer, filter it and send to api.
+// forwardTelemetry forwards network event sent for analysis.
+// Errors are only logged, as events were already sent for analysis.
+func (e *Executor) forwardTelemetry(ts time.Time, sourceType string, event interface{}) {
+	if err := e.telemetry.WriteTelemetry(ts, sourceType, event); err != nil {
+		log.Errorf("forwarding events failed: %s", err)
+	}
+}
+
+// flushTelemetry sends forwarded events left in the batch.
+func (e *Executor) flushTelemetry() {
+	if err := e.telemetry.Flush(); err != nil {
+		log.Errorf("forwarding events failed: %s", err)
+	}
+}
+
+// do retrives packets from sniffers, filter it and send to api.
+// Packets of each sniffer are processed by as many goroutines as sniffer fanout.
+// It returns the error of sending packets left in the buffers, which include
+// packets failed to be sent before.
 func (e *Executor) do() error {
-	for rawpacket := range e.sniffer.Packets() {
+	done := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for _, s := range e.sniffers {
+		log.Infof("starting the network sniffer on %s", s.cfg.Interface)
+		go e.logSnifferStats(s, done)
+
+		for i := 0; i < s.cfg.Fanout; i++ {
+			wg.Add(1)
+			go func(s *snifferInput) {
+				defer wg.Done()
+				e.processPackets(s)
+			}(s)
+		}
+	}
+	wg.Wait()
+	close(done)
+
+	// wait for other gorutines to finish
+	// and send what left in the buffer
+	e.senders.Wait()
+	dnsErr := e.sendDNSPackets()
+	ipErr := e.sendIPPackets()
+	if dnsErr != nil {
+		return dnsErr
+	}
+	return ipErr
+}
+
+// processPackets reads packets from sniffer and writes them to buffers.
+func (e *Executor) processPackets(s *snifferInput) {
+	for rawpacket := range s.sniffer.Packets() {
+		if e.pdns != nil {
+			e.addPassiveDNS(packet.NewDNSAnswers(rawpacket))
+		}
+		if e.ring != nil {
+			if err := e.ring.Write(rawpacket); err != nil {
+				log.Errorf("writing packet to pcap ring failed: %s", err)
+			}
+		}
+
 		if e.cfg.Engine.Analyze.IP {
 			ippacket := packet.NewIPPacket(rawpacket)
 			if ippacket == nil {
 				continue
 			}
 
-			ippacket.DetermineDirection(e.cfg.Inputs.Sniffer.HardwareAddr)
+			if s.cfg.Direction == "mac" {
+				ippacket.DetermineDirection(s.cfg.HardwareAddr)
+			} else {
+				ippacket.DetermineDirectionByNetworks(s.homeNetworks)
+			}
 
-			if e.shouldSendIPPacket(ippacket) {
+			e.matchIOCIPPacket(ippacket)
+			if shouldSendIPPacket(s.groups, ippacket) {
 				e.mx.Lock()
 				e.ipbuf.Write(ippacket)
 				l := e.ipbuf.Len()
 				e.mx.Unlock()
 				if l >= e.cfg.IPEvents.BufferSize {
-					go e.sendIPPackets()
+					e.sendAsync(e.sendIPPackets)
 				}
 			}
 		}
@@ -749,37 +1382,73 @@ func (e *Executor) do() error {
 				continue
 			}
 
-			if e.shouldSendDNSPacket(dnspacket) {
+			e.matchIOCDNSPacket(dnspacket)
+			if shouldSendDNSPacket(s.groups, dnspacket) {
 				e.mx.Lock()
 				e.dnsbuf.Write(dnspacket)
 				l := e.dnsbuf.Len()
 				e.mx.Unlock()
 				if l >= e.cfg.DNSEvents.BufferSize {
 					// do not wait for sending packets
-					go e.sendDNSPackets()
+					e.sendAsync(e.sendDNSPackets)
 				}
 			}
 		}
 	}
+}
 
-	// send what left in the buffer and
-	// wait for other gorutines to finish
-	e.sendDNSPackets()
-	e.sendIPPackets()
-	return nil
+// sendAsync sends packets in a new goroutine, which do waits for before it returns.
+func (e *Executor) sendAsync(send func() error) {
+	e.senders.Add(1)
+	go func() {
+		defer e.senders.Done()
+		send()
+	}()
+}
+
+// snifferStatsInterval is how often sniffer capture statistics are logged.
+const snifferStatsInterval = time.Minute
+
+// logSnifferStats periodically logs sniffer statistics until done is closed.
+func (e *Executor) logSnifferStats(s *snifferInput, done chan struct{}) {
+	ticker := time.NewTicker(snifferStatsInterval)
+	defer ticker.Stop()
+
+	var last sniffer.Stats
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		stats, err := s.sniffer.Stats()
+		if err != nil {
+			log.Debugf("can't get sniffer statistics on %s: %s", s.cfg.Interface, err)
+			continue
+		}
+		received, dropped := stats.Received-last.Received, stats.Dropped-last.Dropped
+		if dropped > 0 || stats.IfDropped > last.IfDropped {
+			log.Warnf("sniffer on %s dropped %d of %d packets (%d dropped by interface)",
+				s.cfg.Interface, dropped, received, stats.IfDropped-last.IfDropped)
+		} else {
+			log.Debugf("sniffer on %s received %d packets", s.cfg.Interface, received)
+		}
+		last = *stats
+	}
 }
 
 // shouldSendIPPacket testdns if ip packet should be send to channel
-func (e *Executor) shouldSendIPPacket(p *packet.IPPacket) bool {
+func shouldSendIPPacket(gr *groups.Groups, p *packet.IPPacket) bool {
 	if (p.Direction == packet.DirectionOut && utils.IsSpecialIP(p.DstIP)) ||
 		(p.Direction == packet.DirectionIn && utils.IsSpecialIP(p.SrcIP)) {
 		return false
 	}
 	// no scope groups configured
-	if e.groups == nil {
+	if gr == nil {
 		return true
 	}
-	name, t := e.groups.IsIPWhitelisted(p.SrcIP, p.DstIP)
+	name, t := gr.IsIPWhitelisted(p.SrcIP, p.DstIP)
 	if !t {
 		log.Debugf("ip packet from %s to %s excluded by %s group", p.SrcIP, p.DstIP, name)
 	}
@@ -787,14 +1456,14 @@ func (e *Executor) shouldSendIPPacket(p *packet.IPPacket) bool {
 }
 
 // shouldSendDNSPackets tests if dns packet should be send to channel
-func (e *Executor) shouldSendDNSPacket(p *packet.DNSPacket) bool {
+func shouldSendDNSPacket(gr *groups.Groups, p *packet.DNSPacket) bool {
 	// no scope groups configured
-	if e.groups == nil {
+	if gr == nil {
 		return true
 	}
 
 	// do not consider to what server dns packets was sent, thus dst ip == nil
-	name, t := e.groups.IsDNSQueryWhitelisted(p.FQDN, p.SrcIP, nil)
+	name, t := gr.IsDNSQueryWhitelisted(p.FQDN, p.SrcIP, nil)
 	if !t {
 		log.Debugf("dns query %s excluded by %s group", p, name)
 	}
@@ -814,6 +1483,310 @@ func (e *Executor) shouldSendHTTPPacket(p *client.HTTPEntry) bool {
 	return t
 }
 
+// startIOC starts processing alerts of events matched with indicators of
+// compromise, and periodically reloads changed feed files.
+func (e *Executor) startIOC() {
+	if e.ioc == nil {
+		return
+	}
+	e.iocOnce.Do(func() {
+		go func() {
+			for {
+				if err := e.alertsPoller.DoLocal(); err != nil {
+					log.Errorf("processing ioc alerts failed: %s", err)
+				}
+			}
+		}()
+		go func() {
+			for range time.NewTicker(e.cfg.Engine.IOC.ReloadInterval).C {
+				reloaded, err := e.ioc.Reload()
+				if err != nil {
+					log.Errorf("reload ioc feeds: %s", err)
+				}
+				if reloaded {
+					log.Infof("reloaded ioc feeds with %d indicators", e.ioc.Len())
+				}
+			}
+		}()
+	})
+}
+
+// matchIOCDNS matches dns event with indicators of compromise, before
+// it's filtered by scope, and pushes alert of the match to outputs.
+func (e *Executor) matchIOCDNS(entry *client.DNSEntry) {
+	if e.ioc == nil {
+		return
+	}
+	e.pushIOC(client.EventTypeDNS, &client.EventUnified{
+		Timestamp: entry.Timestamp,
+		SrcIP:     entry.SrcIP,
+		Query:     entry.Query,
+		QueryType: entry.QType,
+	})
+}
+
+// matchIOCIP matches ip event with indicators of compromise, before
+// it's filtered by scope, and pushes alert of the match to outputs.
+// Internal is set for traffic between two home networks.
+func (e *Executor) matchIOCIP(entry *client.IPEntry, internal bool) {
+	if e.ioc == nil {
+		return
+	}
+	e.pushIOC(client.EventTypeIP, &client.EventUnified{
+		Timestamp: entry.Timestamp,
+		SrcIP:     entry.SrcIP,
+		SrcPort:   uint16(entry.SrcPort),
+		DestIP:    entry.DstIP,
+		DestPort:  uint16(entry.DstPort),
+		Proto:     entry.Protocol,
+		BytesIn:   int64(entry.BytesIn),
+		BytesOut:  int64(entry.BytesOut),
+		Ja3:       entry.Ja3,
+		Internal:  internal,
+	})
+}
+
+// matchIOCHTTP matches http event with indicators of compromise, before
+// it's filtered by scope, and pushes alert of the match to outputs.
+func (e *Executor) matchIOCHTTP(entry *client.HTTPEntry) {
+	if e.ioc == nil {
+		return
+	}
+	e.pushIOC(client.EventTypeHTTP, &client.EventUnified{
+		Timestamp:   entry.Timestamp,
+		SrcIP:       entry.SrcIP,
+		SrcPort:     entry.SrcPort,
+		BytesIn:     entry.BytesIn,
+		BytesOut:    entry.BytesOut,
+		URL:         entry.URL,
+		Method:      entry.Method,
+		Status:      int32(entry.Status),
+		Action:      entry.Action,
+		ContentType: entry.ContentType,
+		Referrer:    entry.Referrer,
+		UserAgent:   entry.UserAgent,
+	})
+}
+
+// matchIOCDNSPacket matches dns packet with indicators of compromise.
+func (e *Executor) matchIOCDNSPacket(p *packet.DNSPacket) {
+	if e.ioc != nil {
+		e.matchIOCDNS(dnsPacketToEntry(p))
+	}
+}
+
+// matchIOCIPPacket matches ip packet with indicators of compromise.
+func (e *Executor) matchIOCIPPacket(p *packet.IPPacket) {
+	if e.ioc != nil {
+		e.matchIOCIP(ipPacketToEntry(p), p.Direction == packet.DirectionInternal)
+	}
+}
+
+// pushIOC pushes alert of the event to outputs, if it matches indicators of compromise.
+func (e *Executor) pushIOC(eventType client.EventType, ev *client.EventUnified) {
+	alert := e.ioc.Match(eventType, ev)
+	if alert == nil {
+		return
+	}
+	if !e.alertsPoller.Push(alert) {
+		log.Warnf("ioc alert of %s event dropped, too many alerts pending", eventType)
+	}
+}
+
+// pcapCapture writes packets of alerts source from the pcap ring to files.
+type pcapCapture struct {
+	ring   *pcapring.Ring
+	dir    string
+	before time.Duration
+	after  time.Duration
+
+	mx sync.Mutex
+	// pending files, written when packets after the alert are captured.
+	pending map[string]*pcapExtract
+	wg      sync.WaitGroup
+}
+
+// pcapExtract is packets of the host in the time range, written to file.
+type pcapExtract struct {
+	ip       net.IP
+	from, to time.Time
+	timer    *time.Timer
+}
+
+// Capture implements alerts.Capture interface. Packets of the event source
+// are written to a file named by the event time and source ip, if the ring
+// has its packets. The file is written asynchronously, after packets following
+// the event are captured, and it's reused for other alerts of the event.
+func (c *pcapCapture) Capture(ev *alerts.Event) string {
+	if ev.SrcIP == nil || ev.Timestamp.IsZero() {
+		return ""
+	}
+
+	name := fmt.Sprintf("%s-%s.pcap", ev.Timestamp.UTC().Format("20060102T150405"),
+		strings.Replace(ev.SrcIP.String(), ":", "_", -1))
+	file := filepath.Join(c.dir, name)
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	if _, ok := c.pending[file]; ok {
+		return file
+	}
+	if _, err := os.Stat(file); err == nil {
+		return file
+	}
+
+	x := &pcapExtract{ip: ev.SrcIP, from: ev.Timestamp.Add(-c.before), to: ev.Timestamp.Add(c.after)}
+	if !c.ring.Has(x.ip, x.from, x.to) {
+		return ""
+	}
+	c.wg.Add(1)
+	x.timer = time.AfterFunc(time.Until(x.to), func() { c.extract(file, x) })
+	c.pending[file] = x
+	return file
+}
+
+// extract writes packets to the pending file.
+func (c *pcapCapture) extract(file string, x *pcapExtract) {
+	defer c.wg.Done()
+
+	n, err := c.ring.Extract(x.ip, x.from, x.to, file)
+	if err != nil {
+		log.Errorf("writing packets of %s alert to pcap file failed: %s", x.ip, err)
+	} else if n == 0 {
+		log.Warnf("no packets of %s alert left in pcap ring for %s", x.ip, file)
+	} else {
+		log.Debugf("%d packets of %s alert written to %s", n, x.ip, file)
+	}
+
+	c.mx.Lock()
+	delete(c.pending, file)
+	c.mx.Unlock()
+}
+
+// close writes pending files with packets captured so far.
+func (c *pcapCapture) close() {
+	c.mx.Lock()
+	pending := make(map[string]*pcapExtract)
+	for file, x := range c.pending {
+		if x.timer.Stop() {
+			pending[file] = x
+		}
+	}
+	c.mx.Unlock()
+
+	for file, x := range pending {
+		c.extract(file, x)
+	}
+	c.wg.Wait()
+}
+
+// openPcapRing opens the pcap ring and sets capture of alerts packets, if enabled.
+func (e *Executor) openPcapRing() error {
+	rcfg := &e.cfg.Inputs.PcapRing
+	if !rcfg.Enabled {
+		return nil
+	}
+
+	ring, err := pcapring.New(e.cfg.PcapRingDir(), pcapring.Config{
+		MaxSize:         int64(rcfg.MaxSize) * 1024 * 1024,
+		MaxAge:          rcfg.MaxAge,
+		SegmentSize:     int64(rcfg.SegmentSize) * 1024 * 1024,
+		SegmentInterval: rcfg.SegmentInterval,
+	})
+	if err != nil {
+		return fmt.Errorf("pcap ring: %s", err)
+	}
+	if err := os.MkdirAll(e.cfg.PcapAlertsDir(), 0755); err != nil {
+		ring.Close()
+		return err
+	}
+	e.ring = ring
+
+	if e.alertsPoller != nil {
+		e.capture = &pcapCapture{
+			ring:    ring,
+			dir:     e.cfg.PcapAlertsDir(),
+			before:  rcfg.Before,
+			after:   rcfg.After,
+			pending: make(map[string]*pcapExtract),
+		}
+		e.alertsPoller.SetCapture(e.capture)
+	}
+	return nil
+}
+
+// closePcapRing writes pending packets of alerts and closes the pcap ring, if enabled.
+func (e *Executor) closePcapRing() {
+	if e.ring == nil {
+		return
+	}
+	if e.capture != nil {
+		e.capture.close()
+	}
+	if err := e.ring.Close(); err != nil {
+		log.Errorf("closing pcap ring failed: %s", err)
+	}
+}
+
+// startPassiveDNS periodically saves passive dns records, if enabled.
+func (e *Executor) startPassiveDNS() {
+	if e.pdns == nil {
+		return
+	}
+	go func() {
+		for range time.NewTicker(e.cfg.Outputs.Enrich.PassiveDNS.SaveInterval).C {
+			e.savePassiveDNS()
+		}
+	}()
+}
+
+// savePassiveDNS saves passive dns records to the file, if enabled.
+func (e *Executor) savePassiveDNS() {
+	if e.pdns == nil {
+		return
+	}
+	if err := e.pdns.Save(); err != nil {
+		log.Errorf("saving passive dns records failed: %s", err)
+	}
+}
+
+// addPassiveDNS adds dns answers to passive dns records.
+func (e *Executor) addPassiveDNS(answers []packet.DNSAnswer) {
+	for _, answer := range answers {
+		e.pdns.Add(answer.Timestamp, answer.Name, answer.IP)
+	}
+}
+
+// addPassiveDNSLine adds dns answers of the log line to passive dns records,
+// if passive dns is enabled and the log format has answers.
+func (e *Executor) addPassiveDNSLine(parser logs.Parser, line string) {
+	if e.pdns == nil {
+		return
+	}
+	p, ok := parser.(logs.DNSAnswerParser)
+	if !ok {
+		return
+	}
+	answers, err := p.ParseLineDNSAnswers(line)
+	if err != nil {
+		// the line is also parsed as dns event, which logs the error
+		return
+	}
+	e.addPassiveDNS(answers)
+}
+
+// setDestHosts sets destination hosts of ip events from passive dns records.
+func (e *Executor) setDestHosts(req *client.EventsIPRequest) {
+	if e.pdns == nil {
+		return
+	}
+	for _, entry := range req.Entries {
+		if entry.DstHost == "" {
+			entry.DstHost = e.pdns.Name(entry.DstIP, entry.Timestamp)
+		}
+	}
+}
+
 // startAlertPoller periodcly checks for new alerts.
 func (e *Executor) startAlertPoller() {
 	log.Info("starting the polling mechanism to check for new alerts")
@@ -826,58 +1799,86 @@ func (e *Executor) startAlertPoller() {
 			}
 		}
 	}()
+	go e.logOutputsStats()
 }
 
-// installSignalHandler install os.Interrupt handler for writing alerts
-// into file if there are some in the buffer. If the dns/ip writer is
-// not configured, signal handler is not installed.
-func (e *Executor) installSignalHandler() {
-	// Unless writer is set, then no handler is needed
-	if e.dnsWriter == nil && e.ipWriter == nil {
-		return
-	}
+// outputsStatsInterval is how often outputs statistics are logged.
+const outputsStatsInterval = time.Minute
 
-	go func() {
-		c := make(chan os.Signal, 1)
-		signal.Notify(c, os.Interrupt)
-		<-c
-
-		dnspackets := e.dnsbuf.Packets()
-		if e.dnsWriter != nil && len(dnspackets) > 0 {
-			for i := range dnspackets {
-				if err := e.dnsWriter.Write(dnspackets[i]); err != nil {
-					log.Warnf("writing dns events to file failed: %s", err)
-					break
-				}
-			}
+// logOutputsStats periodically logs failures of alerts outputs and store.
+func (e *Executor) logOutputsStats() {
+	ticker := time.NewTicker(outputsStatsInterval)
+	defer ticker.Stop()
 
-			log.Infof("%d dns events written to file", len(dnspackets))
+	last, lastRecorder := e.alertsPoller.Stats(), e.alertsPoller.RecorderStats()
+	for range ticker.C {
+		recorder := e.alertsPoller.RecorderStats()
+		if failed := recorder.Failed - lastRecorder.Failed; failed > 0 {
+			log.Warnf("alerts store failed, %d alerts not recorded: %s", failed, recorder.LastError)
 		}
+		lastRecorder = recorder
+
+		stats := e.alertsPoller.Stats()
+		for n := range stats {
+			failed, dropped := stats[n].Failed-last[n].Failed, stats[n].Dropped-last[n].Dropped
+			if failed > 0 {
+				log.Warnf("alerts output %s failed %d times, %d alerts pending: %s",
+					stats[n].Name, failed, stats[n].Pending, stats[n].LastError)
+			}
+			if dropped > 0 {
+				log.Warnf("alerts output %s queue is full, %d alerts dropped", stats[n].Name, dropped)
+			}
+			if failed == 0 && dropped == 0 {
+				log.Debugf("alerts output %s written %d alerts, %d pending",
+					stats[n].Name, stats[n].Written-last[n].Written, stats[n].Pending)
+			}
+		}
+		last = stats
+	}
+}
 
-		ippackets := e.ipbuf.Packets()
-		if e.ipWriter != nil && len(ippackets) > 0 {
-			for i := range ippackets {
-				if err := e.ipWriter.Write(ippackets[i]); err != nil {
-					log.Warnf("writing ip events to file failed: %s", err)
-					break
-				}
+// writeFailedPackets writes events, which are left in the buffers after
+// sending failed, into files, if dns/ip writer is configured.
+func (e *Executor) writeFailedPackets() {
+	dnspackets := e.dnsbuf.Packets()
+	if e.dnsWriter != nil && len(dnspackets) > 0 {
+		for i := range dnspackets {
+			if err := e.dnsWriter.Write(dnspackets[i]); err != nil {
+				log.Warnf("writing dns events to file failed: %s", err)
+				break
 			}
+		}
+
+		log.Infof("%d dns events written to file", len(dnspackets))
+	}
 
-			log.Infof("%d ip events written to file", len(ippackets))
+	ippackets := e.ipbuf.Packets()
+	if e.ipWriter != nil && len(ippackets) > 0 {
+		for i := range ippackets {
+			if err := e.ipWriter.Write(ippackets[i]); err != nil {
+				log.Warnf("writing ip events to file failed: %s", err)
+				break
+			}
 		}
 
-		os.Exit(1)
-	}()
+		log.Infof("%d ip events written to file", len(ippackets))
+	}
 }
 
 // createGroups creates groups for matching packets.
-func createGroups(cfg *config.Config) (*groups.Groups, error) {
-	log.Infof("loaded %d groups containing monitoring scope data", len(cfg.ScopeConfig.Groups))
+// If only is not empty, then just the scope group with this name is used.
+func createGroups(cfg *config.Config, only string) (*groups.Groups, error) {
+	if only == "" {
+		log.Infof("loaded %d groups containing monitoring scope data", len(cfg.ScopeConfig.Groups))
+	}
 	if len(cfg.ScopeConfig.Groups) == 0 {
 		return nil, nil
 	}
 	gr := groups.New()
 	for name, group := range cfg.ScopeConfig.Groups {
+		if only != "" && name != only {
+			continue
+		}
 		g := &groups.Group{
 			Name:            name,
 			Label:           group.Label,
@@ -924,39 +1925,52 @@ func (e *Executor) openFileParser(file, fileFomrat string) (err error) {
 func ipPacketsToRequest(packets []*packet.IPPacket) *client.EventsIPRequest {
 	var req client.EventsIPRequest
 	for _, ippacket := range packets {
-		entry := &client.IPEntry{
-			Timestamp: ippacket.Timestamp,
-			SrcIP:     ippacket.SrcIP,
-			SrcPort:   ippacket.SrcPort,
-			DstIP:     ippacket.DstIP,
-			DstPort:   ippacket.DstPort,
-			Protocol:  ippacket.Protocol,
-			Ja3:       ippacket.Ja3,
-		}
-		switch ippacket.Direction {
-		case packet.DirectionIn:
-			entry.BytesIn = ippacket.BytesCount
-		case packet.DirectionOut:
-			entry.BytesOut = ippacket.BytesCount
-		default:
-			// If can't be determine the assumie it bytes out
-			entry.BytesOut = ippacket.BytesCount
-		}
-		req.Entries = append(req.Entries, entry)
+		req.Entries = append(req.Entries, ipPacketToEntry(ippacket))
 	}
 	return &req
 }
 
+// ipPacketToEntry changes ip packet to client ip entry.
+func ipPacketToEntry(ippacket *packet.IPPacket) *client.IPEntry {
+	entry := &client.IPEntry{
+		Timestamp: ippacket.Timestamp,
+		SrcIP:     ippacket.SrcIP,
+		SrcPort:   ippacket.SrcPort,
+		DstIP:     ippacket.DstIP,
+		DstPort:   ippacket.DstPort,
+		Protocol:  ippacket.Protocol,
+		Ja3:       ippacket.Ja3,
+	}
+	switch ippacket.Direction {
+	case packet.DirectionIn:
+		entry.BytesIn = ippacket.BytesCount
+	case packet.DirectionOut:
+		entry.BytesOut = ippacket.BytesCount
+	case packet.DirectionInternal:
+		// bytes are sent by the source, which is also a home host
+		entry.BytesOut = ippacket.BytesCount
+	default:
+		// If can't be determine the assumie it bytes out
+		entry.BytesOut = ippacket.BytesCount
+	}
+	return entry
+}
+
 // dnsPacketsToRequest changes dns packets to client dns request.
 func dnsPacketsToRequest(packets []*packet.DNSPacket) *client.EventsDNSRequest {
 	var req client.EventsDNSRequest
 	for _, dnspacket := range packets {
-		req.Entries = append(req.Entries, &client.DNSEntry{
-			Timestamp: dnspacket.Timestamp,
-			SrcIP:     dnspacket.SrcIP,
-			Query:     dnspacket.FQDN,
-			QType:     dnspacket.RecordType,
-		})
+		req.Entries = append(req.Entries, dnsPacketToEntry(dnspacket))
 	}
 	return &req
 }
+
+// dnsPacketToEntry changes dns packet to client dns entry.
+func dnsPacketToEntry(dnspacket *packet.DNSPacket) *client.DNSEntry {
+	return &client.DNSEntry{
+		Timestamp: dnspacket.Timestamp,
+		SrcIP:     dnspacket.SrcIP,
+		Query:     dnspacket.FQDN,
+		QType:     dnspacket.RecordType,
+	}
+}
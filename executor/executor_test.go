@@ -0,0 +1,199 @@
+package executor
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/config"
+	"github.com/alphasoc/nfr/packet"
+	"github.com/alphasoc/nfr/sniffer"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+func TestIPPacketToEntry(t *testing.T) {
+	for _, tt := range []struct {
+		direction         packet.Direction
+		bytesIn, bytesOut int
+	}{
+		{packet.DirectionIn, 100, 0},
+		{packet.DirectionOut, 0, 100},
+		{packet.DirectionInternal, 0, 100},
+		{packet.DirectionUnknown, 0, 100},
+	} {
+		entry := ipPacketToEntry(&packet.IPPacket{
+			SrcIP:      net.IPv4(10, 0, 0, 1),
+			DstIP:      net.IPv4(10, 0, 0, 2),
+			BytesCount: 100,
+			Direction:  tt.direction,
+		})
+		if entry.BytesIn != tt.bytesIn || entry.BytesOut != tt.bytesOut {
+			t.Fatalf("direction %v: invalid entry %+v", tt.direction, entry)
+		}
+	}
+}
+
+func TestDefaultBPFilter(t *testing.T) {
+	bpf, err := pcap.NewBPF(layers.LinkTypeEthernet, 65535, defaultBPFilter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolUDP,
+		SrcIP: net.IPv4(10, 0, 0, 1), DstIP: net.IPv4(10, 0, 0, 2)}
+	udp := &layers.UDP{SrcPort: 50000, DstPort: 53}
+	udp.SetNetworkLayerForChecksum(ip)
+	eth := &layers.Ethernet{
+		SrcMAC: net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC: net.HardwareAddr{0, 5, 4, 3, 2, 1},
+	}
+
+	for tags := 0; tags <= 2; tags++ {
+		ls := []gopacket.SerializableLayer{eth}
+		eth.EthernetType = layers.EthernetTypeIPv4
+		if tags > 0 {
+			eth.EthernetType = layers.EthernetTypeQinQ
+		}
+		for n := 1; n <= tags; n++ {
+			next := layers.EthernetTypeDot1Q
+			if n == tags {
+				next = layers.EthernetTypeIPv4
+			}
+			ls = append(ls, &layers.Dot1Q{VLANIdentifier: uint16(n), Type: next})
+		}
+		ls = append(ls, ip, udp, gopacket.Payload("test"))
+
+		buf := gopacket.NewSerializeBuffer()
+		if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ls...); err != nil {
+			t.Fatal(err)
+		}
+		ci := gopacket.CaptureInfo{CaptureLength: len(buf.Bytes()), Length: len(buf.Bytes())}
+		if !bpf.Matches(ci, buf.Bytes()) {
+			t.Fatalf("udp packet with %d vlan tags not matched", tags)
+		}
+	}
+}
+
+// liveSniffer is a sniffer, which captures no packets until it's closed.
+type liveSniffer struct {
+	once    sync.Once
+	packets chan gopacket.Packet
+}
+
+func (s *liveSniffer) Packets() chan gopacket.Packet { return s.packets }
+
+func (s *liveSniffer) Stats() (*sniffer.Stats, error) { return &sniffer.Stats{}, nil }
+
+func (s *liveSniffer) Close() { s.once.Do(func() { close(s.packets) }) }
+
+func TestRunStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-executor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var (
+		mx      sync.Mutex
+		written int
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body []interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		mx.Lock()
+		written += len(body)
+		mx.Unlock()
+	}))
+	defer srv.Close()
+
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Data.File = filepath.Join(dir, "nfr.data")
+	cfg.Data.Dir = dir
+	cfg.Outputs.File = ""
+	cfg.Outputs.Webhooks = []config.Webhook{{URL: srv.URL}}
+	// pending alerts of persistent queues are stored instead of written
+	cfg.Outputs.Queue.Persist = false
+	e, err := New(client.NewMock(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.sniffers = []*snifferInput{{
+		cfg:     &config.Sniffer{Interface: "test", Fanout: 1},
+		sniffer: &liveSniffer{packets: make(chan gopacket.Packet)},
+	}}
+	if !e.alertsPoller.Push(&alerts.Event{
+		EventType:    "ip",
+		Threats:      map[string]alerts.Threat{"ioc_local": {Severity: 4}},
+		EventUnified: client.EventUnified{Timestamp: time.Now(), SrcIP: net.IPv4(10, 0, 0, 1)},
+	}) {
+		t.Fatal("event dropped")
+	}
+
+	stop := make(chan os.Signal, 1)
+	stop <- os.Interrupt
+	done := make(chan error)
+	go func() { done <- e.run(stop) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run not stopped with live sniffer")
+	}
+
+	mx.Lock()
+	defer mx.Unlock()
+	if written != 1 {
+		t.Fatalf("got %d alerts written, expected 1", written)
+	}
+}
+
+// failingClient fails to send dns events.
+type failingClient struct {
+	client.Client
+}
+
+func (failingClient) EventsDNS(req *client.EventsDNSRequest) (*client.EventsDNSResponse, error) {
+	return nil, errors.New("service unavailable")
+}
+
+func TestDoSendFailed(t *testing.T) {
+	cfg, err := config.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := NewOffline(failingClient{client.NewMock()}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+
+	s := &liveSniffer{packets: make(chan gopacket.Packet)}
+	s.Close()
+	e.sniffers = []*snifferInput{{cfg: &config.Sniffer{Interface: "test", Fanout: 1}, sniffer: s}}
+	e.dnsbuf.Write(&packet.DNSPacket{
+		Timestamp:  time.Now(),
+		SrcIP:      net.IPv4(10, 0, 0, 1),
+		FQDN:       "example.com",
+		RecordType: "A",
+	})
+	if err := e.do(); err == nil {
+		t.Fatal("expected error of sending dns events")
+	}
+}
@@ -1,17 +1,49 @@
 package gelf
 
 import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/url"
 
 	"github.com/Jeffail/gabs"
 )
 
+// Default chunk size of udp messages, which fits in WAN packets.
+const DefaultChunkSize = 1420
+
+const (
+	// maxChunks is the maximum number of chunks of a message.
+	maxChunks = 128
+	// chunkHeaderSize is the size of magic bytes, message id, sequence number and count.
+	chunkHeaderSize = 12
+)
+
+// chunkMagic are the first bytes of chunked message.
+var chunkMagic = []byte{0x1e, 0x0f}
+
+// Config of GELF client.
+type Config struct {
+	// Compression of udp messages. Possible values are: none, gzip, zlib.
+	Compression string
+	// ChunkSize is the maximum size of udp datagram. Bigger messages are chunked.
+	ChunkSize int
+	// TLS config of tcp connection. If nil, then connection is not encrypted.
+	TLS *tls.Config
+}
+
 // Gelf client.
 type Gelf struct {
-	conn net.Conn
+	scheme string
+	addr   string
+	cfg    Config
+	conn   net.Conn
 }
 
 // Message for graylog server.
@@ -19,15 +51,22 @@ type Message struct {
 	Version      string `json:"version"`
 	Host         string `json:"host"`
 	ShortMessage string `json:"short_message"`
-	FullMessage  string `json:"full_message"`
-	Timestamp    int64  `json:"timestamp"`
-	Level        int    `json:"level"`
+	FullMessage  string `json:"full_message,omitempty"`
+	// Timestamp in seconds since epoch, with milliseconds precision.
+	Timestamp float64 `json:"timestamp"`
+	Level     int     `json:"level"`
 
 	Extra map[string]interface{} `json:"-"`
 }
 
 // New returns GELF client.
 func New(uri string) (*Gelf, error) {
+	return NewWithConfig(uri, Config{})
+}
+
+// NewWithConfig returns GELF client for udp or tcp uri, e.g. udp://graylog:12201.
+// It doesn't connect to the server, the connection is opened on first send.
+func NewWithConfig(uri string, cfg Config) (*Gelf, error) {
 	parsedURI, err := url.Parse(uri)
 	if err != nil {
 		return nil, err
@@ -40,39 +79,164 @@ func New(uri string) (*Gelf, error) {
 	if parsedURI.Scheme != "udp" && parsedURI.Scheme != "tcp" {
 		return nil, fmt.Errorf("unsupported scheme %s", parsedURI.Scheme)
 	}
+	if parsedURI.Scheme == "udp" && cfg.TLS != nil {
+		return nil, fmt.Errorf("tls is not supported over udp")
+	}
 
-	conn, err := net.Dial(parsedURI.Scheme, parsedURI.Host)
-	if err != nil {
-		return nil, err
+	switch cfg.Compression {
+	case "":
+		cfg.Compression = "none"
+	case "none", "gzip", "zlib":
+	default:
+		return nil, fmt.Errorf("unsupported compression %s", cfg.Compression)
+	}
+	if cfg.ChunkSize <= chunkHeaderSize {
+		cfg.ChunkSize = DefaultChunkSize
+	}
 
+	return &Gelf{scheme: parsedURI.Scheme, addr: parsedURI.Host, cfg: cfg}, nil
+}
+
+func (g *Gelf) dial() error {
+	var (
+		conn net.Conn
+		err  error
+	)
+	if g.cfg.TLS != nil {
+		conn, err = tls.Dial(g.scheme, g.addr, g.cfg.TLS)
+	} else {
+		conn, err = net.Dial(g.scheme, g.addr)
 	}
-	return &Gelf{conn: conn}, nil
+	if err != nil {
+		return err
+	}
+	g.conn = conn
+	return nil
 }
 
 // Close the connection to the server.
 func (g *Gelf) Close() error {
-	return g.conn.Close()
+	if g.conn == nil {
+		return nil
+	}
+	err := g.conn.Close()
+	g.conn = nil
+	return err
 }
 
-// Send message to the server.
-func (g *Gelf) Send(m *Message) error {
+// Marshal returns message in json format, with extra fields prefixed with underscore.
+func (m *Message) Marshal() ([]byte, error) {
 	b, err := json.Marshal(m)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	c, err := gabs.ParseJSON(b)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	for k, v := range m.Extra {
 		_, err = c.Set(v, fmt.Sprintf("_%s", k))
 		if err != nil {
+			return nil, err
+		}
+	}
+	return c.Bytes(), nil
+}
+
+// Send message to the server. Over udp the message is compressed and chunked,
+// and over tcp it's terminated with null byte. The connection is opened on
+// first send, and if writing fails, then it's reopened on next send.
+func (g *Gelf) Send(m *Message) error {
+	b, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if g.conn == nil {
+		if err := g.dial(); err != nil {
 			return err
 		}
 	}
 
-	_, err = g.conn.Write(append(c.Bytes(), '\n', 0))
-	return err
+	if g.scheme == "tcp" {
+		if _, err = g.conn.Write(append(b, 0)); err != nil {
+			g.Close()
+		}
+		return err
+	}
+
+	if b, err = compress(b, g.cfg.Compression); err != nil {
+		return err
+	}
+	chunks, err := chunk(b, g.cfg.ChunkSize)
+	if err != nil {
+		return err
+	}
+	for _, c := range chunks {
+		if _, err := g.conn.Write(c); err != nil {
+			g.Close()
+			return err
+		}
+	}
+	return nil
+}
+
+// compress compresses message with gzip or zlib.
+func compress(b []byte, compression string) ([]byte, error) {
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+	)
+	switch compression {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "zlib":
+		w = zlib.NewWriter(&buf)
+	default:
+		return b, nil
+	}
+
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// chunk splits message into udp datagrams of at most size bytes.
+// If message fits in one datagram, then it's not chunked.
+func chunk(b []byte, size int) ([][]byte, error) {
+	if len(b) <= size {
+		return [][]byte{b}, nil
+	}
+
+	dataSize := size - chunkHeaderSize
+	count := (len(b) + dataSize - 1) / dataSize
+	if count > maxChunks {
+		return nil, fmt.Errorf("message too big: %d bytes in %d chunks", len(b), count)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, count)
+	for n := 0; n < count; n++ {
+		end := (n + 1) * dataSize
+		if end > len(b) {
+			end = len(b)
+		}
+		c := make([]byte, 0, chunkHeaderSize+end-n*dataSize)
+		c = append(c, chunkMagic...)
+		c = append(c, id...)
+		c = append(c, byte(n), byte(count))
+		c = append(c, b[n*dataSize:end]...)
+		chunks = append(chunks, c)
+	}
+	return chunks, nil
 }
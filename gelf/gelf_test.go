@@ -0,0 +1,176 @@
+package gelf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendUDPChunked(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	g, err := NewWithConfig("udp://"+conn.LocalAddr().String(), Config{Compression: "gzip", ChunkSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	// random-like message, so it's still chunked after compression
+	var full strings.Builder
+	for n := 0; n < 200; n++ {
+		full.WriteString(time.Duration(n * 7919).String())
+	}
+	m := &Message{Version: "1.1", Host: "nfr", ShortMessage: "test", FullMessage: full.String(),
+		Timestamp: 1536242944.123, Extra: map[string]interface{}{"threat": "c2_communication"}}
+	if err := g.Send(m); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var (
+		chunks [][]byte
+		count  = -1
+	)
+	for count < 0 || len(chunks) < count {
+		buf := make([]byte, 200)
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := buf[:n]
+		if n > 100 {
+			t.Fatalf("chunk size %d exceeds 100", n)
+		}
+		if !bytes.Equal(c[:2], chunkMagic) {
+			t.Fatalf("invalid chunk magic %x", c[:2])
+		}
+		if count < 0 {
+			count = int(c[11])
+			chunks = make([][]byte, 0, count)
+		}
+		if len(chunks) > 0 && !bytes.Equal(c[2:10], chunks[0][2:10]) {
+			t.Fatalf("chunks with different message id")
+		}
+		if int(c[10]) != len(chunks) {
+			t.Fatalf("got chunk %d, expected %d", c[10], len(chunks))
+		}
+		chunks = append(chunks, c)
+	}
+	if count < 2 {
+		t.Fatalf("message not chunked")
+	}
+
+	var payload []byte
+	for _, c := range chunks {
+		payload = append(payload, c[chunkHeaderSize:]...)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["full_message"] != full.String() || got["_threat"] != "c2_communication" || got["timestamp"] != 1536242944.123 {
+		t.Fatalf("invalid message %s", b)
+	}
+}
+
+func TestChunkTooBig(t *testing.T) {
+	if _, err := chunk(make([]byte, 129*88), 100); err == nil {
+		t.Fatalf("expected error for message exceeding %d chunks", maxChunks)
+	}
+	chunks, err := chunk(make([]byte, 100), 100)
+	if err != nil || len(chunks) != 1 || len(chunks[0]) != 100 {
+		t.Fatalf("message fitting in one datagram must not be chunked")
+	}
+}
+
+func TestSendTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	g, err := NewWithConfig("tcp://"+l.Addr().String(), Config{Compression: "gzip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+
+	// connection is opened on first send
+	for _, s := range []string{"first", "second"} {
+		if err := g.Send(&Message{Version: "1.1", Host: "nfr", ShortMessage: s}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, s := range []string{"first", "second"} {
+		b, err := r.ReadBytes(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// tcp messages are not compressed and are delimited by null byte only
+		var m Message
+		if err := json.Unmarshal(b[:len(b)-1], &m); err != nil {
+			t.Fatalf("invalid message %q: %s", b, err)
+		}
+		if m.ShortMessage != s {
+			t.Fatalf("got message %s, expected %s", m.ShortMessage, s)
+		}
+	}
+}
+
+func TestNewWithConfigInvalid(t *testing.T) {
+	for _, uri := range []string{"http://127.0.0.1:12201", "udp://127.0.0.1"} {
+		if _, err := New(uri); err == nil {
+			t.Fatalf("expected error for %s", uri)
+		}
+	}
+	if _, err := NewWithConfig("udp://127.0.0.1:12201", Config{Compression: "lz4"}); err == nil {
+		t.Fatalf("expected error for unsupported compression")
+	}
+}
+
+func TestSendTCPUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	g, err := New("tcp://" + addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if err := g.Send(&Message{Version: "1.1", Host: "nfr", ShortMessage: "lost"}); err == nil {
+		t.Fatal("expected error for unreachable server")
+	}
+}
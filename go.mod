@@ -13,12 +13,16 @@ require (
 	github.com/google/gopacket v1.1.18-0.20190912173203-2d7fab0d91d6
 	github.com/hpcloud/tail v1.0.1-0.20170814160653-37f427138745
 	github.com/imdario/mergo v0.3.11
+	github.com/klauspost/compress v1.14.4 // indirect
+	github.com/oschwald/maxminddb-golang v1.3.1
 	github.com/pkg/errors v0.9.1
+	github.com/segmentio/kafka-go v0.4.30
 	github.com/spf13/cobra v1.1.1
-	github.com/stretchr/testify v1.4.0
+	github.com/stretchr/testify v1.6.1
 	github.com/twmb/murmur3 v1.1.5
 	github.com/valyala/fasthttp v1.21.0
 	github.com/xoebus/ceflog v0.0.0-20180302015320-9cb6ad8a040b
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/net v0.0.0-20201016165138-7b1cca2348c0
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
@@ -0,0 +1,168 @@
+package ioc
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// entry is an indicator of the feed.
+type entry struct {
+	feed *Feed
+	ind  Indicator
+}
+
+// netEntry is a network indicator of the feed.
+type netEntry struct {
+	net *net.IPNet
+	entry
+}
+
+// index of indicators by normalized value.
+type index struct {
+	len     int
+	domains map[string][]entry
+	ips     map[string][]entry
+	nets    []netEntry
+	urls    map[string][]entry
+	ja3     map[string][]entry
+}
+
+func newIndex() *index {
+	return &index{
+		domains: make(map[string][]entry),
+		ips:     make(map[string][]entry),
+		urls:    make(map[string][]entry),
+		ja3:     make(map[string][]entry),
+	}
+}
+
+// add adds indicator to the index. Invalid indicators are skipped.
+func (idx *index) add(feed *Feed, ind Indicator) {
+	e := entry{feed: feed, ind: ind}
+	switch ind.Type {
+	case TypeDomain:
+		name := normalizeDomain(ind.Value)
+		if name == "" {
+			return
+		}
+		idx.domains[name] = append(idx.domains[name], e)
+	case TypeIP:
+		if ip := net.ParseIP(ind.Value); ip != nil {
+			idx.ips[ip.String()] = append(idx.ips[ip.String()], e)
+		} else if _, ipnet, err := net.ParseCIDR(ind.Value); err == nil {
+			idx.nets = append(idx.nets, netEntry{net: ipnet, entry: e})
+		} else {
+			return
+		}
+	case TypeURL:
+		key := normalizeURL(ind.Value)
+		if key == "" {
+			return
+		}
+		idx.urls[key] = append(idx.urls[key], e)
+	case TypeJA3:
+		idx.ja3[strings.ToLower(ind.Value)] = append(idx.ja3[strings.ToLower(ind.Value)], e)
+	default:
+		return
+	}
+	idx.len++
+}
+
+// matches returns matches of the entries.
+func matches(entries []entry) []Match {
+	m := make([]Match, len(entries))
+	for n := range entries {
+		m[n] = Match{Feed: entries[n].feed, Indicator: entries[n].ind}
+	}
+	return m
+}
+
+func (idx *index) matchDomain(name string) []Match {
+	name = normalizeDomain(name)
+	var m []Match
+	for name != "" {
+		m = append(m, matches(idx.domains[name])...)
+		n := strings.IndexByte(name, '.')
+		if n < 0 {
+			break
+		}
+		name = name[n+1:]
+	}
+	return m
+}
+
+func (idx *index) matchIP(ip net.IP) []Match {
+	if ip == nil {
+		return nil
+	}
+	m := matches(idx.ips[ip.String()])
+	for _, e := range idx.nets {
+		if e.net.Contains(ip) {
+			m = append(m, Match{Feed: e.feed, Indicator: e.ind})
+		}
+	}
+	return m
+}
+
+func (idx *index) matchURL(rawurl string) []Match {
+	key := normalizeURL(rawurl)
+	if key == "" {
+		return nil
+	}
+	m := matches(idx.urls[key])
+	// url without query also matches
+	if n := strings.IndexByte(key, '?'); n >= 0 {
+		m = append(m, matches(idx.urls[key[:n]])...)
+	}
+
+	host := key
+	if n := strings.IndexByte(host, '/'); n >= 0 {
+		host = host[:n]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if ip := net.ParseIP(host); ip != nil {
+		return append(m, idx.matchIP(ip)...)
+	}
+	return append(m, idx.matchDomain(host)...)
+}
+
+func (idx *index) matchJA3(ja3 string) []Match {
+	return matches(idx.ja3[strings.ToLower(ja3)])
+}
+
+// normalizeDomain lowercases domain and trims trailing dot.
+func normalizeDomain(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// normalizeURL returns url without scheme and fragment, with lowercase host and
+// at least root path, e.g. example.com/path?q=1. Default ports are removed.
+func normalizeURL(rawurl string) string {
+	rawurl = strings.TrimSpace(rawurl)
+	if !strings.Contains(rawurl, "://") {
+		rawurl = "http://" + rawurl
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+
+	host := strings.ToLower(u.Host)
+	if (u.Scheme == "http" && strings.HasSuffix(host, ":80")) ||
+		(u.Scheme == "https" && strings.HasSuffix(host, ":443")) {
+		host = host[:strings.LastIndexByte(host, ':')]
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	key := host + path
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
@@ -0,0 +1,375 @@
+// Package ioc matches events with local indicators of compromise, loaded
+// from plain lists, csv files, MISP json exports and STIX 2.1 bundles.
+package ioc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/client"
+	"github.com/alphasoc/nfr/utils"
+)
+
+// Indicator types.
+const (
+	TypeDomain = "domain"
+	TypeIP     = "ip"
+	TypeURL    = "url"
+	TypeJA3    = "ja3"
+)
+
+// Feed formats.
+const (
+	FormatList = "list"
+	FormatCSV  = "csv"
+	FormatMISP = "misp"
+	FormatSTIX = "stix"
+)
+
+// DefaultSeverity is the severity of matches, if feed has none.
+const DefaultSeverity = 4
+
+// Flag added to alerts of local matches.
+const Flag = "ioc"
+
+// DefaultDedupWindow is the time within which the same match is alerted once.
+const DefaultDedupWindow = 5 * time.Minute
+
+// Feed is a file with indicators.
+type Feed struct {
+	Name string
+	File string
+	// Format of the file. Possible values are: list, csv, misp, stix.
+	Format string
+	// Type of indicators in list or csv file without type column. If empty,
+	// then type is detected from each indicator value.
+	Type string
+	// Threat id of matches. Default: ioc_ followed by the feed name.
+	Threat string
+	// Severity of matches. Default: 4
+	Severity int
+	// Description of the threat. Default: the feed name.
+	Description string
+}
+
+// Indicator of compromise.
+type Indicator struct {
+	Type  string
+	Value string
+	// Description of the indicator, e.g. MISP event info or STIX indicator name.
+	Description string
+}
+
+// Match of an event with indicator of the feed.
+type Match struct {
+	Feed *Feed
+	Indicator
+}
+
+// feedFile is a feed with indicators from its file.
+type feedFile struct {
+	Feed
+	modTime    time.Time
+	indicators []Indicator
+}
+
+// Engine matches events with indicators of the feeds.
+// Feed files are reloaded by Reload, if they were modified.
+type Engine struct {
+	feeds []*feedFile
+
+	mx    sync.RWMutex
+	index *index
+
+	window time.Duration
+	// alerted keeps time of the last alert of threat, indicators, source
+	// and destination, so e.g. each packet of a flow isn't alerted.
+	amx      sync.Mutex
+	alerted  map[string]time.Time
+	lastTrim time.Time
+}
+
+// New loads indicators of the feeds.
+func New(feeds []Feed) (*Engine, error) {
+	e := &Engine{window: DefaultDedupWindow, alerted: make(map[string]time.Time)}
+	for _, feed := range feeds {
+		if err := feed.validate(); err != nil {
+			return nil, err
+		}
+		if feed.Threat == "" {
+			feed.Threat = "ioc_" + threatName(feed.Name)
+		}
+		if feed.Severity == 0 {
+			feed.Severity = DefaultSeverity
+		}
+		if feed.Description == "" {
+			feed.Description = feed.Name
+		}
+		e.feeds = append(e.feeds, &feedFile{Feed: feed})
+	}
+
+	if _, err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (f *Feed) validate() error {
+	if f.Name == "" {
+		return fmt.Errorf("ioc feed name required")
+	}
+	if f.File == "" {
+		return fmt.Errorf("ioc feed %s file required", f.Name)
+	}
+	switch f.Format {
+	case FormatList, FormatCSV, FormatMISP, FormatSTIX:
+	default:
+		return fmt.Errorf("invalid ioc feed %s format %s", f.Name, f.Format)
+	}
+	switch f.Type {
+	case "", TypeDomain, TypeIP, TypeURL, TypeJA3:
+	default:
+		return fmt.Errorf("invalid ioc feed %s type %s", f.Name, f.Type)
+	}
+	if f.Severity < 0 || f.Severity > 5 {
+		return fmt.Errorf("invalid ioc feed %s severity %d", f.Name, f.Severity)
+	}
+	return nil
+}
+
+// SetDedupWindow sets the time within which the same threat and indicators
+// of the same source and destination are alerted once. If it's 0, then
+// every match is alerted.
+func (e *Engine) SetDedupWindow(window time.Duration) {
+	e.window = window
+}
+
+// threatName replaces characters other than letters, digits and underscore in feed name.
+func threatName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		if r >= 'A' && r <= 'Z' {
+			return r - 'A' + 'a'
+		}
+		return '_'
+	}, name)
+}
+
+// Reload reads feed files modified since last read, and returns true
+// if any was reloaded. If a file can't be read, then its previous
+// indicators are kept, and the error is returned.
+func (e *Engine) Reload() (bool, error) {
+	var (
+		reloaded bool
+		err      error
+	)
+	for _, f := range e.feeds {
+		ok, ferr := f.reload()
+		if ferr != nil && err == nil {
+			err = fmt.Errorf("ioc feed %s: %s", f.Name, ferr)
+		}
+		reloaded = reloaded || ok
+	}
+
+	if reloaded || e.index == nil {
+		idx := newIndex()
+		for _, f := range e.feeds {
+			for _, ind := range f.indicators {
+				idx.add(&f.Feed, ind)
+			}
+		}
+		e.mx.Lock()
+		e.index = idx
+		e.mx.Unlock()
+	}
+	return reloaded, err
+}
+
+// reload reads the feed file if it was modified since last read.
+func (f *feedFile) reload() (bool, error) {
+	stat, err := os.Stat(f.File)
+	if err != nil {
+		return false, err
+	}
+	if stat.ModTime().Equal(f.modTime) {
+		return false, nil
+	}
+
+	file, err := os.Open(f.File)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	var indicators []Indicator
+	switch f.Format {
+	case FormatList:
+		indicators, err = parseList(file, f.Type)
+	case FormatCSV:
+		indicators, err = parseCSV(file, f.Type)
+	case FormatMISP:
+		indicators, err = parseMISP(file)
+	case FormatSTIX:
+		indicators, err = parseSTIX(file, time.Now())
+	}
+	if err != nil {
+		return false, fmt.Errorf("parse %s: %s", f.File, err)
+	}
+
+	f.indicators = indicators
+	f.modTime = stat.ModTime()
+	return true, nil
+}
+
+// Len returns the number of loaded indicators.
+func (e *Engine) Len() int {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+	return e.index.len
+}
+
+// MatchDomain returns matches of the domain and its parent domains.
+func (e *Engine) MatchDomain(name string) []Match {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+	return e.index.matchDomain(name)
+}
+
+// MatchIP returns matches of the ip address, also by network.
+func (e *Engine) MatchIP(ip net.IP) []Match {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+	return e.index.matchIP(ip)
+}
+
+// MatchURL returns matches of the url, and of its host domain or ip.
+func (e *Engine) MatchURL(rawurl string) []Match {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+	return e.index.matchURL(rawurl)
+}
+
+// MatchJA3 returns matches of ja3 fingerprint.
+func (e *Engine) MatchJA3(ja3 string) []Match {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+	return e.index.matchJA3(ja3)
+}
+
+// Match matches fields of the event depending on its type: query of dns event,
+// source and destination ip and ja3 of ip event, and url of http event.
+// It returns alert event with a threat for each matching feed, or nil if nothing matches.
+func (e *Engine) Match(eventType client.EventType, ev *client.EventUnified) *alerts.Event {
+	var matches []Match
+	switch eventType {
+	case client.EventTypeDNS:
+		matches = e.MatchDomain(ev.Query)
+	case client.EventTypeIP:
+		matches = append(e.MatchIP(ev.DestIP), e.MatchIP(ev.SrcIP)...)
+		if ev.Ja3 != "" {
+			matches = append(matches, e.MatchJA3(ev.Ja3)...)
+		}
+	case client.EventTypeHTTP:
+		matches = e.MatchURL(ev.URL)
+	}
+	if matches = e.dedup(ev, matches); len(matches) == 0 {
+		return nil
+	}
+	return newEvent(eventType, ev, matches)
+}
+
+// dedup removes matches of threats already alerted within the window,
+// for the same indicators, source and destination of the event.
+func (e *Engine) dedup(ev *client.EventUnified, matches []Match) []Match {
+	if e.window <= 0 || len(matches) == 0 {
+		return matches
+	}
+	ts := ev.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	values := make(map[string][]string)
+	for _, m := range matches {
+		if !utils.StringsContains(values[m.Feed.Threat], m.Value) {
+			values[m.Feed.Threat] = append(values[m.Feed.Threat], m.Value)
+		}
+	}
+
+	e.amx.Lock()
+	defer e.amx.Unlock()
+	if ts.Sub(e.lastTrim) >= e.window {
+		for key, last := range e.alerted {
+			if ts.Sub(last) >= e.window {
+				delete(e.alerted, key)
+			}
+		}
+		e.lastTrim = ts
+	}
+
+	alert := make(map[string]bool)
+	for tid, vs := range values {
+		sort.Strings(vs)
+		key := strings.Join([]string{tid, strings.Join(vs, ","), ev.SrcIP.String(), ev.DestIP.String()}, "|")
+		if last, ok := e.alerted[key]; ok && ts.Sub(last) < e.window {
+			continue
+		}
+		e.alerted[key] = ts
+		alert[tid] = true
+	}
+
+	var kept []Match
+	for _, m := range matches {
+		if alert[m.Feed.Threat] {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+// newEvent creates alert event from matches. Matches of the same feed are
+// a single threat, described by the feed and matched indicators.
+func newEvent(eventType client.EventType, ev *client.EventUnified, matches []Match) *alerts.Event {
+	alert := &alerts.Event{
+		EventType:    string(eventType),
+		Flags:        []string{Flag},
+		Threats:      make(map[string]alerts.Threat),
+		EventUnified: *ev,
+	}
+
+	values := make(map[string][]string)
+	for _, m := range matches {
+		if !utils.StringsContains(values[m.Feed.Threat], m.Value) {
+			values[m.Feed.Threat] = append(values[m.Feed.Threat], m.Value)
+		}
+		if _, ok := alert.Threats[m.Feed.Threat]; ok {
+			continue
+		}
+		desc := m.Feed.Description
+		if m.Description != "" && m.Description != desc {
+			desc += ": " + m.Description
+		}
+		alert.Threats[m.Feed.Threat] = alerts.Threat{
+			Severity:    m.Feed.Severity,
+			Description: desc,
+		}
+		if m.Feed.Severity > alert.Severity {
+			alert.Severity = m.Feed.Severity
+		}
+	}
+
+	for tid, threat := range alert.Threats {
+		sort.Strings(values[tid])
+		threat.Description += " (" + strings.Join(values[tid], ", ") + ")"
+		alert.Threats[tid] = threat
+	}
+	return alert
+}
@@ -0,0 +1,274 @@
+package ioc
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/client"
+)
+
+const listFeed = `# bad domains
+evil.example.com
+10.1.2.3
+192.168.100.0/24
+http://bad.example.org/download/payload.exe
+e7d705a3286e19ea42f587b344ee6865
+`
+
+const csvFeed = `type,value,description
+domain,c2.example.net,Known C2
+ip-dst,2001:db8::1,Sinkhole
+unknown,ignored.example.com,
+url,bad.example.org/login,Phishing
+`
+
+const mispFeed = `{"response": [{"Event": {
+  "info": "Emotet campaign",
+  "Attribute": [
+    {"type": "domain", "value": "emotet.example.com", "to_ids": true},
+    {"type": "domain", "value": "benign.example.com", "to_ids": false},
+    {"type": "ip-dst|port", "value": "10.9.9.9|443", "to_ids": true}
+  ],
+  "Object": [{"Attribute": [
+    {"type": "ja3-fingerprint-md5", "value": "72A589DA586844D7F0818CE684948EEA", "comment": "Emotet ja3", "to_ids": true}
+  ]}]
+}}]}`
+
+const stixFeed = `{
+  "type": "bundle",
+  "id": "bundle--5d0092c5-5f74-4287-9642-33f4c354e56d",
+  "objects": [
+    {
+      "type": "indicator",
+      "spec_version": "2.1",
+      "id": "indicator--8e2e2d2b-17d4-4cbf-938f-98ee46b3cd3f",
+      "name": "Malicious site",
+      "pattern": "[domain-name:value = 'stix.example.com'] OR [url:value = 'http://stix.example.com/a?b=c']",
+      "pattern_type": "stix",
+      "valid_from": "2021-01-01T00:00:00Z"
+    },
+    {
+      "type": "indicator",
+      "spec_version": "2.1",
+      "id": "indicator--0d1c4e3e-7a30-4a38-8e5c-9f2b3c6b8a11",
+      "name": "Expired",
+      "pattern": "[ipv4-addr:value = '10.8.8.8']",
+      "pattern_type": "stix",
+      "valid_from": "2020-01-01T00:00:00Z",
+      "valid_until": "2020-06-01T00:00:00Z"
+    },
+    {
+      "type": "indicator",
+      "spec_version": "2.1",
+      "id": "indicator--51f1b5c2-4bd1-4e56-8c3d-2d0a5d3e4f61",
+      "name": "Snort rule",
+      "pattern": "alert tcp any any -> any any",
+      "pattern_type": "snort",
+      "valid_from": "2021-01-01T00:00:00Z"
+    }
+  ]
+}`
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	file := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		content  string
+		parse    func(string) ([]Indicator, error)
+		expected []Indicator
+	}{
+		{"list", listFeed, func(s string) ([]Indicator, error) { return parseList(strings.NewReader(s), "") }, []Indicator{
+			{Type: TypeDomain, Value: "evil.example.com"},
+			{Type: TypeIP, Value: "10.1.2.3"},
+			{Type: TypeIP, Value: "192.168.100.0/24"},
+			{Type: TypeURL, Value: "http://bad.example.org/download/payload.exe"},
+			{Type: TypeJA3, Value: "e7d705a3286e19ea42f587b344ee6865"},
+		}},
+		{"csv", csvFeed, func(s string) ([]Indicator, error) { return parseCSV(strings.NewReader(s), "") }, []Indicator{
+			{Type: TypeDomain, Value: "c2.example.net", Description: "Known C2"},
+			{Type: TypeIP, Value: "2001:db8::1", Description: "Sinkhole"},
+			{Type: TypeURL, Value: "bad.example.org/login", Description: "Phishing"},
+		}},
+		{"misp", mispFeed, func(s string) ([]Indicator, error) { return parseMISP(strings.NewReader(s)) }, []Indicator{
+			{Type: TypeDomain, Value: "emotet.example.com", Description: "Emotet campaign"},
+			{Type: TypeIP, Value: "10.9.9.9", Description: "Emotet campaign"},
+			{Type: TypeJA3, Value: "72A589DA586844D7F0818CE684948EEA", Description: "Emotet ja3"},
+		}},
+		{"stix", stixFeed, func(s string) ([]Indicator, error) { return parseSTIX(strings.NewReader(s), time.Now()) }, []Indicator{
+			{Type: TypeDomain, Value: "stix.example.com", Description: "Malicious site"},
+			{Type: TypeURL, Value: "http://stix.example.com/a?b=c", Description: "Malicious site"},
+		}},
+	} {
+		indicators, err := tt.parse(tt.content)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if len(indicators) != len(tt.expected) {
+			t.Fatalf("%s: got %d indicators %v; expected %d", tt.name, len(indicators), indicators, len(tt.expected))
+		}
+		for n := range indicators {
+			if indicators[n] != tt.expected[n] {
+				t.Fatalf("%s: got %+v; expected %+v", tt.name, indicators[n], tt.expected[n])
+			}
+		}
+	}
+}
+
+func TestEngineMatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-ioc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e, err := New([]Feed{
+		{Name: "Local List", File: writeFile(t, dir, "list.txt", listFeed), Format: FormatList},
+		{Name: "misp", File: writeFile(t, dir, "misp.json", mispFeed), Format: FormatMISP, Threat: "emotet", Severity: 5},
+		{Name: "stix", File: writeFile(t, dir, "stix.json", stixFeed), Format: FormatSTIX},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Len() != 10 {
+		t.Fatalf("got %d indicators; expected 10", e.Len())
+	}
+
+	for _, tt := range []struct {
+		eventType client.EventType
+		ev        client.EventUnified
+		threats   []string
+	}{
+		{client.EventTypeDNS, client.EventUnified{Query: "www.Evil.example.com."}, []string{"ioc_local_list"}},
+		{client.EventTypeDNS, client.EventUnified{Query: "example.com"}, nil},
+		{client.EventTypeDNS, client.EventUnified{Query: "notevil.example.com"}, nil},
+		{client.EventTypeIP, client.EventUnified{SrcIP: net.IPv4(192, 168, 100, 7), DestIP: net.IPv4(10, 9, 9, 9)}, []string{"emotet", "ioc_local_list"}},
+		{client.EventTypeIP, client.EventUnified{DestIP: net.IPv4(10, 8, 8, 8)}, nil},
+		{client.EventTypeIP, client.EventUnified{DestIP: net.IPv4(1, 1, 1, 1), Ja3: "72a589da586844d7f0818ce684948eea"}, []string{"emotet"}},
+		{client.EventTypeHTTP, client.EventUnified{URL: "https://bad.example.org/download/payload.exe?x=1"}, []string{"ioc_local_list"}},
+		{client.EventTypeHTTP, client.EventUnified{URL: "http://bad.example.org/index.html"}, nil},
+		{client.EventTypeHTTP, client.EventUnified{URL: "http://STIX.example.com:80/a?b=c"}, []string{"ioc_stix"}},
+		{client.EventTypeHTTP, client.EventUnified{URL: "http://10.1.2.3/"}, []string{"ioc_local_list"}},
+	} {
+		ev := e.Match(tt.eventType, &tt.ev)
+		if ev == nil {
+			if len(tt.threats) > 0 {
+				t.Fatalf("%s event %+v not matched", tt.eventType, tt.ev)
+			}
+			continue
+		}
+		if len(ev.Threats) != len(tt.threats) {
+			t.Fatalf("%s event %+v got threats %v; expected %v", tt.eventType, tt.ev, ev.Threats, tt.threats)
+		}
+		for _, tid := range tt.threats {
+			if _, ok := ev.Threats[tid]; !ok {
+				t.Fatalf("%s event %+v got threats %v; expected %v", tt.eventType, tt.ev, ev.Threats, tt.threats)
+			}
+		}
+		if ev.EventType != string(tt.eventType) || len(ev.Flags) != 1 || ev.Flags[0] != Flag {
+			t.Fatalf("invalid event %+v", ev)
+		}
+	}
+
+	ev := e.Match(client.EventTypeIP, &client.EventUnified{DestIP: net.IPv4(10, 9, 9, 9)})
+	if ev.Severity != 5 || ev.Threats["emotet"].Description != "misp: Emotet campaign (10.9.9.9)" {
+		t.Fatalf("invalid event %+v", ev)
+	}
+}
+
+func TestEngineDedup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-ioc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e, err := New([]Feed{{Name: "list", File: writeFile(t, dir, "list.txt", listFeed), Format: FormatList}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// packets of one flow are alerted once
+	ts := time.Date(2021, 3, 6, 12, 0, 0, 0, time.UTC)
+	var alerts int
+	for i := 0; i < 100; i++ {
+		if e.Match(client.EventTypeIP, &client.EventUnified{
+			Timestamp: ts.Add(time.Duration(i) * time.Second),
+			SrcIP:     net.IPv4(192, 168, 1, 10),
+			SrcPort:   uint16(40000 + i%2),
+			DestIP:    net.IPv4(10, 1, 2, 3),
+			DestPort:  443,
+		}) != nil {
+			alerts++
+		}
+	}
+	if alerts != 1 {
+		t.Fatalf("got %d alerts of flow packets; expected 1", alerts)
+	}
+
+	// other source, and the same flow after the window are alerted
+	if e.Match(client.EventTypeIP, &client.EventUnified{Timestamp: ts, SrcIP: net.IPv4(192, 168, 1, 11), DestIP: net.IPv4(10, 1, 2, 3)}) == nil {
+		t.Fatal("other source not alerted")
+	}
+	if e.Match(client.EventTypeIP, &client.EventUnified{Timestamp: ts.Add(DefaultDedupWindow + time.Minute),
+		SrcIP: net.IPv4(192, 168, 1, 10), DestIP: net.IPv4(10, 1, 2, 3)}) == nil {
+		t.Fatal("flow not alerted after dedup window")
+	}
+
+	// without window every match is alerted
+	e.SetDedupWindow(0)
+	for i := 0; i < 2; i++ {
+		if e.Match(client.EventTypeDNS, &client.EventUnified{Timestamp: ts, Query: "evil.example.com"}) == nil {
+			t.Fatal("dns event not alerted")
+		}
+	}
+}
+
+func TestEngineReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-ioc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := writeFile(t, dir, "domains.txt", "old.example.com\n")
+	e, err := New([]Feed{{Name: "domains", File: file, Format: FormatList, Type: TypeDomain}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := e.Reload(); reloaded || err != nil {
+		t.Fatalf("unchanged feed reloaded %t: %v", reloaded, err)
+	}
+
+	writeFile(t, dir, "domains.txt", "new.example.com\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := e.Reload(); !reloaded || err != nil {
+		t.Fatalf("changed feed not reloaded: %v", err)
+	}
+	if len(e.MatchDomain("old.example.com")) != 0 || len(e.MatchDomain("new.example.com")) != 1 {
+		t.Fatal("invalid indicators after reload")
+	}
+
+	// indicators are kept if feed file is missing
+	os.Remove(file)
+	if _, err := e.Reload(); err == nil {
+		t.Fatal("expected error for missing feed")
+	}
+	if len(e.MatchDomain("new.example.com")) != 1 {
+		t.Fatal("indicators removed after failed reload")
+	}
+}
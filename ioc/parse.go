@@ -0,0 +1,287 @@
+package ioc
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ja3Re matches ja3 fingerprint, which is md5 hash.
+var ja3Re = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+// detectType returns type of the indicator value, or empty string if it's unknown.
+func detectType(value string) string {
+	switch {
+	case value == "":
+		return ""
+	case ja3Re.MatchString(value):
+		return TypeJA3
+	case net.ParseIP(value) != nil:
+		return TypeIP
+	case strings.Contains(value, "/"):
+		if _, _, err := net.ParseCIDR(value); err == nil {
+			return TypeIP
+		}
+		return TypeURL
+	case strings.Contains(value, "://"):
+		return TypeURL
+	case strings.Contains(value, "."):
+		return TypeDomain
+	}
+	return ""
+}
+
+// newIndicator returns indicator of the type, or of detected type if typ is empty.
+func newIndicator(typ, value, desc string) (Indicator, bool) {
+	value = strings.TrimSpace(value)
+	if typ == "" {
+		typ = detectType(value)
+	}
+	return Indicator{Type: typ, Value: value, Description: desc}, typ != "" && value != ""
+}
+
+// parseList parses list with one indicator per line. Empty lines
+// and lines starting with # are skipped.
+func parseList(r io.Reader, typ string) ([]Indicator, error) {
+	var indicators []Indicator
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if ind, ok := newIndicator(typ, line, ""); ok {
+			indicators = append(indicators, ind)
+		}
+	}
+	return indicators, s.Err()
+}
+
+// parseCSV parses csv with header. The value column (or indicator) is required,
+// and type and description (or comment) columns are optional.
+func parseCSV(r io.Reader, typ string) ([]Indicator, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.Comment = '#'
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for n, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = n
+	}
+	if _, ok := columns["value"]; !ok {
+		n, ok := columns["indicator"]
+		if !ok {
+			return nil, fmt.Errorf("value column required")
+		}
+		columns["value"] = n
+	}
+	if _, ok := columns["description"]; !ok {
+		if n, ok := columns["comment"]; ok {
+			columns["description"] = n
+		}
+	}
+
+	var indicators []Indicator
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return indicators, nil
+		} else if err != nil {
+			return nil, err
+		}
+		value := func(column string) string {
+			if n, ok := columns[column]; ok && n < len(record) {
+				return strings.TrimSpace(record[n])
+			}
+			return ""
+		}
+
+		rtyp := typ
+		if t := strings.ToLower(value("type")); t != "" {
+			var ok bool
+			if rtyp, ok = typeAliases[t]; !ok {
+				continue
+			}
+		}
+		if ind, ok := newIndicator(rtyp, value("value"), value("description")); ok {
+			indicators = append(indicators, ind)
+		}
+	}
+}
+
+// typeAliases maps names of indicator types used in csv files and MISP
+// attribute types to indicator types.
+var typeAliases = map[string]string{
+	"domain":              TypeDomain,
+	"domain-name":         TypeDomain,
+	"hostname":            TypeDomain,
+	"fqdn":                TypeDomain,
+	"ip":                  TypeIP,
+	"ip-dst":              TypeIP,
+	"ip-src":              TypeIP,
+	"ipv4":                TypeIP,
+	"ipv6":                TypeIP,
+	"cidr":                TypeIP,
+	"url":                 TypeURL,
+	"uri":                 TypeURL,
+	"link":                TypeURL,
+	"ja3":                 TypeJA3,
+	"ja3-fingerprint-md5": TypeJA3,
+}
+
+// mispAttribute is an attribute of MISP event.
+type mispAttribute struct {
+	Type    string `json:"type"`
+	Value   string `json:"value"`
+	Comment string `json:"comment"`
+	ToIDS   *bool  `json:"to_ids"`
+}
+
+// mispEvent is MISP event with attributes, also of its objects.
+type mispEvent struct {
+	Info       string          `json:"info"`
+	Attributes []mispAttribute `json:"Attribute"`
+	Objects    []struct {
+		Attributes []mispAttribute `json:"Attribute"`
+	} `json:"Object"`
+}
+
+// mispEventWrapper is an event in MISP json export.
+type mispEventWrapper struct {
+	Event mispEvent `json:"Event"`
+}
+
+// parseMISP parses MISP json export, which is a single event, a list of events,
+// or a rest search response. Attributes not meant for detection (to_ids false)
+// are skipped. Composite attributes, e.g. domain|ip or ip-dst|port, are split.
+func parseMISP(r io.Reader) ([]Indicator, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []mispEventWrapper
+	if err := json.Unmarshal(b, &events); err != nil {
+		var export struct {
+			Event    *mispEvent         `json:"Event"`
+			Response []mispEventWrapper `json:"response"`
+		}
+		if err := json.Unmarshal(b, &export); err != nil {
+			return nil, err
+		}
+		if export.Event != nil {
+			events = append(events, mispEventWrapper{Event: *export.Event})
+		}
+		events = append(events, export.Response...)
+	}
+
+	var indicators []Indicator
+	for _, ev := range events {
+		attrs := ev.Event.Attributes
+		for _, obj := range ev.Event.Objects {
+			attrs = append(attrs, obj.Attributes...)
+		}
+		for _, attr := range attrs {
+			if attr.ToIDS != nil && !*attr.ToIDS {
+				continue
+			}
+			desc := ev.Event.Info
+			if attr.Comment != "" {
+				desc = attr.Comment
+			}
+			types := strings.Split(attr.Type, "|")
+			values := strings.Split(attr.Value, "|")
+			for n, t := range types {
+				typ, ok := typeAliases[t]
+				if !ok || n >= len(values) {
+					continue
+				}
+				if ind, ok := newIndicator(typ, values[n], desc); ok {
+					indicators = append(indicators, ind)
+				}
+			}
+		}
+	}
+	return indicators, nil
+}
+
+// stixObject is an object of STIX bundle. Only indicators are used.
+type stixObject struct {
+	Type        string    `json:"type"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Pattern     string    `json:"pattern"`
+	PatternType string    `json:"pattern_type"`
+	ValidUntil  time.Time `json:"valid_until"`
+	Revoked     bool      `json:"revoked"`
+}
+
+// stixComparisonRe matches equality comparisons of STIX patterns, e.g.
+// [domain-name:value = 'example.com'] or [x-ja3:hash = '...'].
+var stixComparisonRe = regexp.MustCompile(`([a-z0-9-]+):(value|hash)\s*=\s*'((?:[^'\\]|\\.)*)'`)
+
+// stixTypes maps STIX cyber-observable types to indicator types.
+var stixTypes = map[string]string{
+	"domain-name": TypeDomain,
+	"ipv4-addr":   TypeIP,
+	"ipv6-addr":   TypeIP,
+	"url":         TypeURL,
+	"x-ja3":       TypeJA3,
+}
+
+// parseSTIX parses STIX 2.1 bundle. Indicators with stix patterns are used,
+// unless revoked or expired at now. Each equality comparison of domain-name,
+// ipv4-addr, ipv6-addr and url values is an indicator. JA3 fingerprints are
+// read from x-ja3:hash comparisons.
+func parseSTIX(r io.Reader, now time.Time) ([]Indicator, error) {
+	var bundle struct {
+		Type    string       `json:"type"`
+		Objects []stixObject `json:"objects"`
+	}
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return nil, err
+	}
+	if bundle.Type != "bundle" {
+		return nil, fmt.Errorf("not a stix bundle")
+	}
+
+	var indicators []Indicator
+	for _, obj := range bundle.Objects {
+		if obj.Type != "indicator" || obj.Revoked {
+			continue
+		}
+		if obj.PatternType != "" && obj.PatternType != "stix" {
+			continue
+		}
+		if !obj.ValidUntil.IsZero() && obj.ValidUntil.Before(now) {
+			continue
+		}
+		desc := obj.Name
+		if desc == "" {
+			desc = obj.Description
+		}
+		for _, m := range stixComparisonRe.FindAllStringSubmatch(obj.Pattern, -1) {
+			typ, ok := stixTypes[m[1]]
+			if !ok || (m[2] == "hash") != (typ == TypeJA3) {
+				continue
+			}
+			value := strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(m[3])
+			if ind, ok := newIndicator(typ, value, desc); ok {
+				indicators = append(indicators, ind)
+			}
+		}
+	}
+	return indicators, nil
+}
@@ -6,10 +6,11 @@ import (
 	"os"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/alphasoc/nfr/rotate"
 )
 
-// SetOutput sets output for global logger.
-func SetOutput(file string) error {
+// SetOutput sets output for global logger. Log file is rotated according to rcfg.
+func SetOutput(file string, rcfg rotate.Config) error {
 	log.SetFormatter(&log.TextFormatter{
 		FullTimestamp: true,
 	})
@@ -19,7 +20,7 @@ func SetOutput(file string) error {
 	case "stderr":
 		log.SetOutput(os.Stderr)
 	default:
-		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		f, err := rotate.Open(file, rcfg)
 		if err != nil {
 			return fmt.Errorf("can't set logger output: %s", err)
 		}
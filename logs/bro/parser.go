@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/packet"
@@ -169,6 +170,63 @@ func (p *Parser) ParseLineDNS(line string) (*packet.DNSPacket, error) {
 	return &dnspacket, nil
 }
 
+// ParseLineDNSAnswers parse addresses resolved in single log line with dns data.
+func (p *Parser) ParseLineDNSAnswers(line string) ([]packet.DNSAnswer, error) {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 {
+		return nil, nil
+	}
+	if line[0] == '#' {
+		if err := p.readMetadata(line); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	fields := strings.Split(line, p.metadata.separator)
+	if len(fields) != len(p.metadata.fields) {
+		return nil, fmt.Errorf("bro dns log invalid entry at line: %q", line)
+	}
+
+	var (
+		ts      time.Time
+		query   string
+		answers []string
+	)
+	for i, f := range p.metadata.fields {
+		switch f {
+		case "ts":
+			timestamp, err := parseEpochTime(fields[i])
+			if err != nil {
+				return nil, fmt.Errorf("bro dns log invalid timestamp: %s", err)
+			}
+			ts = timestamp
+		case "query":
+			query = strings.ToLower(p.nonEmpty(fields[i]))
+		case "rcode_name":
+			if rcode := p.nonEmpty(fields[i]); rcode != "" && rcode != "NOERROR" {
+				return nil, nil
+			}
+		case "answers":
+			if v := p.nonEmpty(fields[i]); v != "" {
+				answers = strings.Split(v, p.metadata.setSeparator)
+			}
+		}
+	}
+	if query == "" {
+		return nil, nil
+	}
+
+	var dnsanswers []packet.DNSAnswer
+	for _, answer := range answers {
+		// answers are also names of cname records
+		if ip := net.ParseIP(answer); ip != nil {
+			dnsanswers = append(dnsanswers, packet.DNSAnswer{Timestamp: ts, Name: query, IP: ip})
+		}
+	}
+	return dnsanswers, nil
+}
+
 // ParseLineIP parse single log line with ip data.
 func (p *Parser) ParseLineIP(line string) (*packet.IPPacket, error) {
 	line = strings.TrimSpace(line)
@@ -200,3 +200,36 @@ func TestReaderReadHTTP(t *testing.T) {
 		t.Errorf("invalid 2nd packet: %+v", packets[1])
 	}
 }
+
+func TestParseLineDNSAnswers(t *testing.T) {
+	p := NewParser()
+	for _, line := range []string{
+		`#separator \x09`,
+		"#set_separator	,",
+		"#empty_field	(empty)",
+		"#unset_field	-",
+		"#fields	ts	uid	id.orig_h	query	rcode_name	answers",
+	} {
+		if _, err := p.ParseLineDNSAnswers(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	answers, err := p.ParseLineDNSAnswers("1483228800.000000	C1	10.0.0.1	www.alphasoc.com	NOERROR	alphasoc.com,35.196.211.126,2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	if len(answers) != 2 ||
+		answers[0].Name != "www.alphasoc.com" ||
+		!answers[0].Timestamp.Equal(tc) ||
+		!answers[0].IP.Equal(net.IPv4(35, 196, 211, 126)) ||
+		!answers[1].IP.Equal(net.ParseIP("2001:db8::1")) {
+		t.Fatalf("invalid answers %v", answers)
+	}
+
+	answers, err = p.ParseLineDNSAnswers("1483228800.000000	C2	10.0.0.1	nx.alphasoc.com	NXDOMAIN	-")
+	if err != nil || len(answers) != 0 {
+		t.Fatalf("unexpected answers %v: %v", answers, err)
+	}
+}
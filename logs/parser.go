@@ -21,3 +21,8 @@ type Parser interface {
 	ParseLineIP(line string) (*packet.IPPacket, error)
 	ParseLineHTTP(line string) (*client.HTTPEntry, error)
 }
+
+// DNSAnswerParser is implemented by parsers of logs with dns answers.
+type DNSAnswerParser interface {
+	ParseLineDNSAnswers(line string) ([]packet.DNSAnswer, error)
+}
@@ -3,6 +3,7 @@ package pcap
 import (
 	"github.com/alphasoc/nfr/client"
 	"github.com/alphasoc/nfr/packet"
+	"github.com/alphasoc/nfr/sniffer"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/pcap"
 )
@@ -26,7 +27,7 @@ func NewReader(filename string) (*Reader, error) {
 func (r *Reader) ReadDNS() ([]*packet.DNSPacket, error) {
 	var packets []*packet.DNSPacket
 
-	source := gopacket.NewPacketSource(r.handle, r.handle.LinkType())
+	source := gopacket.NewPacketSource(r.handle, packet.LinkTypeDecoder(sniffer.LinkType(r.handle)))
 	for raw := range source.Packets() {
 		if dnspacket := packet.NewDNSPacket(raw); dnspacket != nil {
 			packets = append(packets, dnspacket)
@@ -39,7 +40,7 @@ func (r *Reader) ReadDNS() ([]*packet.DNSPacket, error) {
 func (r *Reader) ReadIP() ([]*packet.IPPacket, error) {
 	var packets []*packet.IPPacket
 
-	source := gopacket.NewPacketSource(r.handle, r.handle.LinkType())
+	source := gopacket.NewPacketSource(r.handle, packet.LinkTypeDecoder(sniffer.LinkType(r.handle)))
 	for raw := range source.Packets() {
 		if ippacket := packet.NewIPPacket(raw); ippacket != nil {
 			packets = append(packets, ippacket)
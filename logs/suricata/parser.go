@@ -26,6 +26,17 @@ type logEntry struct {
 		Type   string `json:"type"`
 		Rrname string `json:"rrname"`
 		Rrtype string `json:"rrtype"`
+		Rcode  string `json:"rcode"`
+		// Rdata of answer in version 1 format, with one record per line.
+		Rdata string `json:"rdata"`
+		// Answers in version 2 detailed format.
+		Answers []struct {
+			Rrname string `json:"rrname"`
+			Rrtype string `json:"rrtype"`
+			Rdata  string `json:"rdata"`
+		} `json:"answers"`
+		// Grouped answers in version 2 format.
+		Grouped map[string][]string `json:"grouped"`
 	} `json:"dns"`
 	HTTP struct {
 		Hostname        string `json:"hostname"`
@@ -124,6 +135,60 @@ func (*Parser) ParseLineDNS(line string) (*packet.DNSPacket, error) {
 	}, nil
 }
 
+// ParseLineDNSAnswers parse addresses resolved in single log line with dns answer.
+// Answers in version 1 and 2 (detailed or grouped) formats are supported.
+func (*Parser) ParseLineDNSAnswers(line string) ([]packet.DNSAnswer, error) {
+	if len(line) == 0 {
+		return nil, nil
+	}
+
+	var entry logEntry
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return nil, fmt.Errorf("suricata %s", err)
+	}
+
+	dns := &entry.DNS
+	if dns.Type != "answer" || (dns.Rcode != "" && dns.Rcode != "NOERROR") {
+		return nil, nil
+	}
+
+	var (
+		answers []packet.DNSAnswer
+		ts      = time.Time(entry.Timestamp)
+		query   = strings.ToLower(dns.Rrname)
+	)
+	add := func(name, rrtype, rdata string) {
+		if rrtype != "A" && rrtype != "AAAA" {
+			return
+		}
+		ip := net.ParseIP(rdata)
+		if ip == nil {
+			return
+		}
+		name = strings.ToLower(name)
+		answers = append(answers, packet.DNSAnswer{Timestamp: ts, Name: name, IP: ip})
+		if name != query && query != "" {
+			answers = append(answers, packet.DNSAnswer{Timestamp: ts, Name: query, IP: ip})
+		}
+	}
+
+	switch {
+	case len(dns.Answers) > 0:
+		for _, a := range dns.Answers {
+			add(a.Rrname, a.Rrtype, a.Rdata)
+		}
+	case dns.Rdata != "":
+		add(dns.Rrname, dns.Rrtype, dns.Rdata)
+	default:
+		for _, rrtype := range []string{"A", "AAAA"} {
+			for _, rdata := range dns.Grouped[rrtype] {
+				add(dns.Rrname, rrtype, rdata)
+			}
+		}
+	}
+	return answers, nil
+}
+
 // ParseLineIP reads all ip packets from the file.
 func (*Parser) ParseLineIP(line string) (*packet.IPPacket, error) {
 	return nil, nil
@@ -61,3 +61,34 @@ func TestReaderReadDNS(t *testing.T) {
 		t.Fatalf("invalid 2nd packet %+q", packets[1])
 	}
 }
+
+func TestParseLineDNSAnswers(t *testing.T) {
+	p := NewParser()
+	for _, tt := range []struct {
+		line  string
+		names []string
+		ips   []string
+	}{
+		{`{"event_type":"dns","dns":{"type":"query","id":1,"rrname":"alphasoc.com","rrtype":"A"}}`, nil, nil},
+		{`{"timestamp":"2017-01-01T00:00:00.000000+0000","event_type":"dns","dns":{"type":"answer","id":1,"rcode":"NOERROR","rrname":"alphasoc.com","rrtype":"A","ttl":300,"rdata":"35.196.211.126"}}`,
+			[]string{"alphasoc.com"}, []string{"35.196.211.126"}},
+		{`{"timestamp":"2017-01-01T00:00:00.000000+0000","event_type":"dns","dns":{"version":2,"type":"answer","id":1,"rcode":"NOERROR","rrname":"www.alphasoc.com","rrtype":"A","answers":[{"rrname":"www.alphasoc.com","rrtype":"CNAME","ttl":300,"rdata":"alphasoc.com"},{"rrname":"alphasoc.com","rrtype":"A","ttl":300,"rdata":"35.196.211.126"}]}}`,
+			[]string{"alphasoc.com", "www.alphasoc.com"}, []string{"35.196.211.126", "35.196.211.126"}},
+		{`{"timestamp":"2017-01-01T00:00:00.000000+0000","event_type":"dns","dns":{"version":2,"type":"answer","id":1,"rcode":"NOERROR","rrname":"alphasoc.net","rrtype":"AAAA","grouped":{"AAAA":["2001:db8::1"]}}}`,
+			[]string{"alphasoc.net"}, []string{"2001:db8::1"}},
+		{`{"event_type":"dns","dns":{"version":2,"type":"answer","id":1,"rcode":"NXDOMAIN","rrname":"nx.alphasoc.net","rrtype":"A"}}`, nil, nil},
+	} {
+		answers, err := p.ParseLineDNSAnswers(tt.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(answers) != len(tt.names) {
+			t.Fatalf("got %d answers %v; expected %d", len(answers), answers, len(tt.names))
+		}
+		for n := range answers {
+			if answers[n].Name != tt.names[n] || !answers[n].IP.Equal(net.ParseIP(tt.ips[n])) {
+				t.Fatalf("got answer %v; expected %s %s", answers[n], tt.names[n], tt.ips[n])
+			}
+		}
+	}
+}
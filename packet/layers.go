@@ -0,0 +1,233 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Layer types registered by the packet package. Numbers below 1000 are
+// reserved for gopacket/layers.
+var (
+	LayerTypeLinuxSLL2 = gopacket.RegisterLayerType(1800, gopacket.LayerTypeMetadata{
+		Name:    "LinuxSLL2",
+		Decoder: gopacket.DecodeFunc(decodeLinuxSLL2),
+	})
+	LayerTypeERSPAN = gopacket.RegisterLayerType(1801, gopacket.LayerTypeMetadata{
+		Name:    "ERSPAN",
+		Decoder: gopacket.DecodeFunc(decodeERSPAN),
+	})
+)
+
+const (
+	// ethernetTypeERSPAN is the GRE protocol type of ERSPAN type II.
+	ethernetTypeERSPAN layers.EthernetType = 0x88be
+	// ethernetTypeERSPAN3 is the GRE protocol type of ERSPAN type III.
+	ethernetTypeERSPAN3 layers.EthernetType = 0x22eb
+)
+
+// LinkTypeLinuxSLL2 is the pcap link type (DLT_LINUX_SLL2) of Linux "any"
+// captures. gopacket keeps link types in uint8, so it has none for it.
+const LinkTypeLinuxSLL2 = 276
+
+func init() {
+	layers.EthernetTypeMetadata[ethernetTypeERSPAN] = layers.EnumMetadata{
+		DecodeWith: gopacket.DecodeFunc(decodeERSPAN),
+		Name:       "ERSPAN",
+		LayerType:  LayerTypeERSPAN,
+	}
+	layers.EthernetTypeMetadata[ethernetTypeERSPAN3] = layers.EnumMetadata{
+		DecodeWith: gopacket.DecodeFunc(decodeERSPAN),
+		Name:       "ERSPAN",
+		LayerType:  LayerTypeERSPAN,
+	}
+}
+
+// LinkTypeDecoder returns decoder for packets captured with given pcap link type.
+// Unlike layers.LinkType it knows how to decode Linux "any" SLL2 and raw
+// IPv4/IPv6 captures.
+func LinkTypeDecoder(linkType int) gopacket.Decoder {
+	switch linkType {
+	case LinkTypeLinuxSLL2:
+		return LayerTypeLinuxSLL2
+	case int(layers.LinkTypeIPv4):
+		return layers.LayerTypeIPv4
+	case int(layers.LinkTypeIPv6):
+		return layers.LayerTypeIPv6
+	}
+	if linkType > 0xff {
+		return gopacket.DecodeUnknown
+	}
+	return layers.LinkType(linkType)
+}
+
+// LinuxSLL2 is the Linux "cooked" capture encapsulation v2 header.
+type LinuxSLL2 struct {
+	layers.BaseLayer
+	EthernetType   layers.EthernetType
+	InterfaceIndex uint32
+	AddrType       uint16
+	PacketType     layers.LinuxSLLPacketType
+	AddrLen        uint8
+	Addr           net.HardwareAddr
+}
+
+// LayerType returns LayerTypeLinuxSLL2.
+func (sll *LinuxSLL2) LayerType() gopacket.LayerType { return LayerTypeLinuxSLL2 }
+
+// LinkFlow returns link flow with the source address only.
+func (sll *LinuxSLL2) LinkFlow() gopacket.Flow {
+	return gopacket.NewFlow(layers.EndpointMAC, sll.Addr, nil)
+}
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (sll *LinuxSLL2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 20 {
+		return errors.New("Linux SLL2 packet too small")
+	}
+	sll.EthernetType = layers.EthernetType(binary.BigEndian.Uint16(data[0:2]))
+	sll.InterfaceIndex = binary.BigEndian.Uint32(data[4:8])
+	sll.AddrType = binary.BigEndian.Uint16(data[8:10])
+	sll.PacketType = layers.LinuxSLLPacketType(data[10])
+	sll.AddrLen = data[11]
+	if sll.AddrLen > 8 {
+		sll.AddrLen = 8
+	}
+	sll.Addr = net.HardwareAddr(data[12 : 12+sll.AddrLen])
+	sll.BaseLayer = layers.BaseLayer{Contents: data[:20], Payload: data[20:]}
+	return nil
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (sll *LinuxSLL2) CanDecode() gopacket.LayerClass { return LayerTypeLinuxSLL2 }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (sll *LinuxSLL2) NextLayerType() gopacket.LayerType { return sll.EthernetType.LayerType() }
+
+func decodeLinuxSLL2(data []byte, p gopacket.PacketBuilder) error {
+	sll := &LinuxSLL2{}
+	if err := sll.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(sll)
+	p.SetLinkLayer(sll)
+	return p.NextDecoder(sll.EthernetType)
+}
+
+// ERSPAN is the header of the mirrored frame carried in GRE by
+// ERSPAN type II and type III sessions.
+// Type I, which has no header, is not supported.
+type ERSPAN struct {
+	layers.BaseLayer
+	Version   uint8
+	VLAN      uint16
+	SessionID uint16
+}
+
+// LayerType returns LayerTypeERSPAN.
+func (e *ERSPAN) LayerType() gopacket.LayerType { return LayerTypeERSPAN }
+
+// DecodeFromBytes decodes the given bytes into this layer.
+func (e *ERSPAN) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 8 {
+		return errors.New("ERSPAN packet too small")
+	}
+	e.Version = data[0] >> 4
+	e.VLAN = binary.BigEndian.Uint16(data[0:2]) & 0x0fff
+	e.SessionID = binary.BigEndian.Uint16(data[2:4]) & 0x03ff
+
+	var n int
+	switch e.Version {
+	case 1: // type II
+		n = 8
+	case 2: // type III
+		n = 12
+		if len(data) < n {
+			return errors.New("ERSPAN packet too small")
+		}
+		// optional platform specific subheader
+		if data[11]&0x01 != 0 {
+			n += 8
+		}
+	default:
+		return errors.New("unsupported ERSPAN version")
+	}
+	if len(data) < n {
+		return errors.New("ERSPAN packet too small")
+	}
+	e.BaseLayer = layers.BaseLayer{Contents: data[:n], Payload: data[n:]}
+	return nil
+}
+
+// CanDecode returns the set of layer types that this DecodingLayer can decode.
+func (e *ERSPAN) CanDecode() gopacket.LayerClass { return LayerTypeERSPAN }
+
+// NextLayerType returns the layer type contained by this DecodingLayer.
+func (e *ERSPAN) NextLayerType() gopacket.LayerType { return layers.LayerTypeEthernet }
+
+func decodeERSPAN(data []byte, p gopacket.PacketBuilder) error {
+	e := &ERSPAN{}
+	if err := e.DecodeFromBytes(data, p); err != nil {
+		return err
+	}
+	p.AddLayer(e)
+	return p.NextDecoder(layers.LayerTypeEthernet)
+}
+
+// innerLayers holds the innermost frame of a packet. For tunneled
+// traffic (GRE, VXLAN, GENEVE, ERSPAN, IP in IP) those are the layers
+// of the encapsulated packet.
+type innerLayers struct {
+	frame     gopacket.Layer
+	srcMAC    net.HardwareAddr
+	network   gopacket.NetworkLayer
+	transport gopacket.TransportLayer
+	app       gopacket.ApplicationLayer
+}
+
+// decapsulate finds the innermost link, network, transport and application layers.
+func decapsulate(raw gopacket.Packet) *innerLayers {
+	var l innerLayers
+	for _, layer := range raw.Layers() {
+		switch v := layer.(type) {
+		case *layers.Ethernet:
+			l.setFrame(v, v.SrcMAC)
+		case *layers.LinuxSLL:
+			l.setFrame(v, v.Addr)
+		case *LinuxSLL2:
+			l.setFrame(v, v.Addr)
+		case *layers.Dot11:
+			l.setFrame(v, v.Address2)
+		case *layers.Loopback:
+			l.setFrame(v, nil)
+		case gopacket.NetworkLayer:
+			// ip packet without link layer, e.g. ip in ip or gre tunnel
+			if l.frame == nil || l.network != nil {
+				l.frame, l.srcMAC = v, nil
+			}
+			l.network, l.transport, l.app = v, nil, nil
+		case gopacket.TransportLayer:
+			l.transport, l.app = v, nil
+		case gopacket.ApplicationLayer:
+			l.app = v
+		}
+	}
+	return &l
+}
+
+// setFrame starts new frame at given link layer.
+func (l *innerLayers) setFrame(layer gopacket.Layer, srcMAC net.HardwareAddr) {
+	l.frame, l.srcMAC = layer, srcMAC
+	l.network, l.transport, l.app = nil, nil, nil
+}
+
+// length returns the length of the innermost frame.
+func (l *innerLayers) length() int {
+	if l.frame == nil {
+		return 0
+	}
+	return len(l.frame.LayerContents()) + len(l.frame.LayerPayload())
+}
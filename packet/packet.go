@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 
 	"github.com/google/gopacket"
@@ -20,11 +21,38 @@ type Direction int
 
 // List of all packet directions
 const (
-	DirectionUnknown Direction = 0
-	DirectionIn      Direction = 1
-	DirectionOut     Direction = 2
+	DirectionUnknown  Direction = 0
+	DirectionIn       Direction = 1
+	DirectionOut      Direction = 2
+	DirectionInternal Direction = 3 // traffic between two internal hosts
 )
 
+// Networks is a list of networks used to determine packet direction.
+type Networks []*net.IPNet
+
+// NewNetworks parses list of cidrs.
+func NewNetworks(cidrs []string) (Networks, error) {
+	var networks Networks
+	for _, cidr := range cidrs {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, ipnet)
+	}
+	return networks, nil
+}
+
+// Contains returns true if ip belongs to any of networks.
+func (n Networks) Contains(ip net.IP) bool {
+	for _, ipnet := range n {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
 // IPPacket represents single dns query that could be
 // converted to feed AlphaSOC Engine.
 type IPPacket struct {
@@ -42,45 +70,39 @@ type IPPacket struct {
 	Ja3        string
 }
 
-// NewIPPacket creates IPPacket from raw packet.
+// NewIPPacket creates IPPacket from raw packet. Tunneled packets are
+// decapsulated and the innermost ip packet is returned.
 func NewIPPacket(raw gopacket.Packet) *IPPacket {
-	linkLayer := raw.LinkLayer()
-	networkLayer := raw.NetworkLayer()
-	transportLayer := raw.TransportLayer()
 	metadata := raw.Metadata()
+	inner := decapsulate(raw)
 
-	if linkLayer == nil || networkLayer == nil ||
-		transportLayer == nil || metadata == nil {
-		return nil
-	}
-
-	ethernet, ok := linkLayer.(gopacket.Layer).(*layers.Ethernet)
-	if !ok {
+	if inner.frame == nil || inner.network == nil ||
+		inner.transport == nil || metadata == nil {
 		return nil
 	}
 
 	var ippacket = &IPPacket{
 		raw:        raw,
-		srcMAC:     ethernet.SrcMAC,
+		srcMAC:     inner.srcMAC,
 		Timestamp:  metadata.Timestamp,
-		BytesCount: len(raw.Data()),
+		BytesCount: inner.length(),
 		// Ja3:        ja3.Convert(raw),
 	}
-	if lipv4, ok := networkLayer.(gopacket.Layer).(*layers.IPv4); ok {
+	if lipv4, ok := inner.network.(gopacket.Layer).(*layers.IPv4); ok {
 		ippacket.SrcIP = lipv4.SrcIP
 		ippacket.DstIP = lipv4.DstIP
-	} else if lipv6, ok := networkLayer.(gopacket.Layer).(*layers.IPv6); ok {
+	} else if lipv6, ok := inner.network.(gopacket.Layer).(*layers.IPv6); ok {
 		ippacket.SrcIP = lipv6.SrcIP
 		ippacket.DstIP = lipv6.DstIP
 	} else {
 		return nil
 	}
 
-	if tcp, ok := transportLayer.(gopacket.Layer).(*layers.TCP); ok {
+	if tcp, ok := inner.transport.(gopacket.Layer).(*layers.TCP); ok {
 		ippacket.SrcPort = int(tcp.SrcPort)
 		ippacket.DstPort = int(tcp.DstPort)
 		ippacket.Protocol = "tcp"
-	} else if udp, ok := transportLayer.(gopacket.Layer).(*layers.UDP); ok {
+	} else if udp, ok := inner.transport.(gopacket.Layer).(*layers.UDP); ok {
 		ippacket.SrcPort = int(udp.SrcPort)
 		ippacket.DstPort = int(udp.DstPort)
 		ippacket.Protocol = "udp"
@@ -105,6 +127,22 @@ func (p *IPPacket) DetermineDirection(ifaceMac net.HardwareAddr) {
 	}
 }
 
+// DetermineDirectionByNetworks determines packet direction based on home networks.
+// Packet is outgoing if it's sent from home network, and incoming if it's sent to it.
+func (p *IPPacket) DetermineDirectionByNetworks(home Networks) {
+	srcHome, dstHome := home.Contains(p.SrcIP), home.Contains(p.DstIP)
+	switch {
+	case srcHome && dstHome:
+		p.Direction = DirectionInternal
+	case srcHome:
+		p.Direction = DirectionOut
+	case dstHome:
+		p.Direction = DirectionIn
+	default:
+		p.Direction = DirectionUnknown
+	}
+}
+
 // DNSPacket represents single dns query that could be
 // converted to feed AlphaSOC Engine.
 type DNSPacket struct {
@@ -120,13 +158,15 @@ type DNSPacket struct {
 	RecordType string
 }
 
-// NewDNSPacket creates new dns packet from raw packet.
+// NewDNSPacket creates new dns packet from raw packet. Tunneled packets are
+// decapsulated and the innermost dns query is returned.
 func NewDNSPacket(raw gopacket.Packet) *DNSPacket {
 	var (
 		metadata         = raw.Metadata()
-		networkLayer     = raw.NetworkLayer()
-		transportLayer   = raw.TransportLayer()
-		applicationLayer = raw.ApplicationLayer()
+		inner            = decapsulate(raw)
+		networkLayer     = inner.network
+		transportLayer   = inner.transport
+		applicationLayer = inner.app
 	)
 
 	if metadata == nil || networkLayer == nil || transportLayer == nil || applicationLayer == nil {
@@ -170,6 +210,45 @@ func NewDNSPacket(raw gopacket.Packet) *DNSPacket {
 	return dnspacket
 }
 
+// DNSAnswer is a name resolved to an ip address, from dns response.
+type DNSAnswer struct {
+	Timestamp time.Time
+	Name      string
+	IP        net.IP
+}
+
+// NewDNSAnswers returns address records of successful dns response. Tunneled
+// packets are decapsulated. If records are aliases (cname) of the queried name,
+// then the queried name is also returned for each address.
+func NewDNSAnswers(raw gopacket.Packet) []DNSAnswer {
+	metadata := raw.Metadata()
+	inner := decapsulate(raw)
+	if metadata == nil || inner.app == nil {
+		return nil
+	}
+
+	dns, ok := inner.app.(gopacket.Layer).(*layers.DNS)
+	if !ok || !dns.QR || dns.ResponseCode != layers.DNSResponseCodeNoErr || len(dns.Questions) == 0 {
+		return nil
+	}
+
+	var (
+		answers []DNSAnswer
+		query   = strings.ToLower(string(dns.Questions[0].Name))
+	)
+	for _, rr := range dns.Answers {
+		if rr.Type != layers.DNSTypeA && rr.Type != layers.DNSTypeAAAA || rr.IP == nil {
+			continue
+		}
+		name := strings.ToLower(string(rr.Name))
+		answers = append(answers, DNSAnswer{Timestamp: metadata.Timestamp, Name: name, IP: rr.IP})
+		if name != query {
+			answers = append(answers, DNSAnswer{Timestamp: metadata.Timestamp, Name: query, IP: rr.IP})
+		}
+	}
+	return answers
+}
+
 func (p *DNSPacket) String() string {
 	return fmt.Sprintf("%s %s from %s to %s", p.FQDN, p.RecordType, p.SrcIP, p.DstIP)
 }
@@ -43,6 +43,32 @@ func TestDNSPacketEqual(t *testing.T) {
 	require.True(t, packet.Equal(packet), "not equal with itself")
 }
 
+func TestNewDNSAnswers(t *testing.T) {
+	ip := *testTunnelIPv4
+	udp := &layers.UDP{SrcPort: 53, DstPort: 13705}
+	udp.SetNetworkLayerForChecksum(&ip)
+	dns := &layers.DNS{
+		ID: 1, QR: true, RD: true, RA: true,
+		Questions: []layers.DNSQuestion{{Name: []byte("www.alphasoc.net"), Type: layers.DNSTypeA, Class: layers.DNSClassIN}},
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte("www.alphasoc.net"), Type: layers.DNSTypeCNAME, Class: layers.DNSClassIN, TTL: 60, CNAME: []byte("api.alphasoc.net")},
+			{Name: []byte("api.alphasoc.net"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 60, IP: net.IPv4(1, 2, 3, 4)},
+		},
+	}
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	require.NoError(t, gopacket.SerializeLayers(buf, opts, testTunnelEthernet, &ip, udp, dns))
+
+	answers := NewDNSAnswers(gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default))
+	require.Len(t, answers, 2)
+	require.Equal(t, "api.alphasoc.net", answers[0].Name)
+	require.Equal(t, "www.alphasoc.net", answers[1].Name)
+	require.True(t, answers[1].IP.Equal(net.IPv4(1, 2, 3, 4)))
+
+	// queries have no answers
+	require.Empty(t, NewDNSAnswers(gopacket.NewPacket(testPacketDNSQuery, layers.LinkTypeEthernet, gopacket.Default)))
+}
+
 func TestNewIPPacket(t *testing.T) {
 	rawPacket := gopacket.NewPacket(testPacketDNSQuery, layers.LinkTypeEthernet, gopacket.Default)
 	packet := NewIPPacket(rawPacket)
@@ -56,3 +82,132 @@ func TestNewIPPacket(t *testing.T) {
 	require.Equal(t, 53, packet.DstPort)
 	require.Equal(t, DirectionOut, packet.Direction)
 }
+
+// encapsulate serializes given layers and appends the payload to them.
+func encapsulate(t *testing.T, payload []byte, ls ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true}
+	ls = append(ls, gopacket.Payload(payload))
+	require.NoError(t, gopacket.SerializeLayers(buf, opts, ls...))
+	return buf.Bytes()
+}
+
+var (
+	testTunnelEthernet = &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0x0, 0x1, 0x2, 0x3, 0x4, 0x5},
+		DstMAC:       net.HardwareAddr{0x0, 0x5, 0x4, 0x3, 0x2, 0x1},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	testTunnelIPv4 = &layers.IPv4{
+		Version:  4,
+		IHL:      5,
+		TTL:      64,
+		Protocol: layers.IPProtocolUDP,
+		SrcIP:    net.IPv4(192, 168, 0, 1),
+		DstIP:    net.IPv4(192, 168, 0, 2),
+	}
+)
+
+// requireInnerPacket checks if inner packet of testPacketDNSQuery is decoded.
+func requireInnerPacket(t *testing.T, rawPacket gopacket.Packet) {
+	ippacket := NewIPPacket(rawPacket)
+	require.NotNil(t, ippacket)
+	require.True(t, ippacket.SrcIP.Equal(net.IPv4(10, 0, 2, 15)))
+	require.True(t, ippacket.DstIP.Equal(net.IPv4(8, 8, 8, 8)))
+	require.Equal(t, 13705, ippacket.SrcPort)
+	require.Equal(t, testPacketDNSQueryLenght, ippacket.BytesCount)
+
+	ippacket.DetermineDirection(net.HardwareAddr{0x8, 0x0, 0x27, 0xb1, 0x89, 0x1d})
+	require.Equal(t, DirectionOut, ippacket.Direction)
+
+	dnspacket := NewDNSPacket(rawPacket)
+	require.NotNil(t, dnspacket)
+	require.Equal(t, "api.alphasoc.net", dnspacket.FQDN)
+}
+
+func TestNewIPPacketVXLAN(t *testing.T) {
+	udp := &layers.UDP{SrcPort: 50000, DstPort: 4789}
+	udp.SetNetworkLayerForChecksum(testTunnelIPv4)
+	vxlan := []byte{0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x64, 0x00}
+	data := encapsulate(t, append(vxlan, testPacketDNSQuery...), testTunnelEthernet, testTunnelIPv4, udp)
+
+	requireInnerPacket(t, gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default))
+}
+
+func TestNewIPPacketGENEVE(t *testing.T) {
+	udp := &layers.UDP{SrcPort: 50000, DstPort: 6081}
+	udp.SetNetworkLayerForChecksum(testTunnelIPv4)
+	// header with an 8 bytes option, transparent ethernet bridging and vni 100
+	geneve := []byte{
+		0x02, 0x00, 0x65, 0x58, 0x00, 0x00, 0x64, 0x00,
+		0x01, 0x03, 0x80, 0x01, 0x00, 0x00, 0x00, 0x01,
+	}
+	data := encapsulate(t, append(geneve, testPacketDNSQuery...), testTunnelEthernet, testTunnelIPv4, udp)
+
+	rawPacket := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+	require.NotNil(t, rawPacket.Layer(layers.LayerTypeGeneve))
+	requireInnerPacket(t, rawPacket)
+}
+
+func TestNewIPPacketERSPAN(t *testing.T) {
+	ip := *testTunnelIPv4
+	ip.Protocol = layers.IPProtocolGRE
+	gre := &layers.GRE{SeqPresent: true, Seq: 1, Protocol: ethernetTypeERSPAN}
+	erspan := []byte{0x10, 0x64, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}
+	data := encapsulate(t, append(erspan, testPacketDNSQuery...), testTunnelEthernet, &ip, gre)
+
+	rawPacket := gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Default)
+	require.NotNil(t, rawPacket.Layer(LayerTypeERSPAN))
+	requireInnerPacket(t, rawPacket)
+}
+
+func TestNewIPPacketLinuxSLL2(t *testing.T) {
+	sll2 := []byte{
+		0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+		0x00, 0x01, 0x04, 0x06, 0x08, 0x00, 0x27, 0xb1,
+		0x89, 0x1d, 0x00, 0x00,
+	}
+	data := append(sll2, testPacketDNSQuery[14:]...)
+
+	rawPacket := gopacket.NewPacket(data, LinkTypeDecoder(LinkTypeLinuxSLL2), gopacket.Default)
+	ippacket := NewIPPacket(rawPacket)
+	require.NotNil(t, ippacket)
+	require.True(t, ippacket.SrcIP.Equal(net.IPv4(10, 0, 2, 15)))
+
+	ippacket.DetermineDirection(net.HardwareAddr{0x8, 0x0, 0x27, 0xb1, 0x89, 0x1d})
+	require.Equal(t, DirectionOut, ippacket.Direction)
+}
+
+func TestNewIPPacketRaw(t *testing.T) {
+	rawPacket := gopacket.NewPacket(testPacketDNSQuery[14:], LinkTypeDecoder(int(layers.LinkTypeIPv4)), gopacket.Default)
+	ippacket := NewIPPacket(rawPacket)
+	require.NotNil(t, ippacket)
+	require.Equal(t, "udp", ippacket.Protocol)
+	require.Equal(t, testPacketDNSQueryLenght-14, ippacket.BytesCount)
+	require.NotNil(t, NewDNSPacket(rawPacket))
+}
+
+func TestDetermineDirectionByNetworks(t *testing.T) {
+	home, err := NewNetworks([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	packet := NewIPPacket(gopacket.NewPacket(testPacketDNSQuery, layers.LinkTypeEthernet, gopacket.Default))
+	require.NotNil(t, packet)
+
+	for _, tt := range []struct {
+		srcIP, dstIP net.IP
+		direction    Direction
+	}{
+		{net.IPv4(10, 0, 2, 15), net.IPv4(8, 8, 8, 8), DirectionOut},
+		{net.IPv4(8, 8, 8, 8), net.IPv4(10, 0, 2, 15), DirectionIn},
+		{net.IPv4(10, 0, 2, 15), net.IPv4(10, 0, 2, 16), DirectionInternal},
+		{net.IPv4(8, 8, 8, 8), net.IPv4(8, 8, 4, 4), DirectionUnknown},
+	} {
+		packet.SrcIP, packet.DstIP = tt.srcIP, tt.dstIP
+		packet.DetermineDirectionByNetworks(home)
+		require.Equal(t, tt.direction, packet.Direction, "%s -> %s", tt.srcIP, tt.dstIP)
+	}
+
+	_, err = NewNetworks([]string{"10.0.0.0"})
+	require.Error(t, err)
+}
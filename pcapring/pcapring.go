@@ -0,0 +1,502 @@
+// Package pcapring keeps recent packets on disk in a ring of pcap files,
+// indexed by host ip address and time, so packets of a host around an
+// alert can be extracted to a pcap file.
+package pcapring
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// Default limits of the ring.
+const (
+	DefaultMaxSize         = 1024 * 1024 * 1024
+	DefaultMaxAge          = time.Hour
+	DefaultSegmentSize     = 64 * 1024 * 1024
+	DefaultSegmentInterval = time.Minute
+)
+
+// snaplen of pcap files header.
+const snaplen = 65536
+
+// pcap file and packet header sizes.
+const (
+	fileHeaderSize   = 24
+	packetHeaderSize = 16
+)
+
+// Config of the ring. Zero values are defaults.
+type Config struct {
+	// MaxSize of all pcap files in bytes. The oldest files are removed above the limit.
+	MaxSize int64
+	// MaxAge of packets. Files with older packets are removed.
+	MaxAge time.Duration
+	// SegmentSize is the maximum size of a single pcap file in bytes.
+	SegmentSize int64
+	// SegmentInterval is the maximum time range of packets in a single pcap file.
+	SegmentInterval time.Duration
+}
+
+// segment is a pcap file of the ring, with index of its packets.
+type segment struct {
+	file     string
+	linkType layers.LinkType
+	start    time.Time
+	end      time.Time
+	size     int64
+	// hosts are ip addresses of packets, as 16 byte strings.
+	hosts map[string]struct{}
+}
+
+// segmentIndex is the index of segment stored next to its pcap file.
+type segmentIndex struct {
+	LinkType layers.LinkType `json:"linkType"`
+	Start    time.Time       `json:"start"`
+	End      time.Time       `json:"end"`
+	Size     int64           `json:"size"`
+	Hosts    []net.IP        `json:"hosts"`
+}
+
+// Ring of pcap files with recent packets.
+type Ring struct {
+	dir string
+	cfg Config
+
+	mx       sync.Mutex
+	segments []*segment
+	// current segment written, it's also the last one of segments.
+	cur *segment
+	f   *os.File
+	bw  *bufio.Writer
+	w   *pcapgo.Writer
+}
+
+// New creates the ring in the dir. Pcap files left in the dir are kept,
+// if they are within the limits.
+func New(dir string, cfg Config) (*Ring, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = DefaultMaxSize
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = DefaultMaxAge
+	}
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = DefaultSegmentSize
+	}
+	if cfg.SegmentInterval <= 0 {
+		cfg.SegmentInterval = DefaultSegmentInterval
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "ring-*.pcap"))
+	if err != nil {
+		return nil, err
+	}
+	r := &Ring{dir: dir, cfg: cfg}
+	for _, file := range files {
+		seg, err := loadSegment(file)
+		if err != nil {
+			// file of the segment written when nfr was stopped may be broken
+			removeSegment(file)
+			continue
+		}
+		r.segments = append(r.segments, seg)
+	}
+	sort.Slice(r.segments, func(i, j int) bool {
+		return r.segments[i].start.Before(r.segments[j].start)
+	})
+	if len(r.segments) > 0 {
+		r.expire(r.segments[len(r.segments)-1].end)
+	}
+	return r, nil
+}
+
+// Write writes the packet to the ring. Packets without ip layer are skipped.
+func (r *Ring) Write(p gopacket.Packet) error {
+	var ips []net.IP
+	for _, layer := range p.Layers() {
+		switch l := layer.(type) {
+		case *layers.IPv4:
+			ips = append(ips, l.SrcIP, l.DstIP)
+		case *layers.IPv6:
+			ips = append(ips, l.SrcIP, l.DstIP)
+		}
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+
+	data := p.Data()
+	ci := p.Metadata().CaptureInfo
+	if ci.Timestamp.IsZero() {
+		ci.Timestamp = time.Now()
+	}
+	ci.CaptureLength = len(data)
+	if ci.Length < ci.CaptureLength {
+		ci.Length = ci.CaptureLength
+	}
+	linkType := packetLinkType(p)
+	size := int64(packetHeaderSize + len(data))
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	if r.cur == nil ||
+		r.cur.linkType != linkType ||
+		r.cur.size+size > r.cfg.SegmentSize ||
+		ci.Timestamp.Sub(r.cur.start) >= r.cfg.SegmentInterval {
+		if err := r.rotate(ci.Timestamp, linkType); err != nil {
+			return err
+		}
+	}
+
+	if err := r.w.WritePacket(ci, data); err != nil {
+		return err
+	}
+	r.cur.size += size
+	if ci.Timestamp.After(r.cur.end) {
+		r.cur.end = ci.Timestamp
+	}
+	for _, ip := range ips {
+		key := string(ip.To16())
+		if _, ok := r.cur.hosts[key]; !ok {
+			r.cur.hosts[key] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// rotate closes the current segment, and opens a new one starting at ts.
+// Expired segments are removed. It must be called with the lock held.
+func (r *Ring) rotate(ts time.Time, linkType layers.LinkType) error {
+	if err := r.closeSegment(); err != nil {
+		return err
+	}
+
+	seg := &segment{
+		file:     filepath.Join(r.dir, fmt.Sprintf("ring-%d.pcap", ts.UnixNano())),
+		linkType: linkType,
+		start:    ts,
+		end:      ts,
+		size:     fileHeaderSize,
+		hosts:    make(map[string]struct{}),
+	}
+	f, err := os.Create(seg.file)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	w := pcapgo.NewWriter(bw)
+	if err := w.WriteFileHeader(snaplen, linkType); err != nil {
+		f.Close()
+		return err
+	}
+
+	r.f, r.bw, r.w = f, bw, w
+	r.cur = seg
+	r.segments = append(r.segments, seg)
+	r.expire(ts)
+	return nil
+}
+
+// closeSegment flushes and closes file of the current segment, and writes
+// its index. It must be called with the lock held.
+func (r *Ring) closeSegment() error {
+	if r.cur == nil {
+		return nil
+	}
+	seg := r.cur
+	r.cur = nil
+
+	if err := r.bw.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+
+	index := segmentIndex{
+		LinkType: seg.linkType,
+		Start:    seg.start,
+		End:      seg.end,
+		Size:     seg.size,
+		Hosts:    make([]net.IP, 0, len(seg.hosts)),
+	}
+	for key := range seg.hosts {
+		index.Hosts = append(index.Hosts, net.IP(key))
+	}
+	b, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(indexFile(seg.file), b, 0644)
+}
+
+// expire removes the oldest segments above the size limit, and segments
+// with packets older than max age at now. The current segment is kept.
+// It must be called with the lock held.
+func (r *Ring) expire(now time.Time) {
+	var size int64
+	for _, seg := range r.segments {
+		size += seg.size
+	}
+	for len(r.segments) > 0 && r.segments[0] != r.cur {
+		seg := r.segments[0]
+		if size <= r.cfg.MaxSize && now.Sub(seg.end) <= r.cfg.MaxAge {
+			break
+		}
+		removeSegment(seg.file)
+		size -= seg.size
+		r.segments = r.segments[1:]
+	}
+}
+
+// Has checks if the ring has packets from or to the ip address, captured
+// between from and to time. Only the index is checked, not the packets.
+func (r *Ring) Has(ip net.IP, from, to time.Time) bool {
+	key := string(ip.To16())
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	for _, seg := range r.segments {
+		if seg.end.Before(from) || seg.start.After(to) {
+			continue
+		}
+		if _, ok := seg.hosts[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Extract writes packets from or to the ip address, captured between from
+// and to time, to the pcap file. It returns the number of written packets.
+// If there are no packets, then the file is not created.
+func (r *Ring) Extract(ip net.IP, from, to time.Time, file string) (int, error) {
+	key := string(ip.To16())
+
+	r.mx.Lock()
+	var segments []segment
+	for _, seg := range r.segments {
+		if seg.end.Before(from) || seg.start.After(to) {
+			continue
+		}
+		if _, ok := seg.hosts[key]; ok {
+			segments = append(segments, *seg)
+		}
+	}
+	if r.cur != nil && len(segments) > 0 && segments[len(segments)-1].file == r.cur.file {
+		if err := r.bw.Flush(); err != nil {
+			r.mx.Unlock()
+			return 0, err
+		}
+	}
+	r.mx.Unlock()
+
+	if len(segments) == 0 {
+		return 0, nil
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return 0, err
+	}
+	w := pcapgo.NewWriter(f)
+	if err := w.WriteFileHeader(snaplen, segments[0].linkType); err != nil {
+		f.Close()
+		os.Remove(file)
+		return 0, err
+	}
+
+	var n int
+	for _, seg := range segments {
+		// packets of other link type can't be written to the same file
+		if seg.linkType != segments[0].linkType {
+			continue
+		}
+		written, err := extractSegment(seg.file, w, func(ci gopacket.CaptureInfo, p gopacket.Packet) bool {
+			if ci.Timestamp.Before(from) || ci.Timestamp.After(to) {
+				return false
+			}
+			return hasHost(p, ip)
+		})
+		n += written
+		if err != nil && !os.IsNotExist(err) {
+			f.Close()
+			os.Remove(file)
+			return 0, err
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		os.Remove(file)
+		return 0, err
+	}
+	if n == 0 {
+		os.Remove(file)
+	}
+	return n, nil
+}
+
+// Close flushes and closes the current pcap file.
+func (r *Ring) Close() error {
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	return r.closeSegment()
+}
+
+// extractSegment writes packets of the pcap file matching the filter to w.
+// The file may be written at the same time, so partially written packet
+// at the end of the file is skipped.
+func extractSegment(file string, w *pcapgo.Writer, match func(gopacket.CaptureInfo, gopacket.Packet) bool) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	pr, err := pcapgo.NewReader(f)
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for {
+		data, ci, err := pr.ReadPacketData()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		p := gopacket.NewPacket(data, pr.LinkType(), gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		if !match(ci, p) {
+			continue
+		}
+		if err := w.WritePacket(ci, data); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// loadSegment loads index of the pcap file, or builds it from packets
+// if index file is missing.
+func loadSegment(file string) (*segment, error) {
+	seg := &segment{file: file, hosts: make(map[string]struct{})}
+
+	if b, err := ioutil.ReadFile(indexFile(file)); err == nil {
+		var index segmentIndex
+		if err := json.Unmarshal(b, &index); err == nil {
+			seg.linkType = index.LinkType
+			seg.start, seg.end, seg.size = index.Start, index.End, index.Size
+			for _, ip := range index.Hosts {
+				seg.hosts[string(ip.To16())] = struct{}{}
+			}
+			return seg, nil
+		}
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	pr, err := pcapgo.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	seg.linkType = pr.LinkType()
+	seg.size = fileHeaderSize
+	for {
+		data, ci, err := pr.ReadPacketData()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if seg.start.IsZero() || ci.Timestamp.Before(seg.start) {
+			seg.start = ci.Timestamp
+		}
+		if ci.Timestamp.After(seg.end) {
+			seg.end = ci.Timestamp
+		}
+		seg.size += int64(packetHeaderSize + len(data))
+
+		p := gopacket.NewPacket(data, pr.LinkType(), gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		for _, layer := range p.Layers() {
+			switch l := layer.(type) {
+			case *layers.IPv4:
+				seg.hosts[string(l.SrcIP.To16())] = struct{}{}
+				seg.hosts[string(l.DstIP.To16())] = struct{}{}
+			case *layers.IPv6:
+				seg.hosts[string(l.SrcIP.To16())] = struct{}{}
+				seg.hosts[string(l.DstIP.To16())] = struct{}{}
+			}
+		}
+	}
+	if seg.start.IsZero() {
+		return nil, fmt.Errorf("no packets in %s", file)
+	}
+	return seg, nil
+}
+
+// hasHost returns true if the packet is from or to the ip address.
+func hasHost(p gopacket.Packet, ip net.IP) bool {
+	for _, layer := range p.Layers() {
+		switch l := layer.(type) {
+		case *layers.IPv4:
+			if l.SrcIP.Equal(ip) || l.DstIP.Equal(ip) {
+				return true
+			}
+		case *layers.IPv6:
+			if l.SrcIP.Equal(ip) || l.DstIP.Equal(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// packetLinkType returns link type of the packet by its first layer.
+func packetLinkType(p gopacket.Packet) layers.LinkType {
+	if ls := p.Layers(); len(ls) > 0 {
+		switch ls[0].LayerType() {
+		case layers.LayerTypeLinuxSLL:
+			return layers.LinkTypeLinuxSLL
+		case layers.LayerTypeLoopback:
+			return layers.LinkTypeNull
+		case layers.LayerTypeIPv4, layers.LayerTypeIPv6:
+			return layers.LinkTypeRaw
+		}
+	}
+	return layers.LinkTypeEthernet
+}
+
+// indexFile returns index file of the segment pcap file.
+func indexFile(file string) string {
+	return strings.TrimSuffix(file, ".pcap") + ".json"
+}
+
+// removeSegment removes pcap and index files of the segment.
+func removeSegment(file string) {
+	os.Remove(file)
+	os.Remove(indexFile(file))
+}
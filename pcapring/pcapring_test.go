@@ -0,0 +1,166 @@
+package pcapring
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+func newTestPacket(t *testing.T, ts time.Time, src, dst net.IP) gopacket.Packet {
+	eth := &layers.Ethernet{
+		SrcMAC:       net.HardwareAddr{0, 1, 2, 3, 4, 5},
+		DstMAC:       net.HardwareAddr{5, 4, 3, 2, 1, 0},
+		EthernetType: layers.EthernetTypeIPv4,
+	}
+	ip := &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: src, DstIP: dst}
+	udp := &layers.UDP{SrcPort: 51234, DstPort: 53}
+	udp.SetNetworkLayerForChecksum(ip)
+
+	buf := gopacket.NewSerializeBuffer()
+	opts := gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}
+	if err := gopacket.SerializeLayers(buf, opts, eth, ip, udp, gopacket.Payload("payload")); err != nil {
+		t.Fatal(err)
+	}
+	p := gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+	p.Metadata().Timestamp = ts
+	p.Metadata().CaptureLength = len(buf.Bytes())
+	p.Metadata().Length = len(buf.Bytes())
+	return p
+}
+
+func readPackets(t *testing.T, file string) []gopacket.Packet {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packets []gopacket.Packet
+	for {
+		data, _, err := r.ReadPacketData()
+		if err != nil {
+			return packets
+		}
+		packets = append(packets, gopacket.NewPacket(data, r.LinkType(), gopacket.Default))
+	}
+}
+
+func TestRingExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-pcapring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := New(filepath.Join(dir, "ring"), Config{SegmentInterval: 10 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		host  = net.IPv4(10, 0, 0, 1)
+		other = net.IPv4(10, 0, 0, 2)
+		dns   = net.IPv4(8, 8, 8, 8)
+		ts    = time.Now().Add(-time.Minute).Truncate(time.Second)
+	)
+	for i := 0; i < 30; i++ {
+		src := host
+		if i%2 == 1 {
+			src = other
+		}
+		if err := r.Write(newTestPacket(t, ts.Add(time.Duration(i)*time.Second), src, dns)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !r.Has(host, ts.Add(5*time.Second), ts.Add(25*time.Second)) || r.Has(net.IPv4(10, 0, 0, 3), ts, ts.Add(time.Minute)) ||
+		r.Has(host, ts.Add(time.Hour), ts.Add(2*time.Hour)) {
+		t.Fatal("invalid packets of hosts in the ring")
+	}
+
+	file := filepath.Join(dir, "alert.pcap")
+	n, err := r.Extract(host, ts.Add(5*time.Second), ts.Add(25*time.Second), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets := readPackets(t, file)
+	if n != 10 || len(packets) != 10 {
+		t.Fatalf("got %d extracted packets and %d in file; expected 10", n, len(packets))
+	}
+	for _, p := range packets {
+		if ip, ok := p.NetworkLayer().(*layers.IPv4); !ok || !ip.SrcIP.Equal(host) {
+			t.Fatalf("invalid extracted packet %v", p)
+		}
+	}
+
+	// no file is written without packets of the host
+	file = filepath.Join(dir, "none.pcap")
+	if n, err := r.Extract(net.IPv4(10, 0, 0, 3), ts, ts.Add(time.Minute), file); n != 0 || err != nil {
+		t.Fatalf("got %d packets of unknown host: %v", n, err)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatal("file written without packets")
+	}
+
+	// segments are loaded after restart, also the last one without index
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "ring", "ring-*.json"))
+	os.Remove(segments[len(segments)-1])
+
+	r, err = New(filepath.Join(dir, "ring"), Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := r.Extract(other, ts, ts.Add(time.Minute), filepath.Join(dir, "other.pcap")); n != 15 || err != nil {
+		t.Fatalf("got %d packets after restart; expected 15: %v", n, err)
+	}
+}
+
+func TestRingLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-pcapring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r, err := New(dir, Config{MaxAge: 20 * time.Second, SegmentInterval: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := net.IPv4(10, 0, 0, 1)
+	ts := time.Now().Truncate(time.Second)
+	for i := 0; i < 60; i++ {
+		if err := r.Write(newTestPacket(t, ts.Add(time.Duration(i)*time.Second), host, net.IPv4(8, 8, 8, 8))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := r.Extract(host, ts, ts.Add(30*time.Second), filepath.Join(dir, "old.pcap")); n != 0 || err != nil {
+		t.Fatalf("got %d expired packets: %v", n, err)
+	}
+	if n, err := r.Extract(host, ts.Add(40*time.Second), ts.Add(time.Minute), filepath.Join(dir, "new.pcap")); n != 20 || err != nil {
+		t.Fatalf("got %d recent packets; expected 20: %v", n, err)
+	}
+
+	r, err = New(dir, Config{MaxSize: 500, SegmentInterval: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "ring-*.pcap"))
+	if len(files) != 1 {
+		t.Fatalf("got %d files above size limit; expected 1", len(files))
+	}
+}
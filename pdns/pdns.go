@@ -0,0 +1,297 @@
+// Package pdns keeps passive dns records, i.e. names resolved to ip addresses
+// seen in dns responses, so ip events and alerts can be described by names.
+package pdns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default limits of the cache.
+const (
+	DefaultMaxAddresses = 100000
+	DefaultMaxNames     = 10
+	DefaultRetention    = 7 * 24 * time.Hour
+)
+
+// Record of a name resolved to an ip address.
+type Record struct {
+	IP        net.IP    `json:"ip"`
+	Name      string    `json:"name"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+	Count     int       `json:"count"`
+}
+
+// Config of the cache. Zero values are defaults.
+type Config struct {
+	// MaxAddresses is the maximum number of ip addresses in the cache.
+	// Addresses with the oldest records are removed above the limit.
+	MaxAddresses int
+	// MaxNames is the maximum number of names of an ip address.
+	// The least recently seen names are removed above the limit.
+	MaxNames int
+	// Retention of records, since they were last seen.
+	Retention time.Duration
+}
+
+// Cache of passive dns records, indexed by ip address. Records are
+// stored in a json file by Save, and loaded when the cache is created.
+type Cache struct {
+	file string
+	cfg  Config
+
+	mx      sync.RWMutex
+	records map[string][]*Record
+	changed bool
+}
+
+// New creates the cache, with records loaded from the file if it exists.
+// If file is empty, then records are kept only in memory.
+func New(file string, cfg Config) (*Cache, error) {
+	if cfg.MaxAddresses <= 0 {
+		cfg.MaxAddresses = DefaultMaxAddresses
+	}
+	if cfg.MaxNames <= 0 {
+		cfg.MaxNames = DefaultMaxNames
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultRetention
+	}
+
+	c := &Cache{file: file, cfg: cfg, records: make(map[string][]*Record)}
+	if file == "" {
+		return c, nil
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var records []*Record
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		key := r.IP.String()
+		c.records[key] = append(c.records[key], r)
+	}
+	c.prune(time.Now())
+	return c, nil
+}
+
+// Open opens the cache file for lookups.
+func Open(file string) (*Cache, error) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+	return New(file, Config{})
+}
+
+// Add adds name resolved to the ip address at ts.
+func (c *Cache) Add(ts time.Time, name string, ip net.IP) {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	if name == "" || ip == nil || ip.IsUnspecified() {
+		return
+	}
+	key := ip.String()
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.changed = true
+	records := c.records[key]
+	for _, r := range records {
+		if r.Name != name {
+			continue
+		}
+		if ts.After(r.LastSeen) {
+			r.LastSeen = ts
+		}
+		if ts.Before(r.FirstSeen) {
+			r.FirstSeen = ts
+		}
+		r.Count++
+		return
+	}
+
+	r := &Record{IP: ip, Name: name, FirstSeen: ts, LastSeen: ts, Count: 1}
+	if len(records) >= c.cfg.MaxNames {
+		// replace the least recently seen name
+		oldest := 0
+		for n := range records {
+			if records[n].LastSeen.Before(records[oldest].LastSeen) {
+				oldest = n
+			}
+		}
+		records[oldest] = r
+		return
+	}
+	c.records[key] = append(records, r)
+
+	if len(c.records) > c.cfg.MaxAddresses {
+		c.prune(time.Now())
+	}
+}
+
+// prune removes expired records, and addresses above the limit, least
+// recently seen first. To not prune on each add, addresses are removed
+// down to 90% of the limit. It must be called with the lock held.
+func (c *Cache) prune(now time.Time) {
+	type address struct {
+		key      string
+		lastSeen time.Time
+	}
+	var addresses []address
+
+	for key, records := range c.records {
+		var (
+			kept     = records[:0]
+			lastSeen time.Time
+		)
+		for _, r := range records {
+			if now.Sub(r.LastSeen) > c.cfg.Retention {
+				c.changed = true
+				continue
+			}
+			kept = append(kept, r)
+			if r.LastSeen.After(lastSeen) {
+				lastSeen = r.LastSeen
+			}
+		}
+		if len(kept) == 0 {
+			delete(c.records, key)
+			continue
+		}
+		c.records[key] = kept
+		addresses = append(addresses, address{key, lastSeen})
+	}
+
+	if len(addresses) <= c.cfg.MaxAddresses {
+		return
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].lastSeen.Before(addresses[j].lastSeen)
+	})
+	for _, a := range addresses[:len(addresses)-c.cfg.MaxAddresses*9/10] {
+		delete(c.records, a.key)
+	}
+	c.changed = true
+}
+
+// Lookup returns records of the ip address, the most recently seen first.
+func (c *Cache) Lookup(ip net.IP) []Record {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	records := make([]Record, 0, len(c.records[ip.String()]))
+	for _, r := range c.records[ip.String()] {
+		records = append(records, *r)
+	}
+	sortRecords(records)
+	return records
+}
+
+// LookupName returns records of the name, the most recently seen first.
+func (c *Cache) LookupName(name string) []Record {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	var records []Record
+	for _, rs := range c.records {
+		for _, r := range rs {
+			if r.Name == name {
+				records = append(records, *r)
+			}
+		}
+	}
+	sortRecords(records)
+	return records
+}
+
+// Name returns the name resolved to the ip address most recently before ts,
+// or the most recently seen name, if none was seen before ts. It returns
+// empty string if the address is unknown.
+func (c *Cache) Name(ip net.IP, ts time.Time) string {
+	if ip == nil {
+		return ""
+	}
+
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	var before, latest *Record
+	for _, r := range c.records[ip.String()] {
+		if latest == nil || r.LastSeen.After(latest.LastSeen) {
+			latest = r
+		}
+		if !r.FirstSeen.After(ts) && (before == nil || r.LastSeen.After(before.LastSeen)) {
+			before = r
+		}
+	}
+	switch {
+	case before != nil:
+		return before.Name
+	case latest != nil:
+		return latest.Name
+	}
+	return ""
+}
+
+// Len returns the number of ip addresses in the cache.
+func (c *Cache) Len() int {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+	return len(c.records)
+}
+
+// Save removes expired records, and writes the cache to the file if it changed.
+func (c *Cache) Save() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.prune(time.Now())
+	if c.file == "" || !c.changed {
+		return nil
+	}
+
+	var records []*Record
+	for _, rs := range c.records {
+		records = append(records, rs...)
+	}
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	tmp := c.file + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, c.file); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
+
+func sortRecords(records []Record) {
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].LastSeen.Equal(records[j].LastSeen) {
+			return records[i].LastSeen.After(records[j].LastSeen)
+		}
+		if records[i].Name != records[j].Name {
+			return records[i].Name < records[j].Name
+		}
+		return records[i].IP.String() < records[j].IP.String()
+	})
+}
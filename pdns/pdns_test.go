@@ -0,0 +1,90 @@
+package pdns
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-pdns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "pdns.json")
+
+	c, err := New(file, Config{MaxNames: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ip := net.IPv4(35, 196, 211, 126)
+	ts := time.Now().Add(-time.Hour).Truncate(time.Second)
+	c.Add(ts, "Alphasoc.com.", ip)
+	c.Add(ts.Add(time.Minute), "alphasoc.com", ip)
+	c.Add(ts.Add(2*time.Minute), "www.alphasoc.com", ip)
+
+	records := c.Lookup(ip)
+	if len(records) != 2 ||
+		records[0].Name != "www.alphasoc.com" ||
+		records[1].Name != "alphasoc.com" ||
+		records[1].Count != 2 ||
+		!records[1].FirstSeen.Equal(ts) ||
+		!records[1].LastSeen.Equal(ts.Add(time.Minute)) {
+		t.Fatalf("invalid records %+v", records)
+	}
+
+	if name := c.Name(ip, ts.Add(90*time.Second)); name != "alphasoc.com" {
+		t.Fatalf("got name %s before event; expected alphasoc.com", name)
+	}
+	if name := c.Name(ip, ts.Add(-time.Hour)); name != "www.alphasoc.com" {
+		t.Fatalf("got name %s; expected latest www.alphasoc.com", name)
+	}
+	if name := c.Name(net.IPv4(10, 0, 0, 1), ts); name != "" {
+		t.Fatalf("got name %s of unknown address", name)
+	}
+
+	// the least recently seen name is replaced above the limit
+	c.Add(ts.Add(3*time.Minute), "api.alphasoc.com", ip)
+	if records := c.Lookup(ip); len(records) != 2 || records[1].Name != "www.alphasoc.com" {
+		t.Fatalf("invalid records %+v", records)
+	}
+
+	if err := c.Save(); err != nil {
+		t.Fatal(err)
+	}
+	c, err = Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records := c.LookupName("api.alphasoc.com"); len(records) != 1 || !records[0].IP.Equal(ip) {
+		t.Fatalf("invalid records of name %+v", records)
+	}
+}
+
+func TestCacheLimits(t *testing.T) {
+	c, err := New("", Config{MaxAddresses: 10, Retention: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	c.Add(now.Add(-2*time.Hour), "expired.alphasoc.com", net.IPv4(10, 0, 1, 1))
+	for i := 0; i < 11; i++ {
+		c.Add(now.Add(time.Duration(i)*time.Second), "alphasoc.com", net.IPv4(10, 0, 0, byte(i)))
+	}
+
+	if c.Len() != 9 {
+		t.Fatalf("got %d addresses; expected 9", c.Len())
+	}
+	if len(c.Lookup(net.IPv4(10, 0, 1, 1))) != 0 || len(c.Lookup(net.IPv4(10, 0, 0, 1))) != 0 {
+		t.Fatal("expired and least recently seen addresses not removed")
+	}
+	if len(c.Lookup(net.IPv4(10, 0, 0, 10))) != 1 {
+		t.Fatal("recently seen address removed")
+	}
+}
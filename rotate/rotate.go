@@ -0,0 +1,267 @@
+// Package rotate provides files rotated by size and time, with retention
+// of rotated files, and reopened on demand for external log rotation.
+package rotate
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the format of rotated file suffix.
+const rotatedTimeFormat = "20060102-150405"
+
+// Config of rotation. Zero value disables rotation.
+type Config struct {
+	// MaxSize of a file in bytes, after which it's rotated.
+	MaxSize int64
+	// Interval after which a file is rotated.
+	Interval time.Duration
+	// MaxFiles is the number of rotated files kept. If 0, then all are kept.
+	MaxFiles int
+	// Compress rotated files with gzip.
+	Compress bool
+}
+
+// File is a file rotated by size and time. Rotated files are named after
+// the file with rotation time suffix, e.g. nfr.log.20210304-101500.
+type File struct {
+	name string
+	cfg  Config
+
+	mx     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	// wg waits for compression of rotated files.
+	wg sync.WaitGroup
+}
+
+var (
+	filesMx sync.Mutex
+	files   = make(map[*File]struct{})
+)
+
+// Open opens file for appending, and rotates it according to cfg.
+func Open(name string, cfg Config) (*File, error) {
+	f := &File{name: name, cfg: cfg}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	filesMx.Lock()
+	files[f] = struct{}{}
+	filesMx.Unlock()
+	return f, nil
+}
+
+// open opens the file. It must be called with the lock held.
+func (f *File) open() error {
+	file, err := os.OpenFile(f.name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.f = file
+	f.size = stat.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if needed.
+func (f *File) Write(p []byte) (int, error) {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.f == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(len(p)) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// shouldRotate checks if the file should be rotated before writing n bytes.
+func (f *File) shouldRotate(n int) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.cfg.MaxSize > 0 && f.size+int64(n) > f.cfg.MaxSize {
+		return true
+	}
+	return f.cfg.Interval > 0 && time.Since(f.opened) >= f.cfg.Interval
+}
+
+// Rotate rotates the file.
+func (f *File) Rotate() error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+	return f.rotate()
+}
+
+// rotate renames current file and opens the new one. It must be called with the lock held.
+// If the file can't be opened again, then it stays closed and writes fail.
+func (f *File) rotate() error {
+	err := f.f.Close()
+	f.f = nil
+	if err != nil {
+		// keep writing to the current file
+		f.open()
+		return err
+	}
+
+	rotated := f.name + "." + time.Now().Format(rotatedTimeFormat)
+	for n := 1; exists(rotated) || exists(rotated+".gz"); n++ {
+		rotated = fmt.Sprintf("%s.%s.%d", f.name, time.Now().Format(rotatedTimeFormat), n)
+	}
+	if err := os.Rename(f.name, rotated); err != nil {
+		// keep writing to the current file
+		f.open()
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if f.cfg.Compress {
+			compress(rotated)
+		}
+		f.removeOld()
+	}()
+	return nil
+}
+
+// Reopen closes and opens the file again, e.g. after it was moved by logrotate.
+func (f *File) Reopen() error {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	if f.f == nil {
+		return os.ErrClosed
+	}
+	f.f.Close()
+	f.f = nil
+	return f.open()
+}
+
+// Close closes the file and waits for compression of rotated files.
+func (f *File) Close() error {
+	filesMx.Lock()
+	delete(files, f)
+	filesMx.Unlock()
+
+	f.mx.Lock()
+	var err error
+	if f.f != nil {
+		err = f.f.Close()
+		f.f = nil
+	}
+	f.mx.Unlock()
+
+	f.wg.Wait()
+	return err
+}
+
+// Rotated returns rotated files, from the oldest one.
+func (f *File) Rotated() ([]string, error) {
+	matches, err := filepath.Glob(f.name + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	var rotated []string
+	for _, match := range matches {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(match, f.name+"."), ".gz")
+		if len(suffix) < len(rotatedTimeFormat) {
+			continue
+		}
+		if _, err := time.Parse(rotatedTimeFormat, suffix[:len(rotatedTimeFormat)]); err == nil {
+			rotated = append(rotated, match)
+		}
+	}
+	sort.Slice(rotated, func(i, j int) bool {
+		return strings.TrimSuffix(rotated[i], ".gz") < strings.TrimSuffix(rotated[j], ".gz")
+	})
+	return rotated, nil
+}
+
+// removeOld removes the oldest rotated files above the limit.
+func (f *File) removeOld() {
+	if f.cfg.MaxFiles <= 0 {
+		return
+	}
+	rotated, err := f.Rotated()
+	if err != nil {
+		return
+	}
+	for n := 0; n < len(rotated)-f.cfg.MaxFiles; n++ {
+		os.Remove(rotated[n])
+	}
+}
+
+// ReopenAll reopens all open files.
+func ReopenAll() error {
+	filesMx.Lock()
+	defer filesMx.Unlock()
+
+	var err error
+	for f := range files {
+		if rerr := f.Reopen(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// compress compresses the file with gzip, and removes it.
+func compress(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(name + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,155 @@
+package rotate
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileRotateSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "alerts.json")
+
+	f, err := Open(name, Config{MaxSize: 10, MaxFiles: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"alert 1\n", "alert 2\n", "alert 3\n", "alert 4\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		// rotated files names have seconds resolution
+		f.wg.Wait()
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "alert 4\n" {
+		t.Fatalf("invalid current file content %q", b)
+	}
+
+	rotated, err := f.Rotated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("invalid number of rotated files - got %d; expected %d", len(rotated), 2)
+	}
+	for n, expected := range []string{"alert 2\n", "alert 3\n"} {
+		if !strings.HasSuffix(rotated[n], ".gz") {
+			t.Fatalf("rotated file %s not compressed", rotated[n])
+		}
+		zf, err := os.Open(rotated[n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(zf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(zr)
+		zf.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Fatalf("invalid %s content - got %q; expected %q", rotated[n], b, expected)
+		}
+	}
+}
+
+func TestFileRotateInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "nfr.log")
+
+	f, err := Open(name, Config{Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("first\n"))
+	f.opened = f.opened.Add(-time.Hour)
+	f.Write([]byte("second\n"))
+	f.wg.Wait()
+
+	if rotated, _ := f.Rotated(); len(rotated) != 1 {
+		t.Fatalf("invalid number of rotated files - got %d; expected %d", len(rotated), 1)
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "nfr.log")
+
+	f, err := Open(name, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("before\n"))
+	// external rotation moves the file and signals nfr
+	if err := os.Rename(name, name+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReopenAll(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "after\n" {
+		t.Fatalf("invalid reopened file content %q", b)
+	}
+}
+
+func TestFileRotateOpenFailed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nfr-rotate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "nfr.log")
+
+	f, err := Open(name, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// directory is removed, so the file can be neither rotated nor opened again
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Rotate(); err == nil {
+		t.Fatal("expected rotation error")
+	}
+	if _, err := f.Write([]byte("lost\n")); err != os.ErrClosed {
+		t.Fatalf("got error %v, expected %v", err, os.ErrClosed)
+	}
+}
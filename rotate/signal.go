@@ -0,0 +1,23 @@
+// +build !windows,!plan9
+
+package rotate
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ReopenOnSignal reopens all open files on SIGHUP and SIGUSR1,
+// for compatibility with external log rotation. Errors are passed to onError.
+func ReopenOnSignal(onError func(error)) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP, syscall.SIGUSR1)
+	go func() {
+		for range c {
+			if err := ReopenAll(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,6 @@
+// +build windows plan9
+
+package rotate
+
+// ReopenOnSignal does nothing on systems, where there are no SIGHUP and SIGUSR1 signals.
+func ReopenOnSignal(onError func(error)) {}
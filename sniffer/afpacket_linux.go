@@ -0,0 +1,250 @@
+package sniffer
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/alphasoc/nfr/packet"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/afpacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"golang.org/x/net/bpf"
+)
+
+// Defaults for afpacket sniffer.
+const (
+	DefaultAFPacketBufferSize = 64 << 20
+	DefaultAFPacketBlockSize  = 1 << 20
+)
+
+// pollTimeout is used to check if sniffer was closed while waiting for packets.
+const pollTimeout = 500 * time.Millisecond
+
+// fanoutGroups is the number of fanout groups created by the process.
+var fanoutGroups uint32
+
+// newFanoutID returns id of a new fanout group. A group can't span more than
+// one interface, so each sniffer has its own group, unique in the process.
+func newFanoutID() uint16 {
+	return uint16(os.Getpid()) + uint16(atomic.AddUint32(&fanoutGroups, 1))
+}
+
+// AFPacketSniffer sniffs packets using AF_PACKET TPACKET_V3 ring buffers.
+// If fanout is greater than 1, then traffic is shared between sockets
+// in fanout group and each socket is read by own goroutine.
+type AFPacketSniffer struct {
+	handles []*afpacket.TPacket
+	packets chan gopacket.Packet
+
+	// promiscFD is the socket keeping the interface in promiscuous mode, or -1.
+	promiscFD int
+
+	once    sync.Once
+	readers sync.WaitGroup
+	closed  chan struct{}
+}
+
+// NewAFPacketSniffer creates sniffer that capture packets from interface using AF_PACKET.
+func NewAFPacketSniffer(iface string, cfg *Config) (*AFPacketSniffer, error) {
+	if cfg == nil {
+		cfg = &Config{Promiscuous: true}
+	}
+
+	var (
+		blockSize  = cfg.BlockSize
+		bufferSize = cfg.BufferSize
+		fanout     = cfg.Fanout
+	)
+	if blockSize <= 0 {
+		blockSize = DefaultAFPacketBlockSize
+	}
+	if bufferSize <= 0 {
+		bufferSize = DefaultAFPacketBufferSize
+	}
+	if fanout <= 0 {
+		fanout = 1
+	}
+
+	// ring buffer is shared between all sockets in fanout group
+	numBlocks := bufferSize / blockSize / fanout
+	if numBlocks < 1 {
+		numBlocks = 1
+	}
+
+	// snaplen is applied by the kernel, as return value of compiled filter
+	filter, err := pcap.CompileBPFFilter(layers.LinkTypeEthernet, cfg.snaplen(), cfg.BPFilter)
+	if err != nil {
+		return nil, err
+	}
+	rawFilter := make([]bpf.RawInstruction, len(filter))
+	for i, ins := range filter {
+		rawFilter[i] = bpf.RawInstruction{Op: ins.Code, Jt: ins.Jt, Jf: ins.Jf, K: ins.K}
+	}
+
+	s := &AFPacketSniffer{
+		packets:   make(chan gopacket.Packet, 1000),
+		closed:    make(chan struct{}),
+		promiscFD: -1,
+	}
+
+	fanoutID := newFanoutID()
+	for i := 0; i < fanout; i++ {
+		handle, err := afpacket.NewTPacket(
+			afpacket.OptInterface(iface),
+			afpacket.OptTPacketVersion(afpacket.TPacketVersion3),
+			afpacket.OptBlockSize(blockSize),
+			afpacket.OptNumBlocks(numBlocks),
+			afpacket.OptPollTimeout(pollTimeout),
+		)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.handles = append(s.handles, handle)
+
+		if err := handle.SetBPF(rawFilter); err != nil {
+			s.Close()
+			return nil, err
+		}
+		if fanout > 1 {
+			if err := handle.SetFanout(afpacket.FanoutHash, fanoutID); err != nil {
+				s.Close()
+				return nil, err
+			}
+		}
+	}
+
+	if cfg.Promiscuous {
+		if s.promiscFD, err = setPromisc(iface); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// Packets returns a channel of captured packets, allowing easy iterating over them.
+func (s *AFPacketSniffer) Packets() chan gopacket.Packet {
+	s.once.Do(func() {
+		for _, handle := range s.handles {
+			s.readers.Add(1)
+			go func(handle *afpacket.TPacket) {
+				defer s.readers.Done()
+				s.read(handle)
+			}(handle)
+		}
+
+		go func() {
+			s.readers.Wait()
+			close(s.packets)
+		}()
+	})
+	return s.packets
+}
+
+// read reads packets from the socket until sniffer is closed.
+func (s *AFPacketSniffer) read(handle *afpacket.TPacket) {
+	decoder := packet.LinkTypeDecoder(int(layers.LinkTypeEthernet))
+	for {
+		select {
+		case <-s.closed:
+			return
+		default:
+		}
+
+		data, ci, err := handle.ReadPacketData()
+		if err == afpacket.ErrTimeout || err == syscall.EINTR {
+			continue
+		} else if err != nil {
+			return
+		}
+
+		p := gopacket.NewPacket(data, decoder, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		m := p.Metadata()
+		m.CaptureInfo = ci
+		m.Truncated = m.Truncated || ci.CaptureLength < ci.Length
+
+		select {
+		case s.packets <- p:
+		case <-s.closed:
+			return
+		}
+	}
+}
+
+// Stats returns capture statistics summed over all sockets.
+func (s *AFPacketSniffer) Stats() (*Stats, error) {
+	var stats Stats
+	for _, handle := range s.handles {
+		_, v3, err := handle.SocketStats()
+		if err != nil {
+			return nil, err
+		}
+		stats.Received += int(v3.Packets())
+		stats.Dropped += int(v3.Drops())
+	}
+	return &stats, nil
+}
+
+// Close stops sniffer and closes underlying sockets.
+func (s *AFPacketSniffer) Close() {
+	select {
+	case <-s.closed:
+		return
+	default:
+		close(s.closed)
+	}
+
+	if s.promiscFD != -1 {
+		syscall.Close(s.promiscFD)
+	}
+
+	// readers notice the sniffer is closed within poll timeout
+	s.readers.Wait()
+	for _, handle := range s.handles {
+		handle.Close()
+	}
+}
+
+// packetMreq is struct packet_mreq used with PACKET_ADD_MEMBERSHIP.
+type packetMreq struct {
+	ifindex int32
+	typ     uint16
+	alen    uint16
+	address [8]byte
+}
+
+// setPromisc puts the interface into promiscuous mode for as long as the
+// returned socket is open. The kernel counts promiscuous memberships and
+// drops them when the socket is closed, also if nfr is killed, so the mode
+// set by others is kept.
+func setPromisc(iface string) (int, error) {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return -1, err
+	}
+
+	// socket of protocol 0 receives no packets, it only holds the membership
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, 0)
+	if err != nil {
+		return -1, err
+	}
+
+	mreq := packetMreq{ifindex: int32(ifi.Index), typ: syscall.PACKET_MR_PROMISC}
+	_, _, errno := syscall.Syscall6(syscall.SYS_SETSOCKOPT, uintptr(fd),
+		syscall.SOL_PACKET, syscall.PACKET_ADD_MEMBERSHIP,
+		uintptr(unsafe.Pointer(&mreq)), unsafe.Sizeof(mreq), 0)
+	if errno != 0 {
+		syscall.Close(fd)
+		return -1, fmt.Errorf("set %s interface promiscuous mode: %s", iface, errno)
+	}
+	return fd, nil
+}
@@ -0,0 +1,70 @@
+package sniffer
+
+import (
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// promiscuous returns true if the interface is in promiscuous mode.
+func promiscuous(t *testing.T, iface string) bool {
+	b, err := ioutil.ReadFile("/sys/class/net/" + iface + "/flags")
+	if err != nil {
+		t.Skip(err)
+	}
+	flags, err := strconv.ParseUint(strings.TrimSpace(string(b)), 0, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return flags&syscall.IFF_PROMISC != 0
+}
+
+func TestSetPromisc(t *testing.T) {
+	if _, err := setPromisc("__none"); err == nil {
+		t.Fatal("promiscuous mode set without error for non existing interface")
+	}
+
+	if promiscuous(t, "lo") {
+		t.Skip("lo interface already in promiscuous mode")
+	}
+	fd, err := setPromisc("lo")
+	if err == syscall.EPERM {
+		t.Skip(err)
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	if !promiscuous(t, "lo") {
+		t.Fatal("lo interface not in promiscuous mode")
+	}
+
+	// the mode is dropped with the socket
+	syscall.Close(fd)
+	if promiscuous(t, "lo") {
+		t.Fatal("lo interface still in promiscuous mode")
+	}
+}
+
+func TestAFPacketSnifferFanout(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ifaces) < 2 {
+		t.Skip("two interfaces required")
+	}
+
+	// fanout group of each sniffer is bound to its own interface
+	cfg := &Config{BPFilter: "tcp or udp", Fanout: 2}
+	for _, ifi := range ifaces[:2] {
+		s, err := NewAFPacketSniffer(ifi.Name, cfg)
+		if err == syscall.EPERM {
+			t.Skip(err)
+		} else if err != nil {
+			t.Fatalf("%s sniffer: %s", ifi.Name, err)
+		}
+		defer s.Close()
+	}
+}
@@ -0,0 +1,34 @@
+// +build !linux
+
+package sniffer
+
+import (
+	"errors"
+
+	"github.com/google/gopacket"
+)
+
+var errAFPacketNotImplemented = errors.New("afpacket not implemented for this platform")
+
+// AFPacketSniffer sniffs packets using AF_PACKET TPACKET_V3 ring buffers.
+type AFPacketSniffer struct {
+}
+
+// NewAFPacketSniffer creates sniffer that capture packets from interface using AF_PACKET.
+func NewAFPacketSniffer(iface string, cfg *Config) (*AFPacketSniffer, error) {
+	return nil, errAFPacketNotImplemented
+}
+
+// Packets returns a channel of captured packets, allowing easy iterating over them.
+func (s *AFPacketSniffer) Packets() chan gopacket.Packet {
+	return nil
+}
+
+// Stats returns capture statistics summed over all sockets.
+func (s *AFPacketSniffer) Stats() (*Stats, error) {
+	return nil, errAFPacketNotImplemented
+}
+
+// Close stops sniffer and closes underlying sockets.
+func (s *AFPacketSniffer) Close() {
+}
@@ -1,6 +1,10 @@
 package sniffer
 
 import (
+	"sync"
+	"time"
+
+	"github.com/alphasoc/nfr/packet"
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/pcap"
 )
@@ -8,29 +12,98 @@ import (
 // Sniffer is an interface for iterate over captured packets.
 type Sniffer interface {
 	Packets() chan gopacket.Packet // channel with captured packets
+	Stats() (*Stats, error)        // capture statistics
+	Close()                        // stops capture and closes packets channel
+}
+
+// Stats of captured packets.
+type Stats struct {
+	Received  int // number of packets received
+	Dropped   int // number of packets dropped by the kernel
+	IfDropped int // number of packets dropped by the interface
 }
 
 // PcapSniffer sniffs dns packets.
 type PcapSniffer struct {
 	handle *pcap.Handle
 	source *gopacket.PacketSource
+
+	speed   float64
+	once    sync.Once
+	packets chan gopacket.Packet
 }
 
 // Config options for sniffer.
 type Config struct {
 	BPFilter string
+
+	// Snaplen is the maximum number of bytes captured from a packet.
+	// Default: 1600
+	Snaplen int
+	// Promiscuous sets the interface into promiscuous mode.
+	Promiscuous bool
+	// BufferSize is the size of kernel capture buffer in bytes.
+	// Default: system default for pcap, 64MB for afpacket
+	BufferSize int
+
+	// BlockSize is the size of afpacket ring buffer block in bytes.
+	// Default: 1MB
+	BlockSize int
+	// Fanout is the number of afpacket sockets sharing captured traffic.
+	// Default: 1
+	Fanout int
+
+	// Speed is a replay speed multiplier of packets read from pcap file,
+	// e.g. 1 replays packets in real time, 2 twice as fast.
+	// Default: 0 - as fast as possible
+	Speed float64
+}
+
+// DefaultSnaplen is the default maximum number of bytes captured from a packet.
+const DefaultSnaplen = 1600
+
+func (cfg *Config) snaplen() int {
+	if cfg.Snaplen <= 0 {
+		return DefaultSnaplen
+	}
+	return cfg.Snaplen
 }
 
 // NewLivePcapSniffer creates sniffer that capture packets from interface.
 func NewLivePcapSniffer(iface string, cfg *Config) (*PcapSniffer, error) {
-	handle, err := pcap.OpenLive(iface, 1600, true, pcap.BlockForever)
+	if cfg == nil {
+		cfg = &Config{Promiscuous: true}
+	}
+
+	inactive, err := pcap.NewInactiveHandle(iface)
+	if err != nil {
+		return nil, err
+	}
+	defer inactive.CleanUp()
+
+	if err := inactive.SetSnapLen(cfg.snaplen()); err != nil {
+		return nil, err
+	}
+	if err := inactive.SetPromisc(cfg.Promiscuous); err != nil {
+		return nil, err
+	}
+	if err := inactive.SetTimeout(pcap.BlockForever); err != nil {
+		return nil, err
+	}
+	if cfg.BufferSize > 0 {
+		if err := inactive.SetBufferSize(cfg.BufferSize); err != nil {
+			return nil, err
+		}
+	}
+
+	handle, err := inactive.Activate()
 	if err != nil {
 		return nil, err
 	}
 	return newsniffer(handle, cfg)
 }
 
-// NewOfflinePcapSniffer creates sniffer that capture packets from pcap file.
+// NewOfflinePcapSniffer creates sniffer that capture packets from pcap or pcapng file.
 func NewOfflinePcapSniffer(file string, cfg *Config) (*PcapSniffer, error) {
 	handle, err := pcap.OpenOffline(file)
 	if err != nil {
@@ -47,14 +120,77 @@ func newsniffer(handle *pcap.Handle, cfg *Config) (*PcapSniffer, error) {
 	}
 
 	return &PcapSniffer{
-		source: gopacket.NewPacketSource(handle, handle.LinkType()),
+		source: gopacket.NewPacketSource(handle, packet.LinkTypeDecoder(LinkType(handle))),
 		handle: handle,
+		speed:  cfg.Speed,
 	}, nil
 }
 
+// LinkType returns pcap link type of the handle. Handle.LinkType truncates
+// link types to uint8, so SLL2 is found among data links of the handle.
+// Live handles list link types the interface supports, and offline ones
+// only the link type of the file.
+func LinkType(handle *pcap.Handle) int {
+	linkType := int(handle.LinkType())
+	if linkType != packet.LinkTypeLinuxSLL2&0xff {
+		return linkType
+	}
+	links, err := handle.ListDataLinks()
+	if err != nil {
+		return linkType
+	}
+	sll2 := pcap.DatalinkValToName(packet.LinkTypeLinuxSLL2)
+	for _, link := range links {
+		if link.Name == sll2 {
+			return packet.LinkTypeLinuxSLL2
+		}
+	}
+	return linkType
+}
+
 // Packets returns a channel of captured packets, allowing easy iterating over them.
 func (s *PcapSniffer) Packets() chan gopacket.Packet {
-	return s.source.Packets()
+	s.once.Do(func() {
+		s.packets = s.source.Packets()
+		if s.speed > 0 {
+			s.packets = pace(s.packets, s.speed)
+		}
+	})
+	return s.packets
+}
+
+// pace passes packets to returned channel keeping time gaps between
+// packets timestamps, shortened by speed multiplier.
+func pace(packets chan gopacket.Packet, speed float64) chan gopacket.Packet {
+	paced := make(chan gopacket.Packet, 1000)
+	go func() {
+		defer close(paced)
+
+		var first, start time.Time
+		for p := range packets {
+			ts := p.Metadata().Timestamp
+			if first.IsZero() {
+				first, start = ts, time.Now()
+			} else if d := time.Duration(float64(ts.Sub(first))/speed) - time.Since(start); d > 0 {
+				time.Sleep(d)
+			}
+			paced <- p
+		}
+	}()
+	return paced
+}
+
+// Stats returns capture statistics.
+func (s *PcapSniffer) Stats() (*Stats, error) {
+	stats, err := s.handle.Stats()
+	if err != nil {
+		return nil, err
+	}
+	return &Stats{
+		Received:  stats.PacketsReceived,
+		Dropped:   stats.PacketsDropped,
+		IfDropped: stats.PacketsIfDropped,
+	}, nil
 }
 
 // Close closes underlying handle and stops sniffer.
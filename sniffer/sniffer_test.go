@@ -1,9 +1,17 @@
 package sniffer
 
 import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/alphasoc/nfr/packet"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
 )
 
 func TestPcapSnifferPackets(t *testing.T) {
@@ -48,3 +56,147 @@ func TestNewLivePcapSniffer(t *testing.T) {
 		t.Fatal("sniffer create without error for non existing interface")
 	}
 }
+
+func TestPcapSnifferStats(t *testing.T) {
+	s, err := NewOfflinePcapSniffer("sniffer_test.data", &Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, err := s.Stats(); err == nil {
+		t.Fatal("stats returned without error for offline sniffer")
+	}
+}
+
+func TestNewAFPacketSniffer(t *testing.T) {
+	if _, err := NewAFPacketSniffer("__none", nil); err == nil {
+		t.Fatal("sniffer create without error for non existing interface")
+	}
+}
+
+func TestPcapSnifferPcapng(t *testing.T) {
+	handle, err := pcap.OpenOffline("sniffer_test.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	f, err := ioutil.TempFile("", "nfr-sniffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	w, err := pcapgo.NewNgWriter(f, handle.LinkType())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := gopacket.NewPacketSource(handle, handle.LinkType())
+	for p := range source.Packets() {
+		if err := w.WritePacket(p.Metadata().CaptureInfo, p.Data()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := NewOfflinePcapSniffer(f.Name(), &Config{BPFilter: "tcp or udp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	i := 0
+	for range s.Packets() {
+		i++
+	}
+	if i != 2 {
+		t.Errorf("invalid packet count - got: %d, expected: 2", i)
+	}
+}
+
+func TestPcapSnifferSLL2(t *testing.T) {
+	handle, err := pcap.OpenOffline("sniffer_test.data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	f, err := ioutil.TempFile("", "nfr-sniffer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	// pcapgo writes link type as uint8, so the file header is written here
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], packet.LinkTypeLinuxSLL2)
+	if _, err := f.Write(header); err != nil {
+		t.Fatal(err)
+	}
+	w := pcapgo.NewWriter(f)
+	source := gopacket.NewPacketSource(handle, handle.LinkType())
+	for p := range source.Packets() {
+		eth := p.Layer(layers.LayerTypeEthernet).(*layers.Ethernet)
+		sll2 := make([]byte, 20)
+		binary.BigEndian.PutUint16(sll2[0:], uint16(eth.EthernetType))
+		binary.BigEndian.PutUint32(sll2[4:], 2)
+		binary.BigEndian.PutUint16(sll2[8:], 1)
+		sll2[11] = 6
+		copy(sll2[12:], eth.SrcMAC)
+		data := append(sll2, eth.Payload...)
+		ci := p.Metadata().CaptureInfo
+		ci.CaptureLength, ci.Length = len(data), len(data)
+		if err := w.WritePacket(ci, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := NewOfflinePcapSniffer(f.Name(), &Config{BPFilter: "tcp or udp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	i := 0
+	for p := range s.Packets() {
+		if p.Layer(packet.LayerTypeLinuxSLL2) == nil || p.NetworkLayer() == nil {
+			t.Fatalf("invalid sll2 packet %s", p)
+		}
+		i++
+	}
+	if i != 2 {
+		t.Errorf("invalid packet count - got: %d, expected: 2", i)
+	}
+}
+
+func TestPace(t *testing.T) {
+	packets := make(chan gopacket.Packet, 2)
+	ts := time.Now()
+	for _, d := range []time.Duration{0, 200 * time.Millisecond} {
+		p := gopacket.NewPacket(nil, layers.LayerTypeEthernet, gopacket.Default)
+		p.Metadata().Timestamp = ts.Add(d)
+		packets <- p
+	}
+	close(packets)
+
+	start := time.Now()
+	i := 0
+	for range pace(packets, 4) {
+		i++
+	}
+	if i != 2 {
+		t.Errorf("invalid packet count - got: %d, expected: 2", i)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("invalid replay time - got: %s, expected at least: 50ms", elapsed)
+	}
+}
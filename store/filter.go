@@ -0,0 +1,94 @@
+package store
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+)
+
+// Filter of queried alerts. Empty fields match all alerts.
+type Filter struct {
+	// Since and Until are the time range of events, with Until excluded.
+	Since, Until time.Time
+	// MinSeverity of the event.
+	MinSeverity int
+	// Threats of which at least one must be in the event.
+	Threats []string
+	// SrcNet is the source network, or a single address.
+	SrcNet *net.IPNet
+	// Domain of dns query or url host, also matching its subdomains.
+	Domain string
+	// Groups of which at least one the event must belong to.
+	Groups []string
+	// Limit of the number of alerts.
+	Limit int
+}
+
+// Match checks if the event matches the filter.
+func (f *Filter) Match(event *alerts.Event) bool {
+	if !f.Since.IsZero() && event.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !event.Timestamp.Before(f.Until) {
+		return false
+	}
+	if event.Severity < f.MinSeverity {
+		return false
+	}
+	if len(f.Threats) > 0 && !hasThreat(event, f.Threats) {
+		return false
+	}
+	if f.SrcNet != nil && (event.SrcIP == nil || !f.SrcNet.Contains(event.SrcIP)) {
+		return false
+	}
+	if f.Domain != "" && !matchDomain(eventDomain(event), f.Domain) {
+		return false
+	}
+	if len(f.Groups) > 0 && !hasGroup(event, f.Groups) {
+		return false
+	}
+	return true
+}
+
+func hasThreat(event *alerts.Event, threats []string) bool {
+	for _, tid := range threats {
+		if _, ok := event.Threats[tid]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func hasGroup(event *alerts.Event, groups []string) bool {
+	for _, g := range event.Groups {
+		for _, name := range groups {
+			if g.Label == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// eventDomain returns domain of dns query or http url.
+func eventDomain(event *alerts.Event) string {
+	switch event.EventType {
+	case "dns":
+		return event.Query
+	case "http":
+		if u, err := url.Parse(event.URL); err == nil {
+			return u.Hostname()
+		}
+	}
+	return ""
+}
+
+// matchDomain checks if name is the domain or its subdomain.
+func matchDomain(name, domain string) bool {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	return name == domain || strings.HasSuffix(name, "."+domain)
+}
@@ -0,0 +1,210 @@
+// Package store keeps history of alerts in a local bolt database,
+// so they can be queried without external systems.
+package store
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTimeout is the time to wait for the database lock.
+const openTimeout = 10 * time.Second
+
+var alertsBucket = []byte("alerts")
+
+// Alert is an event stored with its id.
+type Alert struct {
+	ID string `json:"id"`
+	alerts.Event
+}
+
+// Store of alerts. The database is opened only for a single operation,
+// so it can be queried by other process while nfr is running.
+type Store struct {
+	file      string
+	retention time.Duration
+	maxAlerts int
+}
+
+// New creates store in the file. Alerts older than retention are removed,
+// and only maxAlerts newest alerts are kept. Zero value disables the limit.
+func New(file string, retention time.Duration, maxAlerts int) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	s := &Store{file: file, retention: retention, maxAlerts: maxAlerts}
+	err := s.update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(alertsBucket)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Open opens existing store for reading.
+func Open(file string) (*Store, error) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, err
+	}
+	return &Store{file: file}, nil
+}
+
+func (s *Store) update(fn func(*bolt.Tx) error) error {
+	db, err := bolt.Open(s.file, 0644, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return fmt.Errorf("open %s: %s", s.file, err)
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+func (s *Store) view(fn func(*bolt.Tx) error) error {
+	db, err := bolt.Open(s.file, 0644, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("open %s: %s", s.file, err)
+	}
+	defer db.Close()
+	return db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(alertsBucket) == nil {
+			return nil
+		}
+		return fn(tx)
+	})
+}
+
+// Record stores the events and removes old ones. It implements alerts.Recorder interface.
+func (s *Store) Record(events []alerts.Event) error {
+	return s.update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(alertsBucket)
+		for n := range events {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			v, err := json.Marshal(&events[n])
+			if err != nil {
+				return err
+			}
+			if err := b.Put(newKey(events[n].Timestamp, seq), v); err != nil {
+				return err
+			}
+		}
+		return s.prune(b, time.Now())
+	})
+}
+
+// prune removes alerts above the retention limits.
+func (s *Store) prune(b *bolt.Bucket, now time.Time) error {
+	c := b.Cursor()
+	if s.retention > 0 {
+		limit := newKey(now.Add(-s.retention), 0)
+		for k, _ := c.First(); k != nil && bytes.Compare(k, limit) < 0; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if s.maxAlerts > 0 {
+		// bucket stats don't include changes of the transaction
+		count := 0
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			count++
+		}
+		for k, _ := c.First(); k != nil && count > s.maxAlerts; k, _ = c.First() {
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			count--
+		}
+	}
+	return nil
+}
+
+// newKey returns key of alert sorted by event time.
+func newKey(ts time.Time, seq uint64) []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(ts.UnixNano()))
+	binary.BigEndian.PutUint64(key[8:], seq)
+	return key
+}
+
+// Query alerts matching the filter, from the newest one.
+func (s *Store) Query(f *Filter, fn func(*Alert) error) error {
+	return s.view(func(tx *bolt.Tx) error {
+		c := tx.Bucket(alertsBucket).Cursor()
+
+		var k, v []byte
+		if f.Until.IsZero() {
+			k, v = c.Last()
+		} else if k, v = c.Seek(newKey(f.Until, 0)); k == nil {
+			k, v = c.Last()
+		} else {
+			k, v = c.Prev()
+		}
+
+		var since []byte
+		if !f.Since.IsZero() {
+			since = newKey(f.Since, 0)
+		}
+
+		count := 0
+		for ; k != nil; k, v = c.Prev() {
+			if since != nil && bytes.Compare(k, since) < 0 {
+				break
+			}
+			a, err := decode(k, v)
+			if err != nil {
+				return err
+			}
+			if !f.Match(&a.Event) {
+				continue
+			}
+			if err := fn(a); err != nil {
+				return err
+			}
+			if count++; f.Limit > 0 && count >= f.Limit {
+				break
+			}
+		}
+		return nil
+	})
+}
+
+// Get returns alert with the id, or nil if it doesn't exist.
+func (s *Store) Get(id string) (*Alert, error) {
+	key, err := hex.DecodeString(id)
+	if err != nil || len(key) != 16 {
+		return nil, fmt.Errorf("invalid alert id %s", id)
+	}
+
+	var a *Alert
+	err = s.view(func(tx *bolt.Tx) error {
+		v := tx.Bucket(alertsBucket).Get(key)
+		if v == nil {
+			return nil
+		}
+		a, err = decode(key, v)
+		return err
+	})
+	return a, err
+}
+
+func decode(k, v []byte) (*Alert, error) {
+	a := &Alert{ID: hex.EncodeToString(k)}
+	if err := json.Unmarshal(v, &a.Event); err != nil {
+		return nil, fmt.Errorf("decode alert %s: %s", a.ID, err)
+	}
+	return a, nil
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alphasoc/nfr/alerts"
+	"github.com/alphasoc/nfr/client"
+)
+
+func newTestEvent(tid string, severity int, ts time.Time, srcIP net.IP, query string) alerts.Event {
+	return alerts.Event{
+		Severity:  severity,
+		EventType: "dns",
+		Threats:   map[string]alerts.Threat{tid: {Severity: severity, Description: tid}},
+		Groups:    []alerts.Group{{Label: "default"}},
+		EventUnified: client.EventUnified{
+			Timestamp: ts,
+			SrcIP:     srcIP,
+			Query:     query,
+			QueryType: "A",
+		},
+	}
+}
+
+func queryIDs(t *testing.T, s *Store, f *Filter) []string {
+	var ids []string
+	if err := s.Query(f, func(a *Alert) error {
+		ids = append(ids, a.Threats[threatID(a)].Description)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func threatID(a *Alert) string {
+	for tid := range a.Threats {
+		return tid
+	}
+	return ""
+}
+
+func TestStoreQuery(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "alerts.db"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	err = s.Record([]alerts.Event{
+		newTestEvent("c2", 5, now.Add(-3*time.Hour), net.IPv4(10, 0, 0, 1), "c2.example.com"),
+		newTestEvent("dga", 4, now.Add(-2*time.Hour), net.IPv4(10, 0, 1, 1), "xkcdqwe.com"),
+		newTestEvent("young", 2, now.Add(-time.Hour), net.IPv4(10, 0, 0, 2), "example.com"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{"all", Filter{}, []string{"young", "dga", "c2"}},
+		{"limit", Filter{Limit: 2}, []string{"young", "dga"}},
+		{"since", Filter{Since: now.Add(-150 * time.Minute)}, []string{"young", "dga"}},
+		{"until", Filter{Until: now.Add(-time.Hour)}, []string{"dga", "c2"}},
+		{"severity", Filter{MinSeverity: 4}, []string{"dga", "c2"}},
+		{"threat", Filter{Threats: []string{"dga", "unknown"}}, []string{"dga"}},
+		{"src net", Filter{SrcNet: &net.IPNet{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(24, 32)}}, []string{"young", "c2"}},
+		{"domain", Filter{Domain: "example.com"}, []string{"young", "c2"}},
+		{"group", Filter{Groups: []string{"other"}}, nil},
+	} {
+		ids := queryIDs(t, s, &tt.filter)
+		if len(ids) != len(tt.expected) {
+			t.Fatalf("%s: got %v, expected %v", tt.name, ids, tt.expected)
+		}
+		for n := range ids {
+			if ids[n] != tt.expected[n] {
+				t.Fatalf("%s: got %v, expected %v", tt.name, ids, tt.expected)
+			}
+		}
+	}
+
+	var id string
+	s.Query(&Filter{Limit: 1}, func(a *Alert) error {
+		id = a.ID
+		return nil
+	})
+	a, err := s.Get(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == nil || a.Query != "example.com" || !a.SrcIP.Equal(net.IPv4(10, 0, 0, 2)) {
+		t.Fatalf("invalid alert %+v", a)
+	}
+	if a, err := s.Get("00000000000000000000000000000000"); err != nil || a != nil {
+		t.Fatalf("got alert %v for unknown id, err %v", a, err)
+	}
+}
+
+func TestStoreRetention(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "alerts.db"), 24*time.Hour, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	err = s.Record([]alerts.Event{
+		newTestEvent("old", 5, now.Add(-48*time.Hour), net.IPv4(10, 0, 0, 1), "example.com"),
+		newTestEvent("first", 5, now.Add(-3*time.Hour), net.IPv4(10, 0, 0, 1), "example.com"),
+		newTestEvent("second", 5, now.Add(-2*time.Hour), net.IPv4(10, 0, 0, 1), "example.com"),
+		newTestEvent("third", 5, now.Add(-time.Hour), net.IPv4(10, 0, 0, 1), "example.com"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := queryIDs(t, s, &Filter{})
+	if len(ids) != 2 || ids[0] != "third" || ids[1] != "second" {
+		t.Fatalf("got %v, expected [third second]", ids)
+	}
+}
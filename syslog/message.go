@@ -0,0 +1,207 @@
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Facility of syslog message.
+type Facility int
+
+// Facilities defined by RFC 5424.
+const (
+	Kern Facility = iota
+	User
+	Mail
+	Daemon
+	Auth
+	Syslog
+	LPR
+	News
+	UUCP
+	Cron
+	AuthPriv
+	FTP
+	Local0 Facility = iota + 4
+	Local1
+	Local2
+	Local3
+	Local4
+	Local5
+	Local6
+	Local7
+)
+
+var facilityNames = map[string]Facility{
+	"kern":     Kern,
+	"user":     User,
+	"mail":     Mail,
+	"daemon":   Daemon,
+	"auth":     Auth,
+	"syslog":   Syslog,
+	"lpr":      LPR,
+	"news":     News,
+	"uucp":     UUCP,
+	"cron":     Cron,
+	"authpriv": AuthPriv,
+	"ftp":      FTP,
+	"local0":   Local0,
+	"local1":   Local1,
+	"local2":   Local2,
+	"local3":   Local3,
+	"local4":   Local4,
+	"local5":   Local5,
+	"local6":   Local6,
+	"local7":   Local7,
+}
+
+// ParseFacility returns facility by its name, e.g. local0.
+func ParseFacility(name string) (Facility, error) {
+	f, ok := facilityNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog facility %s", name)
+	}
+	return f, nil
+}
+
+// Severity of syslog message.
+type Severity int
+
+// Severities defined by RFC 5424.
+const (
+	Emergency Severity = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Info
+	Debug
+)
+
+// nilValue is used for empty header fields and structured data.
+const nilValue = "-"
+
+// timeFormat is RFC 3339 format with microseconds, as allowed by RFC 5424.
+const timeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// SDParam is a parameter of structured data element.
+type SDParam struct {
+	Name  string
+	Value string
+}
+
+// SDElement is a structured data element. ID of elements not registered
+// with IANA must be in name@<private enterprise number> format.
+type SDElement struct {
+	ID     string
+	Params []SDParam
+}
+
+// Message is RFC 5424 syslog message.
+type Message struct {
+	Severity Severity
+	// Timestamp of the message. If zero, then current time is used.
+	Timestamp      time.Time
+	MsgID          string
+	StructuredData []SDElement
+	Msg            []byte
+}
+
+// Header fields common for all messages of a client.
+type header struct {
+	facility Facility
+	hostname string
+	appName  string
+	procID   string
+}
+
+func newHeader(facility Facility, hostname, appName string) header {
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	return header{
+		facility: facility,
+		hostname: headerField(hostname, 255),
+		appName:  headerField(appName, 48),
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+}
+
+// format returns message in RFC 5424 format.
+func (h *header) format(m *Message) []byte {
+	ts := m.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "<%d>1 %s %s %s %s %s ",
+		int(h.facility)*8+int(m.Severity),
+		ts.Format(timeFormat),
+		h.hostname,
+		h.appName,
+		h.procID,
+		headerField(m.MsgID, 32),
+	)
+
+	if len(m.StructuredData) == 0 {
+		buf.WriteString(nilValue)
+	}
+	for _, e := range m.StructuredData {
+		buf.WriteByte('[')
+		buf.WriteString(sdName(e.ID))
+		for _, p := range e.Params {
+			buf.WriteByte(' ')
+			buf.WriteString(sdName(p.Name))
+			buf.WriteString(`="`)
+			buf.WriteString(sdValueEscaper.Replace(p.Value))
+			buf.WriteByte('"')
+		}
+		buf.WriteByte(']')
+	}
+
+	if len(m.Msg) > 0 {
+		buf.WriteByte(' ')
+		buf.Write(m.Msg)
+	}
+	return buf.Bytes()
+}
+
+// sdValueEscaper escapes characters not allowed in structured data param value.
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// headerField returns printable ascii field no longer than max, or nil value if it's empty.
+func headerField(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return nilValue
+	}
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
+
+// sdName returns structured data name without characters not allowed in it.
+func sdName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' || r == '=' || r == ']' || r == '"' {
+			return -1
+		}
+		return r
+	}, s)
+	if len(s) > 32 {
+		s = s[:32]
+	}
+	return s
+}
@@ -0,0 +1,171 @@
+// Package syslog implements RFC 5424 syslog client, with RFC 5425 tls
+// transport and RFC 6587 framing over tcp.
+package syslog
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Framing of messages sent over tcp.
+const (
+	// OctetCounting prefixes messages with their length (RFC 6587 section 3.4.1).
+	OctetCounting = "octet-counting"
+	// NonTransparent terminates messages with new line (RFC 6587 section 3.4.2).
+	NonTransparent = "non-transparent"
+)
+
+var errNotConnected = errors.New("not connected")
+
+// DefaultTimeout of connecting and writing to the server.
+const DefaultTimeout = 10 * time.Second
+
+// Config of syslog client.
+type Config struct {
+	// Network is udp or tcp.
+	Network string
+	// Addr of the server in host:port format.
+	Addr string
+	// TLS config of tcp connection. If nil, then connection is not encrypted.
+	TLS *tls.Config
+	// Framing of tcp messages. Default is octet counting.
+	Framing string
+	// Timeout of connecting and writing to the server.
+	Timeout time.Duration
+
+	Facility Facility
+	// Hostname of the messages. If empty, then the host name is used.
+	Hostname string
+	AppName  string
+}
+
+// Client of syslog server. Connection is opened on first send
+// and reopened if writing fails.
+type Client struct {
+	cfg    Config
+	header header
+
+	mx   sync.Mutex
+	conn net.Conn
+}
+
+// New returns syslog client. It doesn't connect to the server,
+// so it may be created while the server is unreachable.
+func New(cfg Config) (*Client, error) {
+	switch cfg.Network {
+	case "":
+		cfg.Network = "tcp"
+	case "udp", "tcp":
+	default:
+		return nil, fmt.Errorf("unsupported network %s", cfg.Network)
+	}
+	if cfg.Network == "udp" && cfg.TLS != nil {
+		return nil, fmt.Errorf("tls is not supported over udp")
+	}
+
+	switch cfg.Framing {
+	case "":
+		cfg.Framing = OctetCounting
+	case OctetCounting, NonTransparent:
+	default:
+		return nil, fmt.Errorf("unsupported framing %s", cfg.Framing)
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	return &Client{
+		cfg:    cfg,
+		header: newHeader(cfg.Facility, cfg.Hostname, cfg.AppName),
+	}, nil
+}
+
+// dial opens the connection. It must be called with the lock held.
+func (c *Client) dial() error {
+	dialer := &net.Dialer{Timeout: c.cfg.Timeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if c.cfg.TLS != nil {
+		conn, err = tls.DialWithDialer(dialer, c.cfg.Network, c.cfg.Addr, c.cfg.TLS)
+	} else {
+		conn, err = dialer.Dial(c.cfg.Network, c.cfg.Addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	return nil
+}
+
+// Send sends the message. The connection is opened if it's not yet open.
+// If the connection is broken, then it's reopened and the message is sent
+// once again.
+func (c *Client) Send(m *Message) error {
+	b := c.frame(c.header.format(m))
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.conn == nil {
+		if err := c.dial(); err != nil {
+			return err
+		}
+		return c.write(b)
+	}
+
+	err := c.write(b)
+	if err == nil {
+		return nil
+	}
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	if err := c.dial(); err != nil {
+		return err
+	}
+	return c.write(b)
+}
+
+// write writes framed message. It must be called with the lock held.
+func (c *Client) write(b []byte) error {
+	if c.conn == nil {
+		return errNotConnected
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.cfg.Timeout))
+	_, err := c.conn.Write(b)
+	return err
+}
+
+// frame frames the message for transport. Udp messages are sent as is.
+func (c *Client) frame(b []byte) []byte {
+	if c.cfg.Network == "udp" {
+		return b
+	}
+	if c.cfg.Framing == NonTransparent {
+		return append(b, '\n')
+	}
+	return append([]byte(strconv.Itoa(len(b))+" "), b...)
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
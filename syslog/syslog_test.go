@@ -0,0 +1,140 @@
+package syslog
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	h := newHeader(Local0, "nfr host", "NFR")
+	b := h.format(&Message{
+		Severity:  Warning,
+		Timestamp: time.Date(2021, 3, 4, 10, 15, 0, 123456000, time.UTC),
+		MsgID:     "dns",
+		StructuredData: []SDElement{{ID: "nfr@32473", Params: []SDParam{
+			{Name: "threat", Value: "c2_communication"},
+			{Name: "query", Value: `a"b]c\d`},
+		}}},
+		Msg: []byte("C2 communication"),
+	})
+
+	expected := "<132>1 2021-03-04T10:15:00.123456Z nfrhost NFR " + strconv.Itoa(os.Getpid()) +
+		` dns [nfr@32473 threat="c2_communication" query="a\"b\]c\\d"] C2 communication`
+	if string(b) != expected {
+		t.Fatalf("got\n%s\nexpected\n%s", b, expected)
+	}
+
+	b = h.format(&Message{Severity: Info, Timestamp: time.Date(2021, 3, 4, 10, 15, 0, 0, time.UTC)})
+	expected = "<134>1 2021-03-04T10:15:00.000000Z nfrhost NFR " + strconv.Itoa(os.Getpid()) + " - -"
+	if string(b) != expected {
+		t.Fatalf("got\n%s\nexpected\n%s", b, expected)
+	}
+}
+
+func TestParseFacility(t *testing.T) {
+	for name, f := range map[string]Facility{"kern": 0, "user": 1, "local0": 16, "LOCAL7": 23} {
+		if got, err := ParseFacility(name); err != nil || got != f {
+			t.Fatalf("got facility %d for %s, expected %d", got, name, f)
+		}
+	}
+	if _, err := ParseFacility("unknown"); err == nil {
+		t.Fatalf("expected error for unknown facility")
+	}
+}
+
+// readOctetCounted reads message framed with octet counting.
+func readOctetCounted(t *testing.T, r *bufio.Reader) string {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := strconv.Atoi(length[:len(length)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, n)
+	if _, err := r.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSendReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	c, err := New(Config{Network: "tcp", Addr: l.Addr().String(), AppName: "NFR", Hostname: "nfr"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// connection is opened on first send
+	if err := c.Send(&Message{Msg: []byte("first")}); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if m := readOctetCounted(t, bufio.NewReader(conn)); m[len(m)-5:] != "first" {
+		t.Fatalf("invalid message %q", m)
+	}
+
+	// server closes the connection; first writes may still succeed until
+	// the connection is reset, then the client must reconnect
+	conn.Close()
+	for n := 0; n < 5; n++ {
+		if err := c.Send(&Message{Msg: []byte("second")}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn, err = l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if m := readOctetCounted(t, bufio.NewReader(conn)); m[len(m)-6:] != "second" {
+		t.Fatalf("invalid message %q", m)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, cfg := range []Config{
+		{Network: "unix", Addr: "127.0.0.1:514"},
+		{Network: "tcp", Addr: "127.0.0.1:514", Framing: "unknown"},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Fatalf("expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestNewUnreachable(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	c, err := New(Config{Network: "tcp", Addr: addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Send(&Message{Msg: []byte("lost")}); err == nil {
+		t.Fatal("expected error for unreachable server")
+	}
+}